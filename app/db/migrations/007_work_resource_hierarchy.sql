@@ -0,0 +1,11 @@
+-- +goose Up
+-- Work resources form a client -> project -> task tree inside a calendar.
+-- Existing rows become top level tasks.
+alter table work_resources add column parent_id integer not null default 0;
+alter table work_resources add column kind text not null default 'task';
+CREATE INDEX idx_work_resources_parent_id ON work_resources(parent_id);
+
+-- +goose Down
+drop index if exists idx_work_resources_parent_id;
+alter table work_resources drop column kind;
+alter table work_resources drop column parent_id;
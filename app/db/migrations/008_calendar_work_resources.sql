@@ -0,0 +1,17 @@
+-- +goose Up
+-- Shared work resources have calendar_id 0 and are attached to calendars
+-- through this table, each attachment with its own allocation.
+create table if not exists calendar_work_resources(
+	id integer primary key,
+	calendar_id integer not null,
+	work_resource_id integer not null,
+	resources_percentage integer not null,
+	created_at datetime not null,
+	updated_at datetime not null,
+	FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+	FOREIGN KEY (work_resource_id) REFERENCES work_resources(id)
+);
+CREATE UNIQUE INDEX idx_calendar_work_resources_calendar_resource ON calendar_work_resources(calendar_id, work_resource_id);
+
+-- +goose Down
+drop table if exists calendar_work_resources;
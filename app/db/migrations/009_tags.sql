@@ -0,0 +1,23 @@
+-- +goose Up
+create table if not exists tags(
+	id integer primary key,
+	owner_id integer not null,
+	name text not null,
+	created_at datetime not null,
+	updated_at datetime not null,
+	FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX idx_tags_owner_name ON tags(owner_id, name);
+
+create table if not exists calendar_entry_tags(
+	calendar_entry_id integer not null,
+	tag_id integer not null,
+	PRIMARY KEY (calendar_entry_id, tag_id),
+	FOREIGN KEY (calendar_entry_id) REFERENCES calendar_entries(id)
+	FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+CREATE INDEX idx_calendar_entry_tags_tag_id ON calendar_entry_tags(tag_id);
+
+-- +goose Down
+drop table if exists calendar_entry_tags;
+drop table if exists tags;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- Full-text index over calendar entry texts. The application must be built
+-- with the sqlite_fts5 build tag for go-sqlite3 to include the FTS5 module.
+create virtual table if not exists calendar_entries_fts using fts5(
+	text,
+	content='calendar_entries',
+	content_rowid='id',
+	tokenize='unicode61 remove_diacritics 2'
+);
+
+-- +goose StatementBegin
+create trigger if not exists calendar_entries_fts_ai after insert on calendar_entries begin
+	insert into calendar_entries_fts(rowid, text) values (new.id, new.text);
+end;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create trigger if not exists calendar_entries_fts_ad after delete on calendar_entries begin
+	insert into calendar_entries_fts(calendar_entries_fts, rowid, text) values ('delete', old.id, old.text);
+end;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create trigger if not exists calendar_entries_fts_au after update of text on calendar_entries begin
+	insert into calendar_entries_fts(calendar_entries_fts, rowid, text) values ('delete', old.id, old.text);
+	insert into calendar_entries_fts(rowid, text) values (new.id, new.text);
+end;
+-- +goose StatementEnd
+
+insert into calendar_entries_fts(calendar_entries_fts) values ('rebuild');
+
+-- +goose Down
+drop trigger if exists calendar_entries_fts_au;
+drop trigger if exists calendar_entries_fts_ad;
+drop trigger if exists calendar_entries_fts_ai;
+drop table if exists calendar_entries_fts;
@@ -0,0 +1,21 @@
+-- +goose Up
+alter table calendar_entries add column start_time text not null default '';
+alter table calendar_entries add column end_time text not null default '';
+
+create table if not exists calendar_feeds(
+	id integer primary key,
+	calendar_id integer not null,
+	token text not null,
+	past_days integer not null default 90,
+	future_days integer not null default 365,
+	created_at datetime not null,
+	updated_at datetime not null,
+	FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+);
+CREATE UNIQUE INDEX idx_calendar_feeds_calendar_id ON calendar_feeds(calendar_id);
+CREATE UNIQUE INDEX idx_calendar_feeds_token ON calendar_feeds(token);
+
+-- +goose Down
+drop table if exists calendar_feeds;
+alter table calendar_entries drop column end_time;
+alter table calendar_entries drop column start_time;
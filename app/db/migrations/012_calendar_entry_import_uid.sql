@@ -0,0 +1,7 @@
+-- +goose Up
+alter table calendar_entries add column import_uid text not null default '';
+CREATE INDEX idx_calendar_entries_import_uid ON calendar_entries(calendar_id, import_uid);
+
+-- +goose Down
+drop index if exists idx_calendar_entries_import_uid;
+alter table calendar_entries drop column import_uid;
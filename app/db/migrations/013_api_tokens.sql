@@ -0,0 +1,17 @@
+-- +goose Up
+create table if not exists api_tokens(
+	id integer primary key,
+	user_id integer not null references users(id),
+	name text not null,
+	token_hash text not null,
+	token_prefix text not null,
+	scope text not null default 'read',
+	last_used_at datetime,
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens(token_hash);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
+-- +goose Down
+drop table if exists api_tokens;
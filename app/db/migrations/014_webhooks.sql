@@ -0,0 +1,33 @@
+-- +goose Up
+create table if not exists webhooks(
+	id integer primary key,
+	calendar_id integer not null references calendars(id),
+	url text not null,
+	secret text not null,
+	events text not null default '',
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE INDEX idx_webhooks_calendar_id ON webhooks(calendar_id);
+
+create table if not exists webhook_deliveries(
+	id integer primary key,
+	webhook_id integer not null references webhooks(id) on delete cascade,
+	event text not null,
+	payload text not null,
+	status text not null default 'pending',
+	attempts integer not null default 0,
+	next_attempt_at datetime,
+	last_attempt_at datetime,
+	response_status integer not null default 0,
+	response_body text not null default '',
+	error text not null default '',
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+
+-- +goose Down
+drop table if exists webhook_deliveries;
+drop table if exists webhooks;
@@ -0,0 +1,18 @@
+-- +goose Up
+create table if not exists outbox_messages(
+	id integer primary key,
+	topic text not null,
+	subscriber text not null,
+	payload text not null,
+	status text not null default 'pending',
+	attempts integer not null default 0,
+	next_attempt_at datetime,
+	last_attempt_at datetime,
+	error text not null default '',
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE INDEX idx_outbox_messages_due ON outbox_messages(status, next_attempt_at);
+
+-- +goose Down
+drop table if exists outbox_messages;
@@ -0,0 +1,15 @@
+-- +goose Up
+create table if not exists password_reset_tokens(
+	id integer primary key,
+	user_id integer not null references users(id),
+	token_hash text not null,
+	expires_at datetime not null,
+	used_at datetime,
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE UNIQUE INDEX idx_password_reset_tokens_token_hash ON password_reset_tokens(token_hash);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- +goose Down
+drop table if exists password_reset_tokens;
@@ -0,0 +1,16 @@
+-- +goose Up
+create table if not exists email_change_tokens(
+	id integer primary key,
+	user_id integer not null references users(id),
+	new_email text not null,
+	token_hash text not null,
+	expires_at datetime not null,
+	used_at datetime,
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE UNIQUE INDEX idx_email_change_tokens_token_hash ON email_change_tokens(token_hash);
+CREATE INDEX idx_email_change_tokens_user_id ON email_change_tokens(user_id);
+
+-- +goose Down
+drop table if exists email_change_tokens;
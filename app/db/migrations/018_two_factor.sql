@@ -0,0 +1,36 @@
+-- +goose Up
+create table if not exists totp_credentials(
+	id integer primary key,
+	user_id integer not null references users(id),
+	secret text not null,
+	confirmed_at datetime,
+	last_used_step integer not null default 0,
+	created_at datetime not null,
+	updated_at datetime not null
+);
+CREATE UNIQUE INDEX idx_totp_credentials_user_id ON totp_credentials(user_id);
+
+create table if not exists recovery_codes(
+	id integer primary key,
+	user_id integer not null references users(id),
+	code_hash text not null,
+	used_at datetime,
+	created_at datetime not null
+);
+CREATE UNIQUE INDEX idx_recovery_codes_code_hash ON recovery_codes(code_hash);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+create table if not exists login_challenges(
+	id integer primary key,
+	user_id integer not null references users(id),
+	token_hash text not null,
+	attempts integer not null default 0,
+	expires_at datetime not null,
+	created_at datetime not null
+);
+CREATE UNIQUE INDEX idx_login_challenges_token_hash ON login_challenges(token_hash);
+
+-- +goose Down
+drop table if exists login_challenges;
+drop table if exists recovery_codes;
+drop table if exists totp_credentials;
@@ -0,0 +1,5 @@
+-- +goose Up
+alter table calendars add column shared_workday boolean not null default false;
+
+-- +goose Down
+alter table calendars drop column shared_workday;
@@ -0,0 +1,7 @@
+-- +goose Up
+alter table totp_credentials add column failed_attempts integer not null default 0;
+alter table totp_credentials add column locked_until datetime;
+
+-- +goose Down
+alter table totp_credentials drop column locked_until;
+alter table totp_credentials drop column failed_attempts;
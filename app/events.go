@@ -1,21 +1,38 @@
 package app
 
 import (
+	"context"
 	"gothstack/app/events"
+	"gothstack/app/outbox"
 	"gothstack/plugins/auth"
-
-	"github.com/anthdm/superkit/event"
+	"gothstack/plugins/calendar"
 )
 
-// Events are functions that are handled in separate goroutines.
-// They are the perfect fit for offloading work in your handlers
-// that otherwise would take up response time.
+// Events are written to the outbox in the transaction of the change
+// they are about, and handled by a background worker that retries
+// failed handlers. They are the perfect fit for offloading work in
+// your handlers that otherwise would take up response time.
 // - sending email
 // - sending notifications (Slack, Telegram, Discord)
 // - analytics..
+//
+// A handler returns an error to be retried later and may see the
+// same event more than once, so it should be idempotent. The name
+// of a subscription identifies its queued events, keep it stable.
 
 // Register your events here.
 func RegisterEvents() {
-	event.Subscribe(auth.UserSignupEvent, events.OnUserSignup)
-	event.Subscribe(auth.ResendVerificationEvent, events.OnResendVerificationToken)
+	outbox.Subscribe(auth.UserSignupEvent, "send-verification-email", events.OnUserSignup)
+	outbox.Subscribe(auth.ResendVerificationEvent, "send-verification-email", events.OnResendVerificationToken)
+	outbox.Subscribe(auth.PasswordResetRequestEvent, "send-password-reset-email", events.OnPasswordResetRequest)
+	outbox.Subscribe(auth.PasswordResetEvent, "send-password-changed-email", events.OnPasswordReset)
+	outbox.Subscribe(auth.PasswordChangeEvent, "send-password-changed-email", events.OnPasswordChange)
+	outbox.Subscribe(auth.EmailChangeRequestEvent, "send-email-change-confirmation", events.OnEmailChangeRequest)
+	outbox.Subscribe(auth.EmailChangeEvent, "send-email-changed-email", events.OnEmailChange)
+
+	// Calendar events are queued for the webhooks of their calendar and delivered in the background
+	calendar.RegisterWebhookEvents()
+	go calendar.RunWebhookWorker(context.Background())
+
+	go outbox.Run(context.Background())
 }
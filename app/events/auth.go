@@ -1,27 +1,150 @@
 package events
 
 import (
+	"gothstack/app/mail"
 	"gothstack/plugins/auth"
 	"context"
-	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
 )
 
+// verifyEmailData is the data of the verify_email template
+type verifyEmailData struct {
+	FirstName string
+	URL       string
+	ExpiresIn string
+}
+
+// passwordResetData is the data of the password_reset template
+type passwordResetData struct {
+	FirstName string
+	URL       string
+	ExpiresIn string
+}
+
+// passwordChangedData is the data of the password_changed template
+type passwordChangedData struct {
+	FirstName string
+	ChangedAt string
+	URL       string
+}
+
+// confirmEmailChangeData is the data of the confirm_email_change template
+type confirmEmailChangeData struct {
+	FirstName string
+	NewEmail  string
+	URL       string
+	ExpiresIn string
+}
+
+// emailChangedData is the data of the email_changed template
+type emailChangedData struct {
+	FirstName string
+	OldEmail  string
+	NewEmail  string
+	ChangedAt string
+}
+
 // Event handlers
-func OnUserSignup(ctx context.Context, event any) {
-	userWithToken, ok := event.(auth.UserWithVerificationToken)
-	if !ok {
-		return
+func OnUserSignup(ctx context.Context, userWithToken auth.UserWithVerificationToken) error {
+	return sendVerificationEmail(ctx, userWithToken)
+}
+
+func OnResendVerificationToken(ctx context.Context, userWithToken auth.UserWithVerificationToken) error {
+	return sendVerificationEmail(ctx, userWithToken)
+}
+
+// sendVerificationEmail mails the link verifying the email address of a user
+func sendVerificationEmail(ctx context.Context, userWithToken auth.UserWithVerificationToken) error {
+	// Same expiry as createVerificationToken
+	hours, err := strconv.Atoi(kit.Getenv("SUPERKIT_AUTH_EMAIL_VERIFICATION_EXPIRY_IN_HOURS", "1"))
+	if err != nil {
+		hours = 1
+	}
+	expiresIn := fmt.Sprintf("%d hours", hours)
+	if hours == 1 {
+		expiresIn = "1 hour"
 	}
-	b, _ := json.MarshalIndent(userWithToken, "   ", "    ")
-	fmt.Println(string(b))
+	token, err := userWithToken.Token.Open()
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, userWithToken.User.Email, "verify_email", verifyEmailData{
+		FirstName: userWithToken.User.FirstName,
+		URL:       mail.URL("/email/verify?token=" + url.QueryEscape(token)),
+		ExpiresIn: expiresIn,
+	})
 }
 
-func OnResendVerificationToken(ctx context.Context, event any) {
-	userWithToken, ok := event.(auth.UserWithVerificationToken)
-	if !ok {
-		return
+func OnPasswordResetRequest(ctx context.Context, userWithToken auth.UserWithPasswordResetToken) error {
+	minutes := int(time.Until(userWithToken.ExpiresAt).Round(time.Minute).Minutes())
+	if minutes <= 0 {
+		// The event was handled too late, the token cannot be used anymore
+		return nil
+	}
+	token, err := userWithToken.Token.Open()
+	if err != nil {
+		return err
 	}
-	b, _ := json.MarshalIndent(userWithToken, "   ", "    ")
-	fmt.Println(string(b))
+	return mail.Send(ctx, userWithToken.User.Email, "password_reset", passwordResetData{
+		FirstName: userWithToken.User.FirstName,
+		URL:       mail.URL("/password/reset?token=" + url.QueryEscape(token)),
+		ExpiresIn: fmt.Sprintf("%d minutes", minutes),
+	})
+}
+
+func OnPasswordReset(ctx context.Context, user auth.EventUser) error {
+	return sendPasswordChangedEmail(ctx, user)
+}
+
+func OnPasswordChange(ctx context.Context, user auth.EventUser) error {
+	return sendPasswordChangedEmail(ctx, user)
+}
+
+// sendPasswordChangedEmail tells a user that their password was changed
+func sendPasswordChangedEmail(ctx context.Context, user auth.EventUser) error {
+	return mail.Send(ctx, user.Email, "password_changed", passwordChangedData{
+		FirstName: user.FirstName,
+		ChangedAt: user.UpdatedAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+		URL:       mail.URL("/password/forgot"),
+	})
+}
+
+func OnEmailChangeRequest(ctx context.Context, userWithToken auth.UserWithEmailChangeToken) error {
+	minutes := int(time.Until(userWithToken.ExpiresAt).Round(time.Minute).Minutes())
+	if minutes <= 0 {
+		// The event was handled too late, the token cannot be used anymore
+		return nil
+	}
+	expiresIn := fmt.Sprintf("%d minutes", minutes)
+	if hours := minutes / 60; minutes%60 == 0 && hours > 0 {
+		expiresIn = fmt.Sprintf("%d hours", hours)
+		if hours == 1 {
+			expiresIn = "1 hour"
+		}
+	}
+	token, err := userWithToken.Token.Open()
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, userWithToken.NewEmail, "confirm_email_change", confirmEmailChangeData{
+		FirstName: userWithToken.User.FirstName,
+		NewEmail:  userWithToken.NewEmail,
+		URL:       mail.URL("/email/change?token=" + url.QueryEscape(token)),
+		ExpiresIn: expiresIn,
+	})
+}
+
+// OnEmailChange tells the old address of a user that it is not used anymore
+func OnEmailChange(ctx context.Context, change auth.UserWithOldEmail) error {
+	return mail.Send(ctx, change.OldEmail, "email_changed", emailChangedData{
+		FirstName: change.User.FirstName,
+		OldEmail:  change.OldEmail,
+		NewEmail:  change.User.Email,
+		ChangedAt: change.User.UpdatedAt.UTC().Format("January 2, 2006 at 15:04 UTC"),
+	})
 }
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// FileTransport writes each message to an .eml file in Dir instead of sending it, for
+// development. The files open in any mail client.
+type FileTransport struct {
+	Dir string
+}
+
+// unsafeFileChars matches the characters replaced in the recipient part of file names
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// Send writes the message to Dir/<time>-<recipient>.eml
+func (t FileTransport) Send(ctx context.Context, msg Message) error {
+	b, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+	to := "unknown"
+	if len(msg.To) > 0 {
+		to = unsafeFileChars.ReplaceAllString(msg.To[0], "_")
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), to)
+	path := filepath.Join(t.Dir, name)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return err
+	}
+	slog.Info("email written", "to", msg.To, "subject", msg.Subject, "path", path)
+	return nil
+}
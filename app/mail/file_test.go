@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"io"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTransportSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	transport := FileTransport{Dir: dir}
+	msg := Message{
+		From:    "no-reply@example.com",
+		To:      []string{"Ann Example <ann@example.com>"},
+		Subject: "Hello",
+		Text:    "Hello Ann",
+	}
+	if err := transport.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("%d files written, want 1", len(files))
+	}
+	name := files[0].Name()
+	if !strings.HasSuffix(name, "-Ann_Example_ann@example.com_.eml") {
+		t.Errorf("file name %q does not end with the recipient", name)
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	parsed, err := netmail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("To"); got != `"Ann Example" <ann@example.com>` {
+		t.Errorf("To header %q", got)
+	}
+	if got := parsed.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type header %q", got)
+	}
+	body, err := io.ReadAll(parsed.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "Hello Ann" {
+		t.Errorf("body %q, want %q", body, "Hello Ann")
+	}
+}
@@ -0,0 +1,131 @@
+// Package mail renders emails from templates and sends them through a transport: SMTP in
+// production, or .eml files written to disk during development.
+//
+// The transport is configured with environment variables:
+//
+//	MAIL_TRANSPORT      smtp or file, defaults to file in development and smtp otherwise
+//	MAIL_FROM           sender address, "Name <address>" or a bare address
+//	MAIL_SMTP_HOST      SMTP server host, defaults to localhost
+//	MAIL_SMTP_PORT      SMTP server port, defaults to 587
+//	MAIL_SMTP_USERNAME  optional, authenticates with PLAIN when set
+//	MAIL_SMTP_PASSWORD
+//	MAIL_SMTP_TLS       starttls (default), tls for implicit TLS, or none
+//	MAIL_FILE_DIR       directory of the file transport, defaults to tmp/mail
+//	APP_URL             base URL of the links in emails, defaults to http://localhost:3000,
+//	                    also used for the URLs of calendar feeds
+//
+// Any local SMTP stand-in such as Mailpit (SMTP on port 1025) works with MAIL_TRANSPORT=smtp,
+// MAIL_SMTP_PORT=1025 and MAIL_SMTP_TLS=none.
+package mail
+
+import (
+	"context"
+	"fmt"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// Message is a rendered email. Text is required, HTML is sent as an alternative when set.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport sends rendered messages
+type Transport interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Mailer renders templates into messages and sends them from one sender address
+type Mailer struct {
+	Transport Transport
+	From      string
+}
+
+// New returns a mailer sending from the given address through a transport
+func New(transport Transport, from string) *Mailer {
+	return &Mailer{Transport: transport, From: from}
+}
+
+// FromEnv returns a mailer configured with the MAIL_* environment variables
+func FromEnv() (*Mailer, error) {
+	from := kit.Getenv("MAIL_FROM", "gothstack <no-reply@localhost>")
+	if _, err := netmail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", from, err)
+	}
+
+	defaultTransport := "smtp"
+	if kit.IsDevelopment() {
+		defaultTransport = "file"
+	}
+	switch name := kit.Getenv("MAIL_TRANSPORT", defaultTransport); name {
+	case "file":
+		return New(FileTransport{Dir: kit.Getenv("MAIL_FILE_DIR", "tmp/mail")}, from), nil
+	case "smtp":
+		port, err := strconv.Atoi(kit.Getenv("MAIL_SMTP_PORT", "587"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAIL_SMTP_PORT: %w", err)
+		}
+		transport := SMTPTransport{
+			Host:     kit.Getenv("MAIL_SMTP_HOST", "localhost"),
+			Port:     port,
+			Username: kit.Getenv("MAIL_SMTP_USERNAME", ""),
+			Password: kit.Getenv("MAIL_SMTP_PASSWORD", ""),
+			TLS:      kit.Getenv("MAIL_SMTP_TLS", TLSStartTLS),
+		}
+		if transport.TLS != TLSStartTLS && transport.TLS != TLSImplicit && transport.TLS != TLSNone {
+			return nil, fmt.Errorf("invalid MAIL_SMTP_TLS %q", transport.TLS)
+		}
+		return New(transport, from), nil
+	default:
+		return nil, fmt.Errorf("invalid MAIL_TRANSPORT %q", name)
+	}
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultMailer *Mailer
+	defaultErr    error
+)
+
+// Default returns the mailer configured from the environment on first use
+func Default() (*Mailer, error) {
+	defaultOnce.Do(func() {
+		defaultMailer, defaultErr = FromEnv()
+	})
+	return defaultMailer, defaultErr
+}
+
+// Send renders a template and sends it to one recipient with the default mailer
+func Send(ctx context.Context, to, name string, data any) error {
+	m, err := Default()
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, to, name, data)
+}
+
+// Send renders a template and sends it to one recipient
+func (m *Mailer) Send(ctx context.Context, to, name string, data any) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.From, msg.To = m.From, []string{to}
+	if err := m.Transport.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send %s email: %w", name, err)
+	}
+	return nil
+}
+
+// URL returns the absolute URL of a path of the application, for links in emails
+func URL(path string) string {
+	return strings.TrimRight(kit.Getenv("APP_URL", "http://localhost:3000"), "/") + path
+}
@@ -0,0 +1,147 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpRecording is what the test SMTP server received in one conversation
+type smtpRecording struct {
+	From string
+	To   []string
+	Data []byte
+	Err  error
+}
+
+// startSMTPServer serves one plain SMTP conversation on a local port and sends what it
+// received when the client quits
+func startSMTPServer(t *testing.T) (int, <-chan smtpRecording) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	done := make(chan smtpRecording, 1)
+	go func() {
+		var rec smtpRecording
+		defer func() { done <- rec }()
+		conn, err := l.Accept()
+		if err != nil {
+			rec.Err = err
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 localhost ESMTP test")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				rec.Err = err
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				c.PrintfLine("250 localhost")
+			case "MAIL":
+				rec.From = arg
+				c.PrintfLine("250 OK")
+			case "RCPT":
+				rec.To = append(rec.To, arg)
+				c.PrintfLine("250 OK")
+			case "DATA":
+				c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				if rec.Data, err = io.ReadAll(c.DotReader()); err != nil {
+					rec.Err = err
+					return
+				}
+				c.PrintfLine("250 OK")
+			case "QUIT":
+				c.PrintfLine("221 Bye")
+				return
+			default:
+				c.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, done
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	port, done := startSMTPServer(t)
+	transport := SMTPTransport{Host: "127.0.0.1", Port: port, TLS: TLSNone}
+	msg := Message{
+		From:    "Calendar <no-reply@example.com>",
+		To:      []string{"Ann Example <ann@example.com>"},
+		Subject: "Tervetuloa, Åsa",
+		Text:    "Hello Ann,\nwelcome.",
+		HTML:    "<p>Hello Ann,<br>welcome.</p>",
+	}
+	if err := transport.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := <-done
+	if rec.Err != nil {
+		t.Fatal(rec.Err)
+	}
+	if rec.From != "FROM:<no-reply@example.com>" {
+		t.Errorf("MAIL %s, want FROM:<no-reply@example.com>", rec.From)
+	}
+	if len(rec.To) != 1 || rec.To[0] != "TO:<ann@example.com>" {
+		t.Errorf("RCPT %v, want [TO:<ann@example.com>]", rec.To)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(rec.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"From":    `"Calendar" <no-reply@example.com>`,
+		"To":      `"Ann Example" <ann@example.com>`,
+		"Subject": "Tervetuloa, Åsa",
+	} {
+		got, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get(name))
+		if err != nil || got != want {
+			t.Errorf("%s header %q (%v), want %q", name, got, err, want)
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q (%v), want multipart/alternative", mediaType, err)
+	}
+	// The DotReader of the server turns the CRLF line endings into LF
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Hello Ann,\nwelcome."},
+		{"text/html; charset=utf-8", "<p>Hello Ann,<br>welcome.</p>"},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("%s part: %v", want.contentType, err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type %q, want %q", got, want.contentType)
+		}
+		if string(body) != want.body {
+			t.Errorf("%s body %q, want %q", want.contentType, body, want.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("more than two parts: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Email templates. An email called name has a text template name.txt defining a "subject"
+// and a "content" template, and optionally an HTML template name.html defining "content",
+// which is rendered inside layout.html.
+//
+//go:embed templates
+var templates embed.FS
+
+// Render renders the subject, text and HTML of the email template called name
+func Render(name string, data any) (Message, error) {
+	var msg Message
+	text, err := texttemplate.ParseFS(templates, "templates/"+name+".txt")
+	if err != nil {
+		return msg, fmt.Errorf("failed to parse %s email: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return msg, fmt.Errorf("failed to render %s email subject: %w", name, err)
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := text.ExecuteTemplate(&buf, "content", data); err != nil {
+		return msg, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	if _, err := fs.Stat(templates, "templates/"+name+".html"); err != nil {
+		return msg, nil
+	}
+	html, err := htmltemplate.ParseFS(templates, "templates/layout.html", "templates/"+name+".html")
+	if err != nil {
+		return msg, fmt.Errorf("failed to parse %s email: %w", name, err)
+	}
+	buf.Reset()
+	if err := html.ExecuteTemplate(&buf, "layout", map[string]any{"Subject": msg.Subject, "Data": data}); err != nil {
+		return msg, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	msg.HTML = buf.String()
+	return msg, nil
+}
@@ -0,0 +1,288 @@
+// Package outbox delivers events through the database instead of an in-memory channel.
+//
+// Publish writes an event to the outbox_messages table in the transaction of the change it
+// describes, one message per subscriber of its topic, so an event exists if and only if the
+// change was committed. A worker hands the messages to their subscribers and retries failed
+// ones with exponential backoff. A message is only marked delivered once its handler returned
+// without error, so a handler may see the same event again after a failure, a crash or a
+// restart: delivery is at least once and handlers should be idempotent. Messages that keep
+// failing are dead-lettered, they stay in the table with the last error for inspection and
+// can be retried by setting their status back to pending.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gothstack/app/db"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Message statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Delivery settings. A failed message is retried after retryBase, doubling with every attempt,
+// until maxAttempts attempts have failed: about eight hours in total. A message being handled
+// is leased for leaseDuration, so that it is retried if the process dies while handling it.
+const (
+	maxAttempts         = 10
+	retryBase           = 30 * time.Second
+	handlerTimeout      = time.Minute
+	leaseDuration       = 2 * handlerTimeout
+	pollInterval        = 5 * time.Second
+	batchSize           = 50
+	deliveredRetention  = 7 * 24 * time.Hour
+	deadLetterRetention = 90 * 24 * time.Hour
+)
+
+// Message is an event waiting for, or handed to, one subscriber
+type Message struct {
+	ID            uint   `gorm:"primaryKey"`
+	Topic         string `gorm:"not null"`
+	Subscriber    string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Status        string `gorm:"not null"`
+	Attempts      int    `gorm:"not null"`
+	NextAttemptAt *time.Time
+	LastAttemptAt *time.Time
+	Error         string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName keeps the messages apart from any other table named messages
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// subscription is a named handler of a topic. Handle decodes the JSON payload into the
+// type the handler was subscribed with.
+type subscription struct {
+	name   string
+	handle func(ctx context.Context, payload []byte) error
+}
+
+var (
+	mu            sync.RWMutex
+	subscriptions = map[string][]subscription{}
+)
+
+// Subscribe registers a handler for the events of a topic. The name identifies the handler in
+// the outbox, it must be unique per topic and stay the same across releases, otherwise the
+// messages queued for the old name are dead-lettered. Payloads are decoded from JSON into T.
+func Subscribe[T any](topic, name string, handler func(ctx context.Context, payload T) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, sub := range subscriptions[topic] {
+		if sub.name == name {
+			panic(fmt.Sprintf("outbox: %q already subscribed to %q", name, topic))
+		}
+	}
+	subscriptions[topic] = append(subscriptions[topic], subscription{
+		name: name,
+		handle: func(ctx context.Context, payload []byte) error {
+			var v T
+			if err := json.Unmarshal(payload, &v); err != nil {
+				return fmt.Errorf("failed to decode payload: %w", err)
+			}
+			return handler(ctx, v)
+		},
+	})
+}
+
+// findSubscription returns the handler a message was queued for
+func findSubscription(topic, name string) (subscription, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, sub := range subscriptions[topic] {
+		if sub.name == name {
+			return sub, true
+		}
+	}
+	return subscription{}, false
+}
+
+// Publish writes an event to the outbox with tx, the transaction of the change the event is
+// about. It queues a message for every current subscriber of the topic.
+func Publish(tx *gorm.DB, topic string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", topic, err)
+	}
+	mu.RLock()
+	subs := subscriptions[topic]
+	mu.RUnlock()
+	if len(subs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]Message, 0, len(subs))
+	for _, sub := range subs {
+		messages = append(messages, Message{
+			Topic:         topic,
+			Subscriber:    sub.name,
+			Payload:       string(b),
+			Status:        StatusPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if err := tx.Create(&messages).Error; err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", topic, err)
+	}
+	return nil
+}
+
+// Transaction runs fn in a database transaction and wakes the worker once it is committed,
+// so that the events published in fn are handled right away
+func Transaction(fn func(tx *gorm.DB) error) error {
+	if err := db.Get().Transaction(fn); err != nil {
+		return err
+	}
+	wake()
+	return nil
+}
+
+// Emit publishes an event that is not tied to a change in the database
+func Emit(topic string, payload any) error {
+	return Transaction(func(tx *gorm.DB) error {
+		return Publish(tx, topic, payload)
+	})
+}
+
+// wakeup wakes the worker when messages are committed
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run handles due messages until the context is cancelled. It polls for retries and is woken
+// up whenever a transaction publishing events is committed.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := DeliverDue(ctx); err != nil {
+			slog.Error("failed to deliver outbox messages", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wakeup:
+		}
+	}
+}
+
+// DeliverDue hands the pending messages whose next attempt is due to their subscribers, and
+// removes delivered and dead messages older than their retention
+func DeliverDue(ctx context.Context) error {
+	now := time.Now()
+	err := db.Get().Where("(status = ? AND updated_at < ?) OR (status = ? AND updated_at < ?)",
+		StatusDelivered, now.Add(-deliveredRetention), StatusDead, now.Add(-deadLetterRetention)).
+		Delete(&Message{}).Error
+	if err != nil {
+		return err
+	}
+	for {
+		var messages []Message
+		err := db.Get().
+			Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+			Order("next_attempt_at asc, id asc").
+			Limit(batchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+		for i := range messages {
+			if ctx.Err() != nil {
+				return nil
+			}
+			claimed, err := claim(&messages[i])
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+			attempt(ctx, &messages[i])
+			if err := db.Get().Save(&messages[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(messages) < batchSize {
+			return nil
+		}
+	}
+}
+
+// claim leases a message for the time its handler may take. It reports false when another
+// worker claimed the message first.
+func claim(message *Message) (bool, error) {
+	now := time.Now()
+	lease := now.Add(leaseDuration)
+	result := db.Get().Model(&Message{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", message.ID, StatusPending, now).
+		Update("next_attempt_at", lease)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim outbox message %d: %w", message.ID, result.Error)
+	}
+	message.NextAttemptAt = &lease
+	return result.RowsAffected == 1, nil
+}
+
+// attempt hands a message to its subscriber once and records the outcome
+func attempt(ctx context.Context, message *Message) {
+	now := time.Now()
+	message.Attempts++
+	message.LastAttemptAt = &now
+	message.UpdatedAt = now
+	message.Error = ""
+
+	sub, ok := findSubscription(message.Topic, message.Subscriber)
+	if !ok {
+		message.Status, message.NextAttemptAt, message.Error = StatusDead, nil, "no such subscriber"
+		slog.Error("outbox message dead-lettered", "id", message.ID, "topic", message.Topic, "subscriber", message.Subscriber, "err", message.Error)
+		return
+	}
+	err := handle(ctx, sub, []byte(message.Payload))
+	if err == nil {
+		message.Status, message.NextAttemptAt = StatusDelivered, nil
+		return
+	}
+	message.Error = err.Error()
+	if message.Attempts >= maxAttempts {
+		message.Status, message.NextAttemptAt = StatusDead, nil
+		slog.Error("outbox message dead-lettered", "id", message.ID, "topic", message.Topic, "subscriber", message.Subscriber, "err", err)
+		return
+	}
+	next := now.Add(retryBase << (message.Attempts - 1))
+	message.NextAttemptAt = &next
+	slog.Warn("outbox message failed", "id", message.ID, "topic", message.Topic, "subscriber", message.Subscriber, "attempt", message.Attempts, "err", err)
+}
+
+// handle runs a handler with a timeout, turning a panic into an error
+func handle(ctx context.Context, sub subscription, payload []byte) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return sub.handle(ctx, payload)
+}
@@ -0,0 +1,248 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestMain removes the sqlite database app/db opens in the working directory
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Remove("app_db")
+	os.Exit(code)
+}
+
+// setupOutbox creates an empty outbox_messages table with the migration of the app
+func setupOutbox(t *testing.T) {
+	t.Helper()
+	migration, err := os.ReadFile("../db/migrations/015_outbox.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _, _ := strings.Cut(strings.SplitN(string(migration), "-- +goose Up", 2)[1], "-- +goose Down")
+	if err := db.Get().Exec("drop table if exists outbox_messages").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get().Exec(up).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadMessage returns the only message of a topic
+func loadMessage(t *testing.T, topic string) Message {
+	t.Helper()
+	var messages []Message
+	if err := db.Get().Where("topic = ?", topic).Find(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("%d messages of %s, want 1", len(messages), topic)
+	}
+	return messages[0]
+}
+
+// makeDue moves the next attempt of the messages of a topic to the past
+func makeDue(t *testing.T, topic string) {
+	t.Helper()
+	err := db.Get().Model(&Message{}).Where("topic = ? AND status = ?", topic, StatusPending).
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testPayload struct {
+	N int `json:"n"`
+}
+
+func TestPublishRollsBackWithTransaction(t *testing.T) {
+	setupOutbox(t)
+	Subscribe("test.rollback", "test", func(ctx context.Context, p testPayload) error { return nil })
+
+	failed := errors.New("change failed")
+	err := Transaction(func(tx *gorm.DB) error {
+		if err := Publish(tx, "test.rollback", testPayload{N: 1}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("transaction error %v, want %v", err, failed)
+	}
+	var count int64
+	db.Get().Model(&Message{}).Where("topic = ?", "test.rollback").Count(&count)
+	if count != 0 {
+		t.Errorf("%d messages of a rolled back transaction", count)
+	}
+}
+
+func TestDeliverDueRetriesWithBackoff(t *testing.T) {
+	setupOutbox(t)
+	const failures = 3
+	calls := 0
+	Subscribe("test.retry", "test", func(ctx context.Context, p testPayload) error {
+		calls++
+		if p.N != 42 {
+			t.Errorf("payload %d, want 42", p.N)
+		}
+		if calls <= failures {
+			return fmt.Errorf("failure %d", calls)
+		}
+		return nil
+	})
+	if err := Emit("test.retry", testPayload{N: 42}); err != nil {
+		t.Fatal(err)
+	}
+
+	var previous time.Duration
+	for attempt := 1; attempt <= failures; attempt++ {
+		if err := DeliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		message := loadMessage(t, "test.retry")
+		if message.Status != StatusPending || message.Attempts != attempt || message.NextAttemptAt == nil {
+			t.Fatalf("attempt %d: status %s, attempts %d, next attempt %v", attempt, message.Status, message.Attempts, message.NextAttemptAt)
+		}
+		if message.Error != fmt.Sprintf("failure %d", attempt) {
+			t.Errorf("attempt %d: error %q", attempt, message.Error)
+		}
+		delay := message.NextAttemptAt.Sub(*message.LastAttemptAt)
+		if want := retryBase << (attempt - 1); delay != want || delay <= previous {
+			t.Errorf("attempt %d: retried after %s, want %s", attempt, delay, want)
+		}
+		previous = delay
+
+		// Not due yet
+		if err := DeliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if calls != attempt {
+			t.Fatalf("handler called %d times before the message was due again, want %d", calls, attempt)
+		}
+		makeDue(t, "test.retry")
+	}
+
+	if err := DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	message := loadMessage(t, "test.retry")
+	if message.Status != StatusDelivered || message.Attempts != failures+1 || message.NextAttemptAt != nil || message.Error != "" {
+		t.Errorf("after success: status %s, attempts %d, next attempt %v, error %q", message.Status, message.Attempts, message.NextAttemptAt, message.Error)
+	}
+}
+
+func TestDeliverDueDeadLetters(t *testing.T) {
+	setupOutbox(t)
+	calls := 0
+	Subscribe("test.dead", "test", func(ctx context.Context, p testPayload) error {
+		calls++
+		if calls == 2 {
+			panic("handler bug")
+		}
+		return errors.New("always failing")
+	})
+	if err := Emit("test.dead", testPayload{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err := DeliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		makeDue(t, "test.dead")
+	}
+	message := loadMessage(t, "test.dead")
+	if message.Status != StatusDead || message.Attempts != maxAttempts || message.NextAttemptAt != nil {
+		t.Fatalf("status %s, attempts %d, next attempt %v", message.Status, message.Attempts, message.NextAttemptAt)
+	}
+	if message.Error != "always failing" {
+		t.Errorf("error %q, want the last error", message.Error)
+	}
+
+	if err := DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != maxAttempts {
+		t.Errorf("handler called %d times, want %d", calls, maxAttempts)
+	}
+
+	// Messages of unknown subscribers are dead-lettered at once
+	now := time.Now()
+	orphan := Message{Topic: "test.dead", Subscriber: "gone", Payload: "{}", Status: StatusPending, NextAttemptAt: &now, CreatedAt: now, UpdatedAt: now}
+	if err := db.Get().Create(&orphan).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	db.Get().First(&orphan, orphan.ID)
+	if orphan.Status != StatusDead || orphan.Attempts != 1 || orphan.Error != "no such subscriber" {
+		t.Errorf("orphan: status %s, attempts %d, error %q", orphan.Status, orphan.Attempts, orphan.Error)
+	}
+}
+
+func TestClaimedMessageIsNotDeliveredTwice(t *testing.T) {
+	setupOutbox(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	Subscribe("test.claim", "test", func(ctx context.Context, p testPayload) error {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+	if err := Emit("test.claim", testPayload{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second worker runs while the first one is handling the message
+	done := make(chan error)
+	go func() { done <- DeliverDue(context.Background()) }()
+	<-started
+	if err := DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	message := loadMessage(t, "test.claim")
+	if message.Status != StatusPending || message.NextAttemptAt == nil || !message.NextAttemptAt.After(time.Now().Add(leaseDuration-time.Minute)) {
+		t.Errorf("claimed message: status %s, next attempt %v, want leased", message.Status, message.NextAttemptAt)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if message := loadMessage(t, "test.claim"); message.Status != StatusDelivered || message.Attempts != 1 {
+		t.Errorf("status %s, attempts %d, want delivered once", message.Status, message.Attempts)
+	}
+
+	// A stale copy of a claimed message cannot be claimed again
+	now := time.Now()
+	pending := Message{Topic: "test.claim", Subscriber: "test", Payload: "{}", Status: StatusPending, NextAttemptAt: &now, CreatedAt: now, UpdatedAt: now}
+	if err := db.Get().Create(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	stale := pending
+	if claimed, err := claim(&pending); err != nil || !claimed {
+		t.Fatalf("first claim: %t, %v", claimed, err)
+	}
+	if claimed, err := claim(&stale); err != nil || claimed {
+		t.Errorf("second claim: %t, %v, want not claimed", claimed, err)
+	}
+}
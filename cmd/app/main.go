@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"gothstack/app"
+	"gothstack/plugins/calendar"
 	"gothstack/public"
 	"log"
 	"net/http"
@@ -15,6 +16,9 @@ import (
 
 func main() {
 	kit.Setup()
+	if err := calendar.SetupEntrySearch(); err != nil {
+		log.Fatal(err)
+	}
 	router := chi.NewMux()
 
 	app.InitializeMiddleware(router)
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gothstack/pkg/calendarapi"
+)
+
+// runLog logs an entry: log <hours> <text> [--resource name] [--date day]
+func runLog(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	calendarName := fs.String("calendar", "", "name or ID of the calendar")
+	resourceName := fs.String("resource", "", "name or path of the task")
+	dayName := fs.String("date", "today", "day of the entry")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		return errors.New("usage: calctl log <hours> <text> [--resource name] [--date day]")
+	}
+	hours, err := parseHours(positional[0])
+	if err != nil {
+		return err
+	}
+	day, err := parseDay(*dayName)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	calendar, err := findCalendar(ctx, c, *calendarName)
+	if err != nil {
+		return err
+	}
+	input := calendarapi.EntryInput{
+		Date:  day.Format("2006-01-02"),
+		Hours: hours,
+		Text:  strings.Join(positional[1:], " "),
+	}
+	path := ""
+	if *resourceName != "" {
+		task, err := findTask(ctx, c, calendar.ID, *resourceName)
+		if err != nil {
+			return err
+		}
+		input.WorkResourceID = task.ID
+		path = " on " + task.Path
+	}
+	entry, err := c.CreateEntry(ctx, calendar.ID, input)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Logged %.2fh%s to %s on %s\n", entry.Hours, path, calendar.Name, day.Format("Mon 2 Jan 2006"))
+	return nil
+}
+
+// listEntries returns every entry of a calendar between two days
+func listEntries(ctx context.Context, c *calendarapi.Client, calendarID uint, from, to time.Time) ([]calendarapi.Entry, error) {
+	var entries []calendarapi.Entry
+	for {
+		filter := calendarapi.EntryFilter{
+			Page: calendarapi.Page{Limit: 200, Offset: len(entries)},
+			From: from, To: to, Sort: "date_asc",
+		}
+		page, err := c.ListEntries(ctx, calendarID, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Data...)
+		if len(page.Data) == 0 || int64(len(entries)) >= page.Pagination.Total {
+			return entries, nil
+		}
+	}
+}
+
+// runWeek shows the entries of the week of a day with the daily hours and targets
+func runWeek(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("week", flag.ContinueOnError)
+	calendarName := fs.String("calendar", "", "name or ID of the calendar")
+	dayName := fs.String("date", "today", "a day of the week")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	day, err := parseDay(*dayName)
+	if err != nil {
+		return err
+	}
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	sunday := monday.AddDate(0, 0, 6)
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	calendar, err := findCalendar(ctx, c, *calendarName)
+	if err != nil {
+		return err
+	}
+	entries, err := listEntries(ctx, c, calendar.ID, monday, sunday)
+	if err != nil {
+		return err
+	}
+	resources, err := listWorkResources(ctx, c, calendar.ID)
+	if err != nil {
+		return err
+	}
+	paths := make(map[uint]string)
+	for _, resource := range resources {
+		paths[resource.ID] = resource.Path
+	}
+	// the week may span two months, holidays come with the month statistics
+	holidays := make(map[string]string)
+	for _, month := range []time.Time{monday, sunday} {
+		stats, err := c.GetMonthStats(ctx, calendar.ID, month.Year(), int(month.Month()))
+		if err != nil {
+			return err
+		}
+		for _, holiday := range stats.Holidays {
+			holidays[holiday.Date] = holiday.Name
+		}
+	}
+
+	_, week := monday.ISOWeek()
+	fmt.Printf("%s, week %d: %s – %s\n\n", calendar.Name, week, monday.Format("2 Jan"), sunday.Format("2 Jan 2006"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var total, target float64
+	for d := monday; !d.After(sunday); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		var logged float64
+		for _, entry := range entries {
+			if entry.Date == date {
+				logged += entry.Hours
+			}
+		}
+		dayTarget := 0.0
+		if calendar.Work && d.Weekday() != time.Saturday && d.Weekday() != time.Sunday && holidays[date] == "" {
+			dayTarget = calendar.DailyWorkHours
+		}
+		total += logged
+		target += dayTarget
+
+		line := fmt.Sprintf("%s\t%.2f", d.Format("Mon 2 Jan"), logged)
+		if calendar.Work {
+			line += fmt.Sprintf(" / %.2f", dayTarget)
+		}
+		if name := holidays[date]; name != "" {
+			line += "\t" + name
+		}
+		fmt.Fprintln(w, line)
+		for _, entry := range entries {
+			if entry.Date != date {
+				continue
+			}
+			text := entry.Text
+			if path := paths[entry.WorkResourceID]; path != "" {
+				text = path + ": " + text
+			}
+			fmt.Fprintf(w, "\t  %.2f\t%s\n", entry.Hours, text)
+		}
+	}
+	if calendar.Work {
+		fmt.Fprintf(w, "Total\t%.2f / %.2f\n", total, target)
+	} else {
+		fmt.Fprintf(w, "Total\t%.2f\n", total)
+	}
+	return w.Flush()
+}
+
+// runMonth shows the work statistics of a month: month [YYYY-MM]
+func runMonth(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("month", flag.ContinueOnError)
+	calendarName := fs.String("calendar", "", "name or ID of the calendar")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	month := time.Now()
+	if len(positional) > 0 {
+		month, err = time.Parse("2006-01", positional[0])
+		if err != nil {
+			return fmt.Errorf("invalid month %q, use YYYY-MM", positional[0])
+		}
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	calendar, err := findCalendar(ctx, c, *calendarName)
+	if err != nil {
+		return err
+	}
+	stats, err := c.GetMonthStats(ctx, calendar.ID, month.Year(), int(month.Month()))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s, %s\n\n", calendar.Name, month.Format("January 2006"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Working days\t%d\n", stats.WorkingDays)
+	fmt.Fprintf(w, "Logged\t%.2f / %.2f h\t%.0f%%\n", stats.LoggedHours, stats.TotalWorkHours, stats.Progress)
+	for _, holiday := range stats.Holidays {
+		fmt.Fprintf(w, "Holiday\t%s\t%s\n", holiday.Date, holiday.Name)
+	}
+	if len(stats.Resources) > 0 {
+		fmt.Fprintln(w)
+		for _, resource := range stats.Resources {
+			fmt.Fprintf(w, "%s\t%.2f / %.2f h\t%.0f%%\n", resource.Path, resource.LoggedHours, resource.TargetHours, resource.Progress)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,207 @@
+// Command calctl logs time and shows the progress of a calendar through the JSON API.
+//
+// The server and a personal access token, created on the profile page, are read from the
+// CALCTL_SERVER and CALCTL_TOKEN environment variables. CALCTL_CALENDAR sets the calendar
+// used when --calendar is not given.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gothstack/pkg/calendarapi"
+)
+
+const usage = `Usage: calctl <command> [arguments]
+
+Commands:
+  log <hours> <text> [--resource name] [--date day]   log an entry, hours as 7.5 or 1h30m
+  week [--date day]                                   show the entries and hours of a week
+  month [YYYY-MM]                                     show the work statistics of a month
+  timer start [text] [--resource name]                start a timer
+  timer stop [text]                                   stop the timer and log its time
+  timer status                                        show the running timer
+  timer cancel                                        discard the running timer
+
+Every command takes --calendar with the name or ID of a calendar.
+A day is today, yesterday, tomorrow or YYYY-MM-DD.
+
+Environment:
+  CALCTL_SERVER    URL of the server, http://localhost:3000 by default
+  CALCTL_TOKEN     personal access token
+  CALCTL_CALENDAR  default calendar
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		fmt.Print(usage)
+		return
+	}
+	commands := map[string]func(context.Context, []string) error{
+		"log":   runLog,
+		"week":  runWeek,
+		"month": runMonth,
+		"timer": runTimer,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "calctl: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := command(context.Background(), os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "calctl:", err)
+		os.Exit(1)
+	}
+}
+
+// newClient returns an API client configured from the environment
+func newClient() (*calendarapi.Client, error) {
+	server := os.Getenv("CALCTL_SERVER")
+	if server == "" {
+		server = "http://localhost:3000"
+	}
+	token := os.Getenv("CALCTL_TOKEN")
+	if token == "" {
+		return nil, errors.New("CALCTL_TOKEN is not set, create a token on your profile page")
+	}
+	return calendarapi.New(server, token, calendarapi.WithHTTPClient(&http.Client{Timeout: 30 * time.Second})), nil
+}
+
+// parseArgs parses flags given before, between or after the positional arguments,
+// which the flag package alone stops at, and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseDay parses a day given on the command line
+func parseDay(s string) (time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch strings.ToLower(s) {
+	case "", "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid day %q, use today, yesterday, tomorrow or YYYY-MM-DD", s)
+	}
+	return day, nil
+}
+
+// parseHours parses hours given as a decimal number or a duration such as 1h30m
+func parseHours(s string) (float64, error) {
+	if hours, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64); err == nil && hours > 0 {
+		return hours, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d.Hours(), nil
+	}
+	return 0, fmt.Errorf("invalid hours %q, use e.g. 7.5 or 1h30m", s)
+}
+
+// findCalendar returns the calendar with the given name or ID. Without a name the
+// CALCTL_CALENDAR calendar is used, or the only calendar, or the first work calendar.
+func findCalendar(ctx context.Context, c *calendarapi.Client, name string) (calendarapi.Calendar, error) {
+	if name == "" {
+		name = os.Getenv("CALCTL_CALENDAR")
+	}
+	calendars, err := c.ListCalendars(ctx, calendarapi.Page{Limit: 200})
+	if err != nil {
+		return calendarapi.Calendar{}, err
+	}
+	if len(calendars.Data) == 0 {
+		return calendarapi.Calendar{}, errors.New("you have no calendars")
+	}
+	if name == "" {
+		if len(calendars.Data) == 1 {
+			return calendars.Data[0], nil
+		}
+		for _, calendar := range calendars.Data {
+			if calendar.Work {
+				return calendar, nil
+			}
+		}
+		return calendarapi.Calendar{}, errors.New("you have several calendars, choose one with --calendar")
+	}
+	for _, calendar := range calendars.Data {
+		if strings.EqualFold(calendar.Name, name) || strconv.FormatUint(uint64(calendar.ID), 10) == name {
+			return calendar, nil
+		}
+	}
+	return calendarapi.Calendar{}, fmt.Errorf("no calendar %q", name)
+}
+
+// listWorkResources returns every work resource of a calendar
+func listWorkResources(ctx context.Context, c *calendarapi.Client, calendarID uint) ([]calendarapi.WorkResource, error) {
+	var resources []calendarapi.WorkResource
+	for {
+		page, err := c.ListWorkResources(ctx, calendarID, calendarapi.Page{Limit: 200, Offset: len(resources)})
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, page.Data...)
+		if len(page.Data) == 0 || int64(len(resources)) >= page.Pagination.Total {
+			return resources, nil
+		}
+	}
+}
+
+// findTask returns the task of a calendar with the given name or path, e.g. "backend" or
+// "Acme / Website / Backend". A unique part of a path is enough.
+func findTask(ctx context.Context, c *calendarapi.Client, calendarID uint, name string) (calendarapi.WorkResource, error) {
+	resources, err := listWorkResources(ctx, c, calendarID)
+	if err != nil {
+		return calendarapi.WorkResource{}, err
+	}
+	var exact, partial []calendarapi.WorkResource
+	for _, resource := range resources {
+		if resource.Kind != "task" {
+			continue
+		}
+		if strings.EqualFold(resource.Name, name) || strings.EqualFold(resource.Path, name) {
+			exact = append(exact, resource)
+		} else if strings.Contains(strings.ToLower(resource.Path), strings.ToLower(name)) {
+			partial = append(partial, resource)
+		}
+	}
+	matches := exact
+	if len(matches) == 0 {
+		matches = partial
+	}
+	switch len(matches) {
+	case 0:
+		return calendarapi.WorkResource{}, fmt.Errorf("no task %q in this calendar", name)
+	case 1:
+		return matches[0], nil
+	}
+	var paths []string
+	for _, resource := range matches {
+		paths = append(paths, resource.Path)
+	}
+	return calendarapi.WorkResource{}, fmt.Errorf("task %q is ambiguous: %s", name, strings.Join(paths, ", "))
+}
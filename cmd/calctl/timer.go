@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gothstack/pkg/calendarapi"
+)
+
+// timer is a running timer. It is kept in a file on the local machine, the server only
+// sees the entry logged when the timer is stopped.
+type timer struct {
+	CalendarID   uint      `json:"calendar_id"`
+	CalendarName string    `json:"calendar_name"`
+	ResourceID   uint      `json:"resource_id"`
+	ResourcePath string    `json:"resource_path"`
+	Text         string    `json:"text"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// timerPath returns the path of the timer file in the user configuration directory
+func timerPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "calctl", "timer.json"), nil
+}
+
+// loadTimer returns the running timer, nil when there is none
+func loadTimer() (*timer, error) {
+	path, err := timerPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t timer
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("invalid timer file %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// saveTimer writes the running timer, nil removes it
+func saveTimer(t *timer) error {
+	path, err := timerPath()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// describe returns a one line description of the timer
+func (t *timer) describe() string {
+	description := t.CalendarName
+	if t.ResourcePath != "" {
+		description += ", " + t.ResourcePath
+	}
+	if t.Text != "" {
+		description += ": " + t.Text
+	}
+	return description
+}
+
+// runTimer runs the timer subcommands: start, stop, status and cancel
+func runTimer(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: calctl timer start|stop|status|cancel")
+	}
+	switch args[0] {
+	case "start":
+		return runTimerStart(ctx, args[1:])
+	case "stop":
+		return runTimerStop(ctx, args[1:])
+	case "status", "cancel":
+		t, err := loadTimer()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return errors.New("no timer is running")
+		}
+		if args[0] == "cancel" {
+			fmt.Printf("Discarded the timer of %s\n", t.describe())
+			return saveTimer(nil)
+		}
+		elapsed := time.Since(t.StartedAt).Round(time.Minute)
+		fmt.Printf("Running for %s since %s: %s\n", elapsed, t.StartedAt.Format("15:04"), t.describe())
+		return nil
+	}
+	return fmt.Errorf("unknown timer command %q, use start, stop, status or cancel", args[0])
+}
+
+// runTimerStart starts a timer: timer start [text] [--resource name]
+func runTimerStart(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("timer start", flag.ContinueOnError)
+	calendarName := fs.String("calendar", "", "name or ID of the calendar")
+	resourceName := fs.String("resource", "", "name or path of the task")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	running, err := loadTimer()
+	if err != nil {
+		return err
+	}
+	if running != nil {
+		return fmt.Errorf("a timer is already running since %s: %s", running.StartedAt.Format("15:04"), running.describe())
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	calendar, err := findCalendar(ctx, c, *calendarName)
+	if err != nil {
+		return err
+	}
+	t := &timer{
+		CalendarID:   calendar.ID,
+		CalendarName: calendar.Name,
+		Text:         strings.Join(positional, " "),
+		StartedAt:    time.Now().Truncate(time.Minute),
+	}
+	if *resourceName != "" {
+		task, err := findTask(ctx, c, calendar.ID, *resourceName)
+		if err != nil {
+			return err
+		}
+		t.ResourceID = task.ID
+		t.ResourcePath = task.Path
+	}
+	if err := saveTimer(t); err != nil {
+		return err
+	}
+	fmt.Printf("Started a timer at %s: %s\n", t.StartedAt.Format("15:04"), t.describe())
+	return nil
+}
+
+// runTimerStop stops the timer and logs an entry with its start and end time: timer stop [text]
+func runTimerStop(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("timer stop", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	t, err := loadTimer()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.New("no timer is running")
+	}
+	text := t.Text
+	if len(positional) > 0 {
+		text = strings.Join(positional, " ")
+	}
+	if text == "" {
+		return errors.New("the timer has no text, give it with calctl timer stop <text>")
+	}
+	stoppedAt := time.Now().Truncate(time.Minute)
+	elapsed := stoppedAt.Sub(t.StartedAt)
+	if elapsed < time.Minute {
+		return errors.New("the timer ran for less than a minute, use calctl timer cancel to discard it")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	input := calendarapi.EntryInput{
+		Date:           t.StartedAt.Format("2006-01-02"),
+		Hours:          math.Round(elapsed.Hours()*100) / 100,
+		Text:           text,
+		WorkResourceID: t.ResourceID,
+	}
+	// entry times are within one day, a timer running past midnight logs only the hours
+	if stoppedAt.Format("2006-01-02") == input.Date {
+		input.StartTime = t.StartedAt.Format("15:04")
+		input.EndTime = stoppedAt.Format("15:04")
+	}
+	entry, err := c.CreateEntry(ctx, t.CalendarID, input)
+	if err != nil {
+		return err
+	}
+	if err := saveTimer(nil); err != nil {
+		return err
+	}
+	t.Text = text
+	fmt.Printf("Logged %.2fh (%s) to %s\n", entry.Hours, elapsed, t.describe())
+	return nil
+}
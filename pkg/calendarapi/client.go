@@ -0,0 +1,231 @@
+// Package calendarapi is a client of the calendar JSON API served at /api/v1, as described by
+// the OpenAPI document at /api/openapi.json. The method names are the operation IDs of the document.
+// The types are written by hand, a test checks them against the component schemas of the document.
+package calendarapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client calls the API of one server with a personal access token
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, http.DefaultClient by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. "https://calendar.example.com",
+// authenticating with a personal access token created on the profile page
+func New(baseURL, token string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/api/v1",
+		token:      token,
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// do sends a request and decodes the JSON response into out, which may be nil.
+// Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errorBody struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errorBody); err != nil || errorBody.Error == nil {
+			return &Error{StatusCode: resp.StatusCode, Code: "http_error", Message: resp.Status}
+		}
+		errorBody.Error.StatusCode = resp.StatusCode
+		return errorBody.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is a 404 response of the API
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// values returns the query parameters of a page
+func (p Page) values() url.Values {
+	query := url.Values{}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		query.Set("offset", strconv.Itoa(p.Offset))
+	}
+	return query
+}
+
+// values returns the query parameters of an entry filter
+func (f EntryFilter) values() url.Values {
+	query := f.Page.values()
+	if !f.From.IsZero() {
+		query.Set("from", f.From.Format("2006-01-02"))
+	}
+	if !f.To.IsZero() {
+		query.Set("to", f.To.Format("2006-01-02"))
+	}
+	if f.WorkResourceID != 0 {
+		query.Set("work_resource_id", strconv.FormatUint(uint64(f.WorkResourceID), 10))
+	}
+	if f.Query != "" {
+		query.Set("q", f.Query)
+	}
+	if f.Sort != "" {
+		query.Set("sort", f.Sort)
+	}
+	return query
+}
+
+// ListCalendars lists the calendars of the user
+func (c *Client) ListCalendars(ctx context.Context, page Page) (List[Calendar], error) {
+	var list List[Calendar]
+	err := c.do(ctx, http.MethodGet, "/calendars", page.values(), nil, &list)
+	return list, err
+}
+
+// CreateCalendar creates a calendar
+func (c *Client) CreateCalendar(ctx context.Context, input CalendarInput) (Calendar, error) {
+	var calendar Calendar
+	err := c.do(ctx, http.MethodPost, "/calendars", nil, input, &calendar)
+	return calendar, err
+}
+
+// GetCalendar gets a calendar
+func (c *Client) GetCalendar(ctx context.Context, calendarID uint) (Calendar, error) {
+	var calendar Calendar
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d", calendarID), nil, nil, &calendar)
+	return calendar, err
+}
+
+// GetMonthStats gets the work statistics of a month
+func (c *Client) GetMonthStats(ctx context.Context, calendarID uint, year, month int) (MonthStats, error) {
+	var stats MonthStats
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d/stats/%d/%d", calendarID, year, month), nil, nil, &stats)
+	return stats, err
+}
+
+// ListEntries lists the entries of a calendar
+func (c *Client) ListEntries(ctx context.Context, calendarID uint, filter EntryFilter) (List[Entry], error) {
+	var list List[Entry]
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d/entries", calendarID), filter.values(), nil, &list)
+	return list, err
+}
+
+// CreateEntry creates an entry
+func (c *Client) CreateEntry(ctx context.Context, calendarID uint, input EntryInput) (Entry, error) {
+	var entry Entry
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/calendars/%d/entries", calendarID), nil, input, &entry)
+	return entry, err
+}
+
+// GetEntry gets an entry
+func (c *Client) GetEntry(ctx context.Context, calendarID, entryID uint) (Entry, error) {
+	var entry Entry
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d/entries/%d", calendarID, entryID), nil, nil, &entry)
+	return entry, err
+}
+
+// UpdateEntry replaces an entry
+func (c *Client) UpdateEntry(ctx context.Context, calendarID, entryID uint, input EntryInput) (Entry, error) {
+	var entry Entry
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/calendars/%d/entries/%d", calendarID, entryID), nil, input, &entry)
+	return entry, err
+}
+
+// DeleteEntry deletes an entry
+func (c *Client) DeleteEntry(ctx context.Context, calendarID, entryID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/calendars/%d/entries/%d", calendarID, entryID), nil, nil, nil)
+}
+
+// ListWorkResources lists the work resources of a calendar in tree order
+func (c *Client) ListWorkResources(ctx context.Context, calendarID uint, page Page) (List[WorkResource], error) {
+	var list List[WorkResource]
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d/resources", calendarID), page.values(), nil, &list)
+	return list, err
+}
+
+// CreateWorkResource creates a work resource
+func (c *Client) CreateWorkResource(ctx context.Context, calendarID uint, input WorkResourceInput) (WorkResource, error) {
+	var resource WorkResource
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/calendars/%d/resources", calendarID), nil, input, &resource)
+	return resource, err
+}
+
+// GetWorkResource gets a work resource
+func (c *Client) GetWorkResource(ctx context.Context, calendarID, resourceID uint) (WorkResource, error) {
+	var resource WorkResource
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/calendars/%d/resources/%d", calendarID, resourceID), nil, nil, &resource)
+	return resource, err
+}
+
+// UpdateWorkResource replaces a work resource
+func (c *Client) UpdateWorkResource(ctx context.Context, calendarID, resourceID uint, input WorkResourceInput) (WorkResource, error) {
+	var resource WorkResource
+	err := c.do(ctx, http.MethodPut, fmt.Sprintf("/calendars/%d/resources/%d", calendarID, resourceID), nil, input, &resource)
+	return resource, err
+}
+
+// DeleteWorkResource deletes a work resource, its sub-resources become top level resources
+func (c *Client) DeleteWorkResource(ctx context.Context, calendarID, resourceID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/calendars/%d/resources/%d", calendarID, resourceID), nil, nil, nil)
+}
@@ -0,0 +1,153 @@
+package calendarapi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar is a calendar of the user
+type Calendar struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Work           bool      `json:"work"`
+	DailyWorkHours float64   `json:"daily_work_hours"`
+	SharedWorkday  bool      `json:"shared_workday"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CalendarInput is the body for creating a calendar
+type CalendarInput struct {
+	Name           string  `json:"name"`
+	Work           bool    `json:"work"`
+	DailyWorkHours float64 `json:"daily_work_hours"`
+	SharedWorkday  bool    `json:"shared_workday"`
+}
+
+// Entry is a calendar entry. A zero WorkResourceID means no resource and empty
+// times an entry without a time of day.
+type Entry struct {
+	ID             uint      `json:"id"`
+	CalendarID     uint      `json:"calendar_id"`
+	Date           string    `json:"date"` // "2006-01-02"
+	Hours          float64   `json:"hours"`
+	Text           string    `json:"text"`
+	WorkResourceID uint      `json:"work_resource_id"`
+	StartTime      string    `json:"start_time"` // "15:04"
+	EndTime        string    `json:"end_time"`
+	Tags           []string  `json:"tags"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// EntryInput is the body for creating and replacing an entry. Tags are added to the
+// #tags written in the text.
+type EntryInput struct {
+	Date           string   `json:"date"`
+	Hours          float64  `json:"hours"`
+	Text           string   `json:"text"`
+	WorkResourceID uint     `json:"work_resource_id"`
+	StartTime      string   `json:"start_time"`
+	EndTime        string   `json:"end_time"`
+	Tags           []string `json:"tags"`
+}
+
+// WorkResource is a client, project or task of a calendar. Shared resources belong to
+// the user and are attached to the calendar.
+type WorkResource struct {
+	ID                  uint      `json:"id"`
+	ParentID            uint      `json:"parent_id"`
+	Kind                string    `json:"kind"`
+	Name                string    `json:"name"`
+	Path                string    `json:"path"`
+	ResourcesPercentage int       `json:"resources_percentage"`
+	Shared              bool      `json:"shared"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// WorkResourceInput is the body for creating and replacing a work resource
+type WorkResourceInput struct {
+	Name                string `json:"name"`
+	Kind                string `json:"kind"` // client, project or task
+	ParentID            uint   `json:"parent_id"`
+	ResourcesPercentage int    `json:"resources_percentage"`
+}
+
+// MonthStats is the work statistics of a calendar month
+type MonthStats struct {
+	Year           int                  `json:"year"`
+	Month          int                  `json:"month"`
+	WorkingDays    int                  `json:"working_days"`
+	TotalWorkHours float64              `json:"total_work_hours"`
+	LoggedHours    float64              `json:"logged_hours"`
+	Progress       float64              `json:"progress"`
+	Holidays       []Holiday            `json:"holidays"`
+	Resources      []ResourceMonthStats `json:"resources"`
+}
+
+// Holiday is a public holiday on a weekday of the month
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// ResourceMonthStats is the statistics of one resource, rolled up to projects and clients
+type ResourceMonthStats struct {
+	ResourceID  uint    `json:"resource_id"`
+	Kind        string  `json:"kind"`
+	Path        string  `json:"path"`
+	Percentage  int     `json:"percentage"`
+	TargetHours float64 `json:"target_hours"`
+	LoggedHours float64 `json:"logged_hours"`
+	Progress    float64 `json:"progress"`
+}
+
+// List is one page of a list response
+type List[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Pagination describes the page of a list response
+type Pagination struct {
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+	Total  int64 `json:"total"`
+}
+
+// Page selects a page of a list, zero values select the server defaults
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// EntryFilter narrows the entries listed, zero values mean no filtering
+type EntryFilter struct {
+	Page
+	From           time.Time
+	To             time.Time
+	WorkResourceID uint
+	Query          string
+	Sort           string // date_desc, date_asc, hours_desc or hours_asc
+}
+
+// Error is an error response of the API. Fields holds validation errors keyed by JSON field name.
+type Error struct {
+	StatusCode int                 `json:"-"`
+	Code       string              `json:"code"`
+	Message    string              `json:"message"`
+	Fields     map[string][]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("calendar API: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+	}
+	var fields []string
+	for name, messages := range e.Fields {
+		fields = append(fields, name+": "+strings.Join(messages, ", "))
+	}
+	return fmt.Sprintf("calendar API: %s (%d %s): %s", e.Message, e.StatusCode, e.Code, strings.Join(fields, "; "))
+}
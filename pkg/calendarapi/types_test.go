@@ -0,0 +1,149 @@
+package calendarapi_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gothstack/pkg/calendarapi"
+	"gothstack/plugins/calendar"
+)
+
+// errorBody mirrors the error response the client decodes
+type errorBody struct {
+	Error *calendarapi.Error `json:"error"`
+}
+
+// clientTypes are the client types of the component schemas of the OpenAPI document
+var clientTypes = map[string]reflect.Type{
+	"Calendar":           reflect.TypeOf(calendarapi.Calendar{}),
+	"CalendarInput":      reflect.TypeOf(calendarapi.CalendarInput{}),
+	"CalendarList":       reflect.TypeOf(calendarapi.List[calendarapi.Calendar]{}),
+	"Entry":              reflect.TypeOf(calendarapi.Entry{}),
+	"EntryInput":         reflect.TypeOf(calendarapi.EntryInput{}),
+	"EntryList":          reflect.TypeOf(calendarapi.List[calendarapi.Entry]{}),
+	"Error":              reflect.TypeOf(calendarapi.Error{}),
+	"ErrorBody":          reflect.TypeOf(errorBody{}),
+	"Holiday":            reflect.TypeOf(calendarapi.Holiday{}),
+	"MonthStats":         reflect.TypeOf(calendarapi.MonthStats{}),
+	"Pagination":         reflect.TypeOf(calendarapi.Pagination{}),
+	"ResourceMonthStats": reflect.TypeOf(calendarapi.ResourceMonthStats{}),
+	"WorkResource":       reflect.TypeOf(calendarapi.WorkResource{}),
+	"WorkResourceInput":  reflect.TypeOf(calendarapi.WorkResourceInput{}),
+	"WorkResourceList":   reflect.TypeOf(calendarapi.List[calendarapi.WorkResource]{}),
+}
+
+// componentName returns the component name the OpenAPI document uses for a client type
+func componentName(t reflect.Type) string {
+	if t == reflect.TypeOf(errorBody{}) {
+		return "ErrorBody"
+	}
+	name := t.Name()
+	if i := strings.Index(name, "["); i >= 0 {
+		element := name[i+1 : len(name)-1]
+		return element[strings.LastIndex(element, ".")+1:] + name[:i]
+	}
+	return name
+}
+
+// schemaKind describes a property schema of the OpenAPI document, e.g. "array of $Entry"
+func schemaKind(schema map[string]any) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return "$" + ref[strings.LastIndex(ref, "/")+1:]
+	}
+	switch kind, _ := schema["type"].(string); kind {
+	case "array":
+		return "array of " + schemaKind(schema["items"].(map[string]any))
+	case "object":
+		return "map of " + schemaKind(schema["additionalProperties"].(map[string]any))
+	case "string":
+		if format, ok := schema["format"].(string); ok {
+			return "string " + format
+		}
+		return kind
+	default:
+		return kind
+	}
+}
+
+// typeKind describes a field type of the client the way schemaKind describes the schema
+func typeKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "string date-time"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Slice:
+		return "array of " + typeKind(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map of " + typeKind(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return "$" + componentName(t)
+	}
+	return t.Kind().String()
+}
+
+// typeProperties returns the kinds of the JSON fields of a client type
+func typeProperties(t reflect.Type) map[string]string {
+	properties := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeKind(field.Type)
+	}
+	return properties
+}
+
+// TestTypesMatchOpenAPIDocument fails when the client types drift from the API types of the server
+func TestTypesMatchOpenAPIDocument(t *testing.T) {
+	schemas := calendar.OpenAPIDocument()["components"].(map[string]any)["schemas"].(map[string]any)
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		clientType, ok := clientTypes[name]
+		if !ok {
+			t.Errorf("schema %s has no client type", name)
+			continue
+		}
+		got := typeProperties(clientType)
+		for property, schema := range schemas[name].(map[string]any)["properties"].(map[string]any) {
+			want := schemaKind(schema.(map[string]any))
+			switch kind, ok := got[property]; {
+			case !ok:
+				t.Errorf("%s: field %q is missing from %s", name, property, clientType)
+			case kind != want:
+				t.Errorf("%s: field %q is %s in %s, want %s", name, property, kind, clientType, want)
+			}
+			delete(got, property)
+		}
+		for property := range got {
+			t.Errorf("%s: field %q of %s is not in the API", name, property, clientType)
+		}
+	}
+	for name := range clientTypes {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("client type of %s has no schema", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"strings"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"gorm.io/gorm"
+)
+
+// API token scopes. Read tokens can only make safe requests, write tokens can also change data.
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+)
+
+// apiTokenPrefix starts every personal access token, so that leaked tokens are easy to recognise
+const apiTokenPrefix = "gst_"
+
+// APIToken is a personal access token of a user. Only the SHA-256 hash of the token is stored,
+// the token itself is shown once when it is created.
+type APIToken struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null"`
+	Name        string `gorm:"not null"`
+	TokenHash   string `gorm:"not null"`
+	TokenPrefix string `gorm:"not null"` // start of the token, to tell tokens apart
+	Scope       string `gorm:"not null"`
+	LastUsedAt  sql.NullTime
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// Relationship field
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// hashAPIToken returns the stored hash of a token. Tokens are random, so a fast hash is enough.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a token for the user and returns it with the token itself
+func CreateAPIToken(userID uint, name, scope string) (APIToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return APIToken{}, "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(b)
+	apiToken := APIToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashAPIToken(token),
+		TokenPrefix: token[:len(apiTokenPrefix)+8],
+		Scope:       scope,
+	}
+	if err := db.Get().Create(&apiToken).Error; err != nil {
+		return apiToken, "", fmt.Errorf("failed to create API token: %w", err)
+	}
+	return apiToken, token, nil
+}
+
+// ListAPITokens returns the tokens of the user, newest first
+func ListAPITokens(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	result := db.Get().Where("user_id = ?", userID).Order("created_at desc").Find(&tokens)
+	return tokens, result.Error
+}
+
+// RevokeAPIToken deletes a token of the user
+func RevokeAPIToken(id, userID uint) error {
+	result := db.Get().Where("id = ? AND user_id = ?", id, userID).Delete(&APIToken{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API token: %w", result.Error)
+	}
+	return nil
+}
+
+// findAPIToken returns the token and its user, and records that the token was used
+func findAPIToken(token string) (APIToken, error) {
+	var apiToken APIToken
+	err := db.Get().Preload("User").Where("token_hash = ?", hashAPIToken(token)).First(&apiToken).Error
+	if err != nil {
+		return apiToken, err
+	}
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	if err := db.Get().Model(&apiToken).UpdateColumn("last_used_at", now).Error; err != nil {
+		return apiToken, err
+	}
+	apiToken.LastUsedAt = now
+	return apiToken, nil
+}
+
+// WithBearerToken returns an AuthFunc for API routes that authenticates requests with an
+// "Authorization: Bearer" header by a personal access token, and other requests with next.
+// Requests with an unknown token are not logged in, they never fall back to the session.
+func WithBearerToken(next func(*kit.Kit) (kit.Auth, error)) func(*kit.Kit) (kit.Auth, error) {
+	return func(kit *kit.Kit) (kit.Auth, error) {
+		header := kit.Request.Header.Get("Authorization")
+		if header == "" {
+			return next(kit)
+		}
+		scheme, token, _ := strings.Cut(header, " ")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(token, apiTokenPrefix) {
+			return Auth{}, nil
+		}
+		apiToken, err := findAPIToken(token)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && apiToken.User.ID == 0) {
+			return Auth{}, nil
+		}
+		if err != nil {
+			return Auth{}, err
+		}
+		return Auth{
+			LoggedIn: true,
+			UserID:   apiToken.User.ID,
+			Email:    apiToken.User.Email,
+			Scope:    apiToken.Scope,
+		}, nil
+	}
+}
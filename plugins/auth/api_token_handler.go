@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+var apiTokenSchema = v.Schema{
+	"name": v.Rules(v.Min(1), v.Max(100)),
+}
+
+// APITokenFormValues holds form data for creating a personal access token
+type APITokenFormValues struct {
+	Name  string `form:"name"`
+	Scope string `form:"scope"`
+}
+
+// APITokensData holds data for the personal access token section of the profile page
+type APITokensData struct {
+	Tokens     []APIToken
+	FormValues APITokenFormValues
+	FormErrors v.Errors
+	NewToken   string // the token just created, shown only once
+	SwapOOB    bool   // rendered next to another response, replacing the section out of band
+}
+
+// loadAPITokensData loads the tokens of the user
+func loadAPITokensData(userID uint) (APITokensData, error) {
+	tokens, err := ListAPITokens(userID)
+	if err != nil {
+		return APITokensData{}, err
+	}
+	return APITokensData{
+		Tokens:     tokens,
+		FormValues: APITokenFormValues{Scope: APITokenScopeRead},
+		FormErrors: v.Errors{},
+	}, nil
+}
+
+// HandleAPITokenCreate creates a personal access token and shows it once
+func HandleAPITokenCreate(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	data, err := loadAPITokensData(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	var values APITokenFormValues
+	errors, ok := v.Request(kit.Request, &values, apiTokenSchema)
+	if values.Scope != APITokenScopeRead && values.Scope != APITokenScopeWrite {
+		errors.Add("scope", "Scope must be read or write")
+		ok = false
+	}
+	if !ok {
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(APITokens(data))
+	}
+
+	token, plain, err := CreateAPIToken(auth.UserID, values.Name, values.Scope)
+	if err != nil {
+		return err
+	}
+	data.Tokens = append([]APIToken{token}, data.Tokens...)
+	data.NewToken = plain
+	return kit.Render(APITokens(data))
+}
+
+// HandleAPITokenRevoke revokes a personal access token of the user
+func HandleAPITokenRevoke(kit *kit.Kit) error {
+	tokenID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid token ID: %w", err)
+	}
+	auth := kit.Auth().(Auth)
+	if err := RevokeAPIToken(uint(tokenID), auth.UserID); err != nil {
+		return err
+	}
+	data, err := loadAPITokensData(auth.UserID)
+	if err != nil {
+		return err
+	}
+	return kit.Render(APITokens(data))
+}
@@ -63,6 +63,27 @@ func HandleLoginCreate(kit *kit.Kit) error {
 		}
 	}
 
+	// Users with two-factor authentication only get a session after the second step
+	twoFactor, err := TwoFactorEnabled(user.ID)
+	if err != nil {
+		return err
+	}
+	if twoFactor {
+		token, err := CreateLoginChallenge(user.ID)
+		if err != nil {
+			return err
+		}
+		sess := kit.GetSession(userSessionName)
+		sess.Values["loginChallenge"] = token
+		sess.Save(kit.Request, kit.Response)
+		return kit.Redirect(http.StatusSeeOther, "/login/two-factor")
+	}
+
+	return createSession(kit, user)
+}
+
+// createSession signs the user in and redirects them to the page after login
+func createSession(kit *kit.Kit, user User) error {
 	sessionExpiryStr := kit.Getenv("SUPERKIT_AUTH_SESSION_EXPIRY_IN_HOURS", "48")
 	sessionExpiry, err := strconv.Atoi(sessionExpiryStr)
 	if err != nil {
@@ -78,6 +99,7 @@ func HandleLoginCreate(kit *kit.Kit) error {
 	}
 
 	sess := kit.GetSession(userSessionName)
+	delete(sess.Values, "loginChallenge")
 	sess.Values["sessionToken"] = session.Token
 	sess.Save(kit.Request, kit.Response)
 	redirectURL := kit.Getenv("SUPERKIT_AUTH_REDIRECT_AFTER_LOGIN", "/profile")
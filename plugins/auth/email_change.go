@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"gothstack/app/outbox"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidEmailChangeToken is returned for unknown, used and expired email change tokens
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+	// ErrEmailTaken is returned when the new address belongs to another user
+	ErrEmailTaken = errors.New("email address already in use")
+)
+
+// EmailChangeToken is a single-use token sent to the new address of a user changing their
+// email. The address is only swapped once the token comes back, proving the user reads it.
+// Like API tokens only the SHA-256 hash of the token is stored.
+type EmailChangeToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	NewEmail  string `gorm:"not null"`
+	TokenHash string `gorm:"not null"`
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// UserWithEmailChangeToken is sent over the auth.email.change.request event.
+// It holds the user, the address they want to use and the sealed token to mail to it.
+type UserWithEmailChangeToken struct {
+	User      EventUser
+	NewEmail  string
+	Token     SealedToken
+	ExpiresAt time.Time
+}
+
+// UserWithOldEmail is sent over the auth.email.change event. It holds the user with
+// their new address and the address they used before.
+type UserWithOldEmail struct {
+	User     EventUser
+	OldEmail string
+}
+
+// emailTaken reports whether another user, deleted ones included, has the address
+func emailTaken(tx *gorm.DB, userID uint, email string) (bool, error) {
+	var count int64
+	err := tx.Unscoped().Model(&User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// RequestEmailChange creates a token confirming the new address of a user who knows their
+// password and publishes the event mailing it to the new address. Earlier requests of the
+// user stop working.
+func RequestEmailChange(userID uint, currentPassword, newEmail string) error {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := checkPassword(user, currentPassword); err != nil {
+		return err
+	}
+	taken, err := emailTaken(db.Get(), user.ID, newEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("failed to generate email change token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	sealed, err := sealToken(token)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	changeToken := EmailChangeToken{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashAPIToken(token),
+		ExpiresAt: now.Add(emailVerificationExpiry()),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return outbox.Transaction(func(tx *gorm.DB) error {
+		if err := expireEmailChangeTokens(tx, user.ID, now); err != nil {
+			return err
+		}
+		if err := tx.Create(&changeToken).Error; err != nil {
+			return fmt.Errorf("failed to create email change token: %w", err)
+		}
+		return outbox.Publish(tx, EmailChangeRequestEvent, UserWithEmailChangeToken{
+			User:      newEventUser(user),
+			NewEmail:  newEmail,
+			Token:     sealed,
+			ExpiresAt: changeToken.ExpiresAt,
+		})
+	})
+}
+
+// expireEmailChangeTokens makes the unused email change tokens of a user expire at now
+func expireEmailChangeTokens(tx *gorm.DB, userID uint, now time.Time) error {
+	return tx.Model(&EmailChangeToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("expires_at", now).Error
+}
+
+// PendingEmailChange returns the address a user asked to change to and has not confirmed
+// yet, or an empty string
+func PendingEmailChange(userID uint) (string, error) {
+	var changeToken EmailChangeToken
+	err := db.Get().
+		Where("user_id = ? AND used_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("id desc").Limit(1).Find(&changeToken).Error
+	return changeToken.NewEmail, err
+}
+
+// ConfirmEmailChange swaps the address of a user for the one the token was mailed to and uses
+// up the token. Password reset links mailed to the old address stop working. It publishes
+// the event notifying the old address of the change.
+func ConfirmEmailChange(token string) (User, error) {
+	var user User
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		var changeToken EmailChangeToken
+		result := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashAPIToken(token), time.Now()).
+			Limit(1).Find(&changeToken)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidEmailChangeToken
+		}
+		now := time.Now()
+		// Only one request can use the token, a concurrent one finds it used
+		result = tx.Model(&EmailChangeToken{}).
+			Where("id = ? AND used_at IS NULL", changeToken.ID).
+			Updates(map[string]any{"used_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidEmailChangeToken
+		}
+
+		if err := tx.First(&user, changeToken.UserID).Error; err != nil {
+			return err
+		}
+		// The address may have been taken since the change was requested
+		taken, err := emailTaken(tx, user.ID, changeToken.NewEmail)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+		oldEmail := user.Email
+		user.Email = changeToken.NewEmail
+		user.EmailVerifiedAt = sql.NullTime{Time: now, Valid: true}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := expireEmailChangeTokens(tx, user.ID, now); err != nil {
+			return err
+		}
+		err = tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("expires_at", now).Error
+		if err != nil {
+			return err
+		}
+		return outbox.Publish(tx, EmailChangeEvent, UserWithOldEmail{User: newEventUser(user), OldEmail: oldEmail})
+	})
+	return user, err
+}
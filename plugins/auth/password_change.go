@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"gothstack/app/db"
+	"gothstack/app/outbox"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrWrongPassword is returned when the current password given to confirm a change is wrong
+var ErrWrongPassword = errors.New("wrong password")
+
+// checkPassword returns ErrWrongPassword unless password is the password of the user
+func checkPassword(user User, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of a user who knows the current one. It signs the
+// user out of every other session, keeping the one with sessionToken, revokes their API
+// tokens, and publishes the event notifying them of the change.
+func ChangePassword(userID uint, currentPassword, password, sessionToken string) (User, error) {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return user, err
+	}
+	if err := checkPassword(user, currentPassword); err != nil {
+		return user, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+	err = outbox.Transaction(func(tx *gorm.DB) error {
+		user.PasswordHash = string(hash)
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		err := tx.Where("user_id = ? AND token <> ?", user.ID, sessionToken).Delete(&Session{}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		return outbox.Publish(tx, PasswordChangeEvent, newEventUser(user))
+	})
+	return user, err
+}
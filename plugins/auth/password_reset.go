@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"gothstack/app/outbox"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPasswordResetToken is returned for unknown, used and expired reset tokens
+var ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetToken is a single-use token sent to a user who forgot their password.
+// Like API tokens only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	TokenHash string `gorm:"not null"`
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// UserWithPasswordResetToken is sent over the auth.password.reset.request event.
+// It holds the user and the sealed reset token to mail to them.
+type UserWithPasswordResetToken struct {
+	User      EventUser
+	Token     SealedToken
+	ExpiresAt time.Time
+}
+
+// passwordResetExpiry returns how long a reset token is valid
+func passwordResetExpiry() time.Duration {
+	minutes, err := strconv.Atoi(kit.Getenv("SUPERKIT_AUTH_PASSWORD_RESET_EXPIRY_IN_MINUTES", "60"))
+	if err != nil {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RequestPasswordReset creates a reset token for the user with the email address and publishes
+// the event mailing it. Earlier tokens of the user stop working. It returns false without an
+// error when no user has the address, which callers must not reveal.
+func RequestPasswordReset(email string) (bool, error) {
+	var user User
+	result := db.Get().Where("email = ?", email).Limit(1).Find(&user)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return false, fmt.Errorf("failed to generate password reset token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	sealed, err := sealToken(token)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	resetToken := PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashAPIToken(token),
+		ExpiresAt: now.Add(passwordResetExpiry()),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = outbox.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("expires_at", now).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&resetToken).Error; err != nil {
+			return fmt.Errorf("failed to create password reset token: %w", err)
+		}
+		return outbox.Publish(tx, PasswordResetRequestEvent, UserWithPasswordResetToken{
+			User:      newEventUser(user),
+			Token:     sealed,
+			ExpiresAt: resetToken.ExpiresAt,
+		})
+	})
+	return err == nil, err
+}
+
+// findPasswordResetToken returns the unused and unexpired reset token
+func findPasswordResetToken(tx *gorm.DB, token string) (PasswordResetToken, error) {
+	var resetToken PasswordResetToken
+	result := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashAPIToken(token), time.Now()).
+		Limit(1).Find(&resetToken)
+	if result.Error != nil {
+		return resetToken, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return resetToken, ErrInvalidPasswordResetToken
+	}
+	return resetToken, nil
+}
+
+// CheckPasswordResetToken reports whether a reset token can still be used
+func CheckPasswordResetToken(token string) error {
+	_, err := findPasswordResetToken(db.Get(), token)
+	return err
+}
+
+// ResetPassword sets a new password with a reset token and uses up the token. It signs the
+// user out everywhere by deleting their sessions and API tokens, marks their email address as
+// verified since they proved to read it, and publishes the event confirming the change.
+func ResetPassword(token, password string) (User, error) {
+	var user User
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+	err = outbox.Transaction(func(tx *gorm.DB) error {
+		resetToken, err := findPasswordResetToken(tx, token)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		// Only one request can use the token, a concurrent one finds it used
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Updates(map[string]any{"used_at": now, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidPasswordResetToken
+		}
+
+		if err := tx.First(&user, resetToken.UserID).Error; err != nil {
+			return err
+		}
+		user.PasswordHash = string(hash)
+		if !user.EmailVerifiedAt.Valid {
+			user.EmailVerifiedAt = sql.NullTime{Time: now, Valid: true}
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		return outbox.Publish(tx, PasswordResetEvent, newEventUser(user))
+	})
+	return user, err
+}
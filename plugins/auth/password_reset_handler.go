@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+)
+
+var forgotPasswordSchema = v.Schema{
+	"email": v.Rules(v.Email),
+}
+
+// passwordSchema checks new passwords with the signup rules
+var passwordSchema = v.Schema{
+	"password": signupSchema["password"],
+}
+
+func HandleForgotPasswordIndex(kit *kit.Kit) error {
+	return kit.Render(ForgotPasswordIndex(ForgotPasswordPageData{}))
+}
+
+// HandleForgotPasswordCreate mails a reset link to the address when it belongs to a user.
+// The answer is the same either way, so that the form does not reveal who has an account.
+func HandleForgotPasswordCreate(kit *kit.Kit) error {
+	var values ForgotPasswordFormValues
+	errors, ok := v.Request(kit.Request, &values, forgotPasswordSchema)
+	if !ok {
+		return kit.Render(ForgotPasswordForm(ForgotPasswordPageData{FormValues: values, FormErrors: errors}))
+	}
+	if _, err := RequestPasswordReset(values.Email); err != nil {
+		slog.Error("failed to request password reset", "err", err)
+		errors.Add("general", "An unexpected error occured, please try again.")
+		return kit.Render(ForgotPasswordForm(ForgotPasswordPageData{FormValues: values, FormErrors: errors}))
+	}
+	return kit.Render(ForgotPasswordForm(ForgotPasswordPageData{FormValues: values, Sent: true}))
+}
+
+func HandleResetPasswordIndex(kit *kit.Kit) error {
+	data := ResetPasswordPageData{Token: kit.Request.URL.Query().Get("token")}
+	if err := CheckPasswordResetToken(data.Token); err != nil {
+		data.Invalid = true
+	}
+	return kit.Render(ResetPasswordIndex(data))
+}
+
+// HandleResetPasswordCreate sets the new password chosen with a reset link
+func HandleResetPasswordCreate(kit *kit.Kit) error {
+	var values ResetPasswordFormValues
+	formErrors, ok := v.Request(kit.Request, &values, passwordSchema)
+	data := ResetPasswordPageData{Token: values.Token, FormErrors: formErrors}
+	if !ok {
+		return kit.Render(ResetPasswordForm(data))
+	}
+	if values.Password != values.PasswordConfirm {
+		data.FormErrors.Add("passwordConfirm", "passwords do not match")
+		return kit.Render(ResetPasswordForm(data))
+	}
+	if _, err := ResetPassword(values.Token, values.Password); err != nil {
+		if errors.Is(err, ErrInvalidPasswordResetToken) {
+			data.Invalid = true
+			return kit.Render(ResetPasswordForm(data))
+		}
+		return err
+	}
+	data.Done = true
+	return kit.Render(ResetPasswordForm(data))
+}
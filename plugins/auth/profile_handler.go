@@ -2,7 +2,10 @@ package auth
 
 import (
 	"gothstack/app/db"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 
 	"github.com/anthdm/superkit/kit"
 	v "github.com/anthdm/superkit/validate"
@@ -19,6 +22,35 @@ type ProfileFormValues struct {
 	LastName  string `form:"lastName"`
 	Email     string
 	Success   string
+
+	PendingEmail string // the new address waiting to be confirmed
+}
+
+// passwordChangeSchema checks the new password with the signup rules
+var passwordChangeSchema = v.Schema{
+	"currentPassword": v.Rules(v.Required),
+	"password":        signupSchema["password"],
+}
+
+var emailChangeSchema = v.Schema{
+	"currentPassword": v.Rules(v.Required),
+	"email":           signupSchema["email"],
+}
+
+// PasswordChangeFormValues holds form data for changing the password on the profile page
+type PasswordChangeFormValues struct {
+	CurrentPassword string `form:"currentPassword"`
+	Password        string `form:"password"`
+	PasswordConfirm string `form:"passwordConfirm"`
+	Success         string
+}
+
+// EmailChangeFormValues holds form data for changing the email address on the profile page
+type EmailChangeFormValues struct {
+	CurrentPassword string `form:"currentPassword"`
+	Email           string `form:"email"`
+	PendingEmail    string
+	Success         string
 }
 
 func HandleProfileShow(kit *kit.Kit) error {
@@ -29,14 +61,30 @@ func HandleProfileShow(kit *kit.Kit) error {
 		return err
 	}
 
+	pendingEmail, err := PendingEmailChange(user.ID)
+	if err != nil {
+		return err
+	}
+
 	formValues := ProfileFormValues{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Email:     user.Email,
+		ID:           user.ID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		PendingEmail: pendingEmail,
 	}
 
-	return kit.Render(ProfileShow(formValues))
+	tokens, err := loadAPITokensData(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	twoFactor, err := loadTwoFactorData(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	return kit.Render(ProfileShow(formValues, tokens, twoFactor))
 }
 
 func HandleProfileUpdate(kit *kit.Kit) error {
@@ -65,3 +113,89 @@ func HandleProfileUpdate(kit *kit.Kit) error {
 
 	return kit.Render(ProfileForm(values, v.Errors{}))
 }
+
+// HandlePasswordChange sets a new password for the user, who confirms it with the current one
+func HandlePasswordChange(kit *kit.Kit) error {
+	var values PasswordChangeFormValues
+	formErrors, ok := v.Request(kit.Request, &values, passwordChangeSchema)
+	if !ok {
+		return kit.Render(PasswordChangeForm(PasswordChangeFormValues{}, formErrors))
+	}
+	if values.Password != values.PasswordConfirm {
+		formErrors.Add("passwordConfirm", "passwords do not match")
+		return kit.Render(PasswordChangeForm(PasswordChangeFormValues{}, formErrors))
+	}
+
+	auth := kit.Auth().(Auth)
+	sessionToken, _ := kit.GetSession(userSessionName).Values["sessionToken"].(string)
+	if _, err := ChangePassword(auth.UserID, values.CurrentPassword, values.Password, sessionToken); err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			formErrors.Add("currentPassword", "wrong password")
+			return kit.Render(PasswordChangeForm(PasswordChangeFormValues{}, formErrors))
+		}
+		return err
+	}
+
+	tokens, err := loadAPITokensData(auth.UserID)
+	if err != nil {
+		return err
+	}
+	tokens.SwapOOB = true
+	values = PasswordChangeFormValues{Success: "Password changed. Your other sessions have been signed out and your API tokens revoked."}
+	return kit.Render(PasswordChanged(values, tokens))
+}
+
+// HandleEmailChange mails a link confirming the new address of the user. The address is
+// only changed once the link is opened.
+func HandleEmailChange(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	pendingEmail, err := PendingEmailChange(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	var values EmailChangeFormValues
+	formErrors, ok := v.Request(kit.Request, &values, emailChangeSchema)
+	values.PendingEmail = pendingEmail
+	if !ok {
+		return kit.Render(EmailChangeForm(values, formErrors))
+	}
+	if values.Email == auth.Email {
+		formErrors.Add("email", "this is already your email address")
+		return kit.Render(EmailChangeForm(values, formErrors))
+	}
+
+	err = RequestEmailChange(auth.UserID, values.CurrentPassword, values.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWrongPassword):
+			formErrors.Add("currentPassword", "wrong password")
+		case errors.Is(err, ErrEmailTaken):
+			formErrors.Add("email", "this email address is already in use")
+		default:
+			slog.Error("failed to request email change", "err", err)
+			formErrors.Add("general", "An unexpected error occured, please try again.")
+		}
+		return kit.Render(EmailChangeForm(values, formErrors))
+	}
+
+	values = EmailChangeFormValues{
+		PendingEmail: values.Email,
+		Success:      fmt.Sprintf("We sent a confirmation link to %s. Your email address changes once you open it.", values.Email),
+	}
+	return kit.Render(EmailChangeForm(values, v.Errors{}))
+}
+
+// HandleEmailChangeConfirm swaps the email address of the user for the one the link was mailed to
+func HandleEmailChangeConfirm(kit *kit.Kit) error {
+	_, err := ConfirmEmailChange(kit.Request.URL.Query().Get("token"))
+	switch {
+	case errors.Is(err, ErrInvalidEmailChangeToken):
+		return kit.Render(EmailVerificationError("invalid or expired email change link"))
+	case errors.Is(err, ErrEmailTaken):
+		return kit.Render(EmailVerificationError("This email address is already in use"))
+	case err != nil:
+		return err
+	}
+	return kit.Redirect(http.StatusSeeOther, "/profile")
+}
@@ -14,17 +14,25 @@ func InitializeRoutes(router chi.Router, authConfig kit.AuthenticationConfig) {
 	// These endpoints are publicly accessible
 	router.Get("/email/verify", kit.Handler(HandleEmailVerify))
 	router.Post("/resend-email-verification", kit.Handler(HandleResendVerificationCode))
+	router.Get("/email/change", kit.Handler(HandleEmailChangeConfirm))
 
 	// First router group: Authentication-related routes (login/signup flows)
 	// The false parameter in WithAuthentication means authentication is NOT required
 	// These routes are for unauthenticated users who need to authenticate
 	router.Group(func(auth chi.Router) {
 		auth.Use(kit.WithAuthentication(authConfig, false))
-		auth.Get("/login", kit.Handler(HandleLoginIndex))      // Show login page
-		auth.Post("/login", kit.Handler(HandleLoginCreate))    // Process login form
-		auth.Delete("/logout", kit.Handler(HandleLoginDelete)) // Log user out
-		auth.Get("/signup", kit.Handler(HandleSignupIndex))    // Show signup page
-		auth.Post("/signup", kit.Handler(HandleSignupCreate))  // Process signup form
+		auth.Get("/login", kit.Handler(HandleLoginIndex))                       // Show login page
+		auth.Post("/login", kit.Handler(HandleLoginCreate))                     // Process login form
+		auth.Get("/login/two-factor", kit.Handler(HandleLoginTwoFactorIndex))   // Ask for the second factor
+		auth.Post("/login/two-factor", kit.Handler(HandleLoginTwoFactorCreate)) // Check the second factor and sign in
+		auth.Delete("/logout", kit.Handler(HandleLoginDelete))                  // Log user out
+		auth.Get("/signup", kit.Handler(HandleSignupIndex))                     // Show signup page
+		auth.Post("/signup", kit.Handler(HandleSignupCreate))                   // Process signup form
+
+		auth.Get("/password/forgot", kit.Handler(HandleForgotPasswordIndex))   // Show forgot password page
+		auth.Post("/password/forgot", kit.Handler(HandleForgotPasswordCreate)) // Mail a password reset link
+		auth.Get("/password/reset", kit.Handler(HandleResetPasswordIndex))     // Show new password page
+		auth.Post("/password/reset", kit.Handler(HandleResetPasswordCreate))   // Set the new password
 	})
 
 	// Second router group: Protected routes (require authentication)
@@ -32,7 +40,15 @@ func InitializeRoutes(router chi.Router, authConfig kit.AuthenticationConfig) {
 	// These routes are for already authenticated users
 	router.Group(func(auth chi.Router) {
 		auth.Use(kit.WithAuthentication(authConfig, true))
-		auth.Get("/profile", kit.Handler(HandleProfileShow))   // View user profile
-		auth.Put("/profile", kit.Handler(HandleProfileUpdate)) // Update user profile
+		auth.Get("/profile", kit.Handler(HandleProfileShow))                                       // View user profile
+		auth.Put("/profile", kit.Handler(HandleProfileUpdate))                                     // Update user profile
+		auth.Put("/profile/email", kit.Handler(HandleEmailChange))                                 // Mail a link confirming a new email
+		auth.Put("/profile/password", kit.Handler(HandlePasswordChange))                           // Change the password
+		auth.Post("/profile/tokens", kit.Handler(HandleAPITokenCreate))                            // Create an API token
+		auth.Delete("/profile/tokens/{id}", kit.Handler(HandleAPITokenRevoke))                     // Revoke an API token
+		auth.Post("/profile/two-factor", kit.Handler(HandleTwoFactorSetup))                        // Show a new TOTP secret
+		auth.Post("/profile/two-factor/confirm", kit.Handler(HandleTwoFactorConfirm))              // Turn on two-factor authentication
+		auth.Post("/profile/two-factor/recovery-codes", kit.Handler(HandleTwoFactorRecoveryCodes)) // Replace the recovery codes
+		auth.Post("/profile/two-factor/disable", kit.Handler(HandleTwoFactorDisable))              // Turn off two-factor authentication
 	})
 }
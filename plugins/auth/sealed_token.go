@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+)
+
+// SealedToken is a token encrypted with SUPERKIT_SECRET, as sent in event payloads. Payloads
+// wait in the outbox until they are handled, and like the token tables the database must not
+// hold tokens that can be used as they are.
+type SealedToken string
+
+// sealedTokenKey derives the AES-256 key of sealed tokens from SUPERKIT_SECRET
+func sealedTokenKey() ([]byte, error) {
+	secret := os.Getenv("SUPERKIT_SECRET")
+	if secret == "" {
+		return nil, errors.New("SUPERKIT_SECRET is not set")
+	}
+	sum := sha256.Sum256([]byte("auth sealed token:" + secret))
+	return sum[:], nil
+}
+
+// sealedTokenAEAD returns the AES-GCM cipher of sealed tokens
+func sealedTokenAEAD() (cipher.AEAD, error) {
+	key, err := sealedTokenKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealToken encrypts a token with a random nonce, which is kept in front of the ciphertext
+func sealToken(token string) (SealedToken, error) {
+	aead, err := sealedTokenAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), nil)
+	return SealedToken(base64.RawURLEncoding.EncodeToString(sealed)), nil
+}
+
+// Open decrypts the token. It fails when SUPERKIT_SECRET changed since the token was sealed.
+func (t SealedToken) Open() (string, error) {
+	aead, err := sealedTokenAEAD()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(string(t))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed sealed token")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	token, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to open sealed token")
+	}
+	return string(token), nil
+}
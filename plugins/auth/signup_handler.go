@@ -2,16 +2,17 @@ package auth
 
 import (
 	"gothstack/app/db"
+	"gothstack/app/outbox"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
-	"github.com/anthdm/superkit/event"
 	"github.com/anthdm/superkit/kit"
 	v "github.com/anthdm/superkit/validate"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 var signupSchema = v.Schema{
@@ -40,18 +41,26 @@ func HandleSignupCreate(kit *kit.Kit) error {
 		errors.Add("passwordConfirm", "passwords do not match")
 		return kit.Render(SignupForm(values, errors))
 	}
-	user, err := createUserFromFormValues(values)
-	if err != nil {
-		return err
-	}
-	token, err := createVerificationToken(user.ID)
+	// The signup event is written with the user, so the verification email is never lost
+	var user User
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = createUserFromFormValues(tx, values)
+		if err != nil {
+			return err
+		}
+		token, err := createVerificationToken(user.ID)
+		if err != nil {
+			return err
+		}
+		return outbox.Publish(tx, UserSignupEvent, UserWithVerificationToken{
+			Token: token,
+			User:  newEventUser(user),
+		})
+	})
 	if err != nil {
 		return err
 	}
-	event.Emit(UserSignupEvent, UserWithVerificationToken{
-		Token: token,
-		User:  user,
-	})
 	return kit.Render(ConfirmEmail(user))
 }
 
@@ -76,29 +85,39 @@ func HandleResendVerificationCode(kit *kit.Kit) error {
 		return kit.Text(http.StatusOK, "An unexpected error occured")
 	}
 
-	event.Emit(ResendVerificationEvent, UserWithVerificationToken{
-		User:  user,
+	err = outbox.Emit(ResendVerificationEvent, UserWithVerificationToken{
+		User:  newEventUser(user),
 		Token: token,
 	})
+	if err != nil {
+		return kit.Text(http.StatusOK, "An unexpected error occured")
+	}
 
 	msg := fmt.Sprintf("A new verification token has been sent to %s", user.Email)
 
 	return kit.Text(http.StatusOK, msg)
 }
 
-func createVerificationToken(userID uint) (string, error) {
+// emailVerificationExpiry returns how long a link verifying an email address is valid
+func emailVerificationExpiry() time.Duration {
 	expiryStr := kit.Getenv("SUPERKIT_AUTH_EMAIL_VERIFICATION_EXPIRY_IN_HOURS", "1")
 	expiry, err := strconv.Atoi(expiryStr)
 	if err != nil {
 		expiry = 1
 	}
+	return time.Hour * time.Duration(expiry)
+}
 
+// createVerificationToken returns the sealed verification token of a user, for the event payload
+func createVerificationToken(userID uint) (SealedToken, error) {
 	claims := jwt.RegisteredClaims{
 		Subject:   fmt.Sprint(userID),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(expiry))),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(emailVerificationExpiry())),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString([]byte(os.Getenv("SUPERKIT_SECRET")))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("SUPERKIT_SECRET")))
+	if err != nil {
+		return "", err
+	}
+	return sealToken(token)
 }
@@ -0,0 +1,494 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// Two-factor settings. Codes of the previous and the next period are accepted to allow for
+// clocks running a little apart. A login waiting for its second factor expires after
+// loginChallengeExpiry or loginChallengeAttempts wrong codes, the password must then be
+// entered again. Wrong codes are also counted per user across logins: from
+// twoFactorLockoutFailures wrong codes in a row, each one locks the second factor for
+// twoFactorLockoutBase, doubling with every further wrong code up to twoFactorLockoutMax.
+const (
+	totpPeriod               = 30
+	totpSkew                 = 1
+	recoveryCodeCount        = 10
+	loginChallengeExpiry     = 5 * time.Minute
+	loginChallengeAttempts   = 5
+	twoFactorLockoutFailures = 5
+	twoFactorLockoutBase     = time.Minute
+	twoFactorLockoutMax      = time.Hour
+)
+
+var (
+	// ErrTwoFactorEnabled is returned when setting up two-factor authentication again
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled is returned for users without two-factor authentication
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode is returned for wrong, reused and malformed codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidLoginChallenge is returned for unknown and expired logins waiting for their
+	// second factor, and those with too many wrong codes
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login challenge")
+	// ErrTwoFactorLocked is returned without checking the code while the second factor of a
+	// user is locked after too many wrong codes
+	ErrTwoFactorLocked = errors.New("two-factor authentication is locked after too many wrong codes")
+)
+
+// TOTPCredential is the shared secret of a user's authenticator app (RFC 6238). It is
+// unconfirmed, and not asked for at login, until the user entered a code it generated.
+// LastUsedStep is the time step of the last accepted code, a code is only accepted once.
+// FailedAttempts counts the wrong codes since the last right one, see checkTwoFactorCode.
+type TOTPCredential struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null"`
+	Secret         string `gorm:"not null"` // base32 as shown to the user
+	ConfirmedAt    sql.NullTime
+	LastUsedStep   int64 `gorm:"not null"`
+	FailedAttempts int   `gorm:"not null"`
+	LockedUntil    sql.NullTime
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// RecoveryCode is a single-use code replacing the authenticator app at login, for users
+// who lost it. Like API tokens only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+// LoginChallenge is a login whose password was right, waiting for the second factor.
+// The token identifies it in the session cookie of the browser.
+type LoginChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	TokenHash string `gorm:"not null"`
+	Attempts  int    `gorm:"not null"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// TOTPSetup is what the user needs to add a secret to their authenticator app
+type TOTPSetup struct {
+	Secret string
+	URL    string // otpauth:// URL encoded in the QR code
+	QRCode string // data URL of the QR code as a PNG image
+}
+
+// totpIssuer names the application in authenticator apps
+func totpIssuer() string {
+	return kit.Getenv("SUPERKIT_AUTH_TOTP_ISSUER", "Calendar App")
+}
+
+// findTOTPCredential returns the credential of a user, confirmed or not
+func findTOTPCredential(tx *gorm.DB, userID uint) (TOTPCredential, bool, error) {
+	var credential TOTPCredential
+	result := tx.Where("user_id = ?", userID).Limit(1).Find(&credential)
+	return credential, result.RowsAffected == 1, result.Error
+}
+
+// TwoFactorEnabled reports whether a user confirmed an authenticator app
+func TwoFactorEnabled(userID uint) (bool, error) {
+	credential, ok, err := findTOTPCredential(db.Get(), userID)
+	return ok && credential.ConfirmedAt.Valid, err
+}
+
+// newTOTPSetup returns the QR code and secret for a credential of the user
+func newTOTPSetup(user User, secret string) (TOTPSetup, error) {
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return TOTPSetup{}, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Secret:      raw,
+	})
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return TOTPSetup{}, fmt.Errorf("failed to render TOTP QR code: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return TOTPSetup{}, fmt.Errorf("failed to encode TOTP QR code: %w", err)
+	}
+	return TOTPSetup{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// BeginTOTPSetup creates a new secret for a user without two-factor authentication,
+// replacing any unconfirmed one. It is only used at login after ConfirmTOTPSetup.
+func BeginTOTPSetup(userID uint) (TOTPSetup, error) {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return TOTPSetup{}, err
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer(),
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return TOTPSetup{}, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		credential, ok, err := findTOTPCredential(tx, userID)
+		if err != nil {
+			return err
+		}
+		if ok && credential.ConfirmedAt.Valid {
+			return ErrTwoFactorEnabled
+		}
+		now := time.Now()
+		credential.UserID = userID
+		credential.Secret = key.Secret()
+		credential.LastUsedStep = 0
+		credential.UpdatedAt = now
+		if !ok {
+			credential.CreatedAt = now
+		}
+		return tx.Save(&credential).Error
+	})
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	return newTOTPSetup(user, key.Secret())
+}
+
+// PendingTOTPSetup returns the setup of the unconfirmed secret of a user
+func PendingTOTPSetup(userID uint) (TOTPSetup, error) {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return TOTPSetup{}, err
+	}
+	credential, ok, err := findTOTPCredential(db.Get(), userID)
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	if !ok || credential.ConfirmedAt.Valid {
+		return TOTPSetup{}, ErrTwoFactorNotEnabled
+	}
+	return newTOTPSetup(user, credential.Secret)
+}
+
+// ConfirmTOTPSetup enables two-factor authentication once the user entered a code of their
+// new secret, and returns their recovery codes
+func ConfirmTOTPSetup(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		credential, ok, err := findTOTPCredential(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrTwoFactorNotEnabled
+		}
+		if credential.ConfirmedAt.Valid {
+			return ErrTwoFactorEnabled
+		}
+		if err := useTOTPCode(tx, credential, code); err != nil {
+			return err
+		}
+		now := time.Now()
+		err = tx.Model(&TOTPCredential{}).Where("id = ?", credential.ID).
+			Updates(map[string]any{"confirmed_at": now, "updated_at": now}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTwoFactor removes the secret and recovery codes of a user who knows their password
+// and still has their second factor: a code of the authenticator app or a recovery code
+func DisableTwoFactor(userID uint, password, code string) error {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+	return checkTwoFactorCode(userID, code, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&TOTPCredential{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user who knows their password
+func RegenerateRecoveryCodes(userID uint, password string) ([]string, error) {
+	var user User
+	if err := db.Get().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return nil, err
+	}
+	enabled, err := TwoFactorEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	var codes []string
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func CountRecoveryCodes(userID uint) (int, error) {
+	var count int64
+	err := db.Get().Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return int(count), err
+}
+
+// replaceRecoveryCodes creates new recovery codes for a user, the old ones stop working.
+// Codes are 80 random bits written as four groups of four base32 characters.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code := s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		codes = append(codes, code)
+		records = append(records, RecoveryCode{
+			UserID:    userID,
+			CodeHash:  hashAPIToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode drops the dashes and spaces users may type or leave out
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// useTOTPCode checks a code of the authenticator app and records its time step, so that
+// neither it nor an earlier code can be used again
+func useTOTPCode(tx *gorm.DB, credential TOTPCredential, code string) error {
+	code = strings.ReplaceAll(code, " ", "")
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	if len(code) != opts.Digits.Length() {
+		return ErrInvalidTwoFactorCode
+	}
+	now := time.Now()
+	step := now.Unix() / totpPeriod
+	for s := step - totpSkew; s <= step+totpSkew; s++ {
+		if s <= credential.LastUsedStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(credential.Secret, time.Unix(s*totpPeriod, 0), opts)
+		if err != nil {
+			return err
+		}
+		if expected != code {
+			continue
+		}
+		// Only one request can use the step, a concurrent one finds it used
+		result := tx.Model(&TOTPCredential{}).
+			Where("id = ? AND last_used_step < ?", credential.ID, s).
+			Updates(map[string]any{"last_used_step": s, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// useRecoveryCode checks a recovery code of a user and uses it up
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	now := time.Now()
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashAPIToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkTwoFactorCode checks a code of the authenticator app, or else a recovery code, of a
+// user with two-factor authentication and uses it up. fn runs in the transaction using the
+// code. Every code is counted before it is checked, so that concurrent requests cannot try
+// more codes than allowed, and a right code resets the count. While the second factor is
+// locked codes are not checked and ErrTwoFactorLocked is returned.
+func checkTwoFactorCode(userID uint, code string, fn func(tx *gorm.DB) error) error {
+	now := time.Now()
+	result := db.Get().Model(&TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL AND (locked_until IS NULL OR locked_until <= ?)", userID, now).
+		Update("failed_attempts", gorm.Expr("failed_attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	credential, ok, err := findTOTPCredential(db.Get(), userID)
+	if err != nil {
+		return err
+	}
+	if !ok || !credential.ConfirmedAt.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorLocked
+	}
+
+	err = db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := useTOTPCode(tx, credential, code); errors.Is(err, ErrInvalidTwoFactorCode) {
+			if err := useRecoveryCode(tx, userID, code); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		err := tx.Model(&TOTPCredential{}).Where("id = ?", credential.ID).
+			Updates(map[string]any{"failed_attempts": 0, "locked_until": nil}).Error
+		if err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if errors.Is(err, ErrInvalidTwoFactorCode) && credential.FailedAttempts >= twoFactorLockoutFailures {
+		lockout := twoFactorLockoutMax
+		if n := credential.FailedAttempts - twoFactorLockoutFailures; n < 10 {
+			lockout = min(twoFactorLockoutBase<<n, twoFactorLockoutMax)
+		}
+		lockErr := db.Get().Model(&TOTPCredential{}).Where("id = ?", credential.ID).
+			Update("locked_until", now.Add(lockout)).Error
+		if lockErr != nil {
+			return lockErr
+		}
+	}
+	return err
+}
+
+// CreateLoginChallenge starts the second step of the login of a user with two-factor
+// authentication and returns the token identifying it
+func CreateLoginChallenge(userID uint) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	challenge := LoginChallenge{
+		UserID:    userID,
+		TokenHash: hashAPIToken(token),
+		ExpiresAt: now.Add(loginChallengeExpiry),
+		CreatedAt: now,
+	}
+	err := db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at <= ?", now).Delete(&LoginChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return token, nil
+}
+
+// CheckLoginChallenge reports whether a login challenge can still be answered
+func CheckLoginChallenge(token string) error {
+	var count int64
+	err := db.Get().Model(&LoginChallenge{}).
+		Where("token_hash = ? AND expires_at > ? AND attempts < ?", hashAPIToken(token), time.Now(), loginChallengeAttempts).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidLoginChallenge
+	}
+	return nil
+}
+
+// AnswerLoginChallenge completes a login with a code of the authenticator app or a recovery
+// code, and returns the user. The challenge is used up on success. A wrong code counts as an
+// attempt and returns ErrInvalidTwoFactorCode, ErrTwoFactorLocked is returned while the
+// second factor of the user is locked.
+func AnswerLoginChallenge(token, code string) (User, error) {
+	var user User
+	now := time.Now()
+	var challenge LoginChallenge
+	result := db.Get().Where("token_hash = ? AND expires_at > ?", hashAPIToken(token), now).Limit(1).Find(&challenge)
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, ErrInvalidLoginChallenge
+	}
+	// Count the attempt first, so that concurrent requests cannot try more codes
+	result = db.Get().Model(&LoginChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, loginChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, ErrInvalidLoginChallenge
+	}
+
+	err := checkTwoFactorCode(challenge.UserID, code, func(tx *gorm.DB) error {
+		if err := tx.Delete(&LoginChallenge{}, challenge.ID).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, challenge.UserID).Error
+	})
+	return user, err
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+)
+
+var twoFactorCodeSchema = v.Schema{
+	"code": v.Rules(v.Required),
+}
+
+var twoFactorPasswordSchema = v.Schema{
+	"currentPassword": v.Rules(v.Required),
+}
+
+var twoFactorDisableSchema = v.Schema{
+	"currentPassword": v.Rules(v.Required),
+	"code":            v.Rules(v.Required),
+}
+
+// twoFactorLockedMessage is shown for codes entered while the second factor is locked
+const twoFactorLockedMessage = "too many wrong codes, wait a few minutes and try again"
+
+// TwoFactorCodeFormValues holds the code of the authenticator app, or a recovery code
+type TwoFactorCodeFormValues struct {
+	Code string `form:"code"`
+}
+
+// TwoFactorPasswordFormValues holds the password confirming a change to two-factor authentication
+type TwoFactorPasswordFormValues struct {
+	CurrentPassword string `form:"currentPassword"`
+}
+
+// TwoFactorDisableFormValues holds the password and a code of the second factor confirming
+// that two-factor authentication is turned off
+type TwoFactorDisableFormValues struct {
+	CurrentPassword string `form:"currentPassword"`
+	Code            string `form:"code"`
+}
+
+// TwoFactorData holds data for the two-factor authentication section of the profile page
+type TwoFactorData struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+	Setup             *TOTPSetup // the secret being set up, not confirmed yet
+	RecoveryCodes     []string   // the recovery codes just created, shown only once
+	FormErrors        v.Errors
+	Disabling         bool // the form errors are those of the form turning it off
+}
+
+// loadTwoFactorData loads the two-factor authentication state of the user
+func loadTwoFactorData(userID uint) (TwoFactorData, error) {
+	enabled, err := TwoFactorEnabled(userID)
+	if err != nil {
+		return TwoFactorData{}, err
+	}
+	data := TwoFactorData{Enabled: enabled, FormErrors: v.Errors{}}
+	if enabled {
+		data.RecoveryCodesLeft, err = CountRecoveryCodes(userID)
+	}
+	return data, err
+}
+
+// HandleTwoFactorSetup creates a new secret and shows it with its QR code
+func HandleTwoFactorSetup(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	data, err := loadTwoFactorData(auth.UserID)
+	if err != nil {
+		return err
+	}
+	if data.Enabled {
+		return kit.Render(TwoFactor(data))
+	}
+	setup, err := BeginTOTPSetup(auth.UserID)
+	if err != nil {
+		return err
+	}
+	data.Setup = &setup
+	return kit.Render(TwoFactor(data))
+}
+
+// HandleTwoFactorConfirm enables two-factor authentication with a code of the new secret
+// and shows the recovery codes once
+func HandleTwoFactorConfirm(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	data, err := loadTwoFactorData(auth.UserID)
+	if err != nil {
+		return err
+	}
+	if data.Enabled {
+		return kit.Render(TwoFactor(data))
+	}
+	setup, err := PendingTOTPSetup(auth.UserID)
+	if errors.Is(err, ErrTwoFactorNotEnabled) {
+		return kit.Render(TwoFactor(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	var values TwoFactorCodeFormValues
+	formErrors, ok := v.Request(kit.Request, &values, twoFactorCodeSchema)
+	if !ok {
+		data.Setup, data.FormErrors = &setup, formErrors
+		return kit.Render(TwoFactor(data))
+	}
+	codes, err := ConfirmTOTPSetup(auth.UserID, values.Code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		formErrors.Add("code", "invalid code, check the time of your device and try the next code")
+		data.Setup, data.FormErrors = &setup, formErrors
+		return kit.Render(TwoFactor(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	data.Enabled, data.RecoveryCodes, data.RecoveryCodesLeft = true, codes, len(codes)
+	return kit.Render(TwoFactor(data))
+}
+
+// HandleTwoFactorRecoveryCodes replaces the recovery codes and shows the new ones once
+func HandleTwoFactorRecoveryCodes(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	data, err := loadTwoFactorData(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	var values TwoFactorPasswordFormValues
+	formErrors, ok := v.Request(kit.Request, &values, twoFactorPasswordSchema)
+	if !ok {
+		data.FormErrors = formErrors
+		return kit.Render(TwoFactor(data))
+	}
+	codes, err := RegenerateRecoveryCodes(auth.UserID, values.CurrentPassword)
+	switch {
+	case errors.Is(err, ErrWrongPassword):
+		formErrors.Add("currentPassword", "wrong password")
+		data.FormErrors = formErrors
+		return kit.Render(TwoFactor(data))
+	case errors.Is(err, ErrTwoFactorNotEnabled):
+		return kit.Render(TwoFactor(data))
+	case err != nil:
+		return err
+	}
+
+	data.RecoveryCodes, data.RecoveryCodesLeft = codes, len(codes)
+	return kit.Render(TwoFactor(data))
+}
+
+// HandleTwoFactorDisable turns two-factor authentication off
+func HandleTwoFactorDisable(kit *kit.Kit) error {
+	auth := kit.Auth().(Auth)
+	data, err := loadTwoFactorData(auth.UserID)
+	if err != nil {
+		return err
+	}
+
+	data.Disabling = true
+
+	var values TwoFactorDisableFormValues
+	formErrors, ok := v.Request(kit.Request, &values, twoFactorDisableSchema)
+	if !ok {
+		data.FormErrors = formErrors
+		return kit.Render(TwoFactor(data))
+	}
+	err = DisableTwoFactor(auth.UserID, values.CurrentPassword, values.Code)
+	switch {
+	case errors.Is(err, ErrWrongPassword):
+		formErrors.Add("currentPassword", "wrong password")
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		formErrors.Add("code", "invalid code")
+	case errors.Is(err, ErrTwoFactorLocked):
+		formErrors.Add("code", twoFactorLockedMessage)
+	case errors.Is(err, ErrTwoFactorNotEnabled):
+		return kit.Render(TwoFactor(data))
+	case err != nil:
+		return err
+	}
+	if len(formErrors) > 0 {
+		data.FormErrors = formErrors
+		return kit.Render(TwoFactor(data))
+	}
+
+	return kit.Render(TwoFactor(TwoFactorData{FormErrors: v.Errors{}}))
+}
+
+// loginChallengeToken returns the token of the login waiting for its second factor
+func loginChallengeToken(kit *kit.Kit) string {
+	token, _ := kit.GetSession(userSessionName).Values["loginChallenge"].(string)
+	return token
+}
+
+// HandleLoginTwoFactorIndex asks for the second factor of a login
+func HandleLoginTwoFactorIndex(kit *kit.Kit) error {
+	if kit.Auth().Check() {
+		redirectURL := kit.Getenv("SUPERKIT_AUTH_REDIRECT_AFTER_LOGIN", "/profile")
+		return kit.Redirect(http.StatusSeeOther, redirectURL)
+	}
+	if err := CheckLoginChallenge(loginChallengeToken(kit)); err != nil {
+		if errors.Is(err, ErrInvalidLoginChallenge) {
+			return kit.Redirect(http.StatusSeeOther, "/login")
+		}
+		return err
+	}
+	return kit.Render(LoginTwoFactorIndex(TwoFactorCodeFormValues{}, v.Errors{}))
+}
+
+// HandleLoginTwoFactorCreate checks the second factor and signs the user in
+func HandleLoginTwoFactorCreate(kit *kit.Kit) error {
+	var values TwoFactorCodeFormValues
+	formErrors, ok := v.Request(kit.Request, &values, twoFactorCodeSchema)
+	if !ok {
+		return kit.Render(LoginTwoFactorForm(values, formErrors))
+	}
+	user, err := AnswerLoginChallenge(loginChallengeToken(kit), values.Code)
+	switch {
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		formErrors.Add("code", "invalid code")
+		return kit.Render(LoginTwoFactorForm(TwoFactorCodeFormValues{}, formErrors))
+	case errors.Is(err, ErrTwoFactorLocked):
+		formErrors.Add("code", twoFactorLockedMessage)
+		return kit.Render(LoginTwoFactorForm(TwoFactorCodeFormValues{}, formErrors))
+	case errors.Is(err, ErrInvalidLoginChallenge), errors.Is(err, ErrTwoFactorNotEnabled):
+		// Expired or too many wrong codes, start over with the password
+		sess := kit.GetSession(userSessionName)
+		delete(sess.Values, "loginChallenge")
+		sess.Save(kit.Request, kit.Response)
+		return kit.Redirect(http.StatusSeeOther, "/login")
+	case err != nil:
+		return err
+	}
+	return createSession(kit, user)
+}
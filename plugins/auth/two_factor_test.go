@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"errors"
+	"gothstack/app/db"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// TestMain removes the sqlite database app/db opens in the working directory
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Remove("app_db")
+	os.Exit(code)
+}
+
+// twoFactorTestPassword is the password of the user of newTwoFactorUser
+const twoFactorTestPassword = "Correct horse 1"
+
+// setupTwoFactorTables creates empty tables of users and their second factors with the
+// migrations of the app
+func setupTwoFactorTables(t *testing.T) {
+	t.Helper()
+	for _, table := range []string{"login_challenges", "recovery_codes", "totp_credentials", "users"} {
+		if err := db.Get().Exec("drop table if exists " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"001_create_users_table.sql", "018_two_factor.sql", "020_two_factor_lockout.sql"} {
+		migration, err := os.ReadFile("../../app/db/migrations/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(strings.SplitN(string(migration), "-- +goose Up", 2)[1], "-- +goose Down")
+		if err := db.Get().Exec(up).Error; err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+// newTwoFactorUser creates a user with confirmed two-factor authentication and returns
+// the user ID, the TOTP secret and the recovery codes. The code of the current time step
+// was used for the confirmation. It waits for the next step when the current one is about
+// to end, so that tests of codes relative to it stay in the same step.
+func newTwoFactorUser(t *testing.T) (uint, string, []string) {
+	t.Helper()
+	if left := totpPeriod - time.Now().Unix()%totpPeriod; left < 3 {
+		time.Sleep(time.Duration(left) * time.Second)
+	}
+	setupTwoFactorTables(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte(twoFactorTestPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := User{Email: "ann@example.com", PasswordHash: string(hash), FirstName: "Ann", LastName: "Example", Role: "user", CreatedAt: now, UpdatedAt: now}
+	if err := db.Get().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	setup, err := BeginTOTPSetup(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := ConfirmTOTPSetup(user.ID, totpTestCode(t, setup.Secret, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID, setup.Secret, codes
+}
+
+// totpTestCode returns the code of the time step steps periods away from now
+func totpTestCode(t *testing.T, secret string, steps int) string {
+	t.Helper()
+	at := time.Now().Add(time.Duration(steps*totpPeriod) * time.Second)
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// loadTOTPCredential returns the credential of a user
+func loadTOTPCredential(t *testing.T, userID uint) TOTPCredential {
+	t.Helper()
+	credential, ok, err := findTOTPCredential(db.Get(), userID)
+	if err != nil || !ok {
+		t.Fatalf("credential of user %d: %t, %v", userID, ok, err)
+	}
+	return credential
+}
+
+// resetTwoFactorFailures forgets the wrong codes of a user, for tests of other rules than the lockout
+func resetTwoFactorFailures(userID uint) {
+	db.Get().Model(&TOTPCredential{}).Where("user_id = ?", userID).
+		Updates(map[string]any{"failed_attempts": 0, "locked_until": nil})
+}
+
+// useTwoFactorCode checks a code like a login does, without anything else to do
+func useTwoFactorCode(userID uint, code string) error {
+	return checkTwoFactorCode(userID, code, func(tx *gorm.DB) error { return nil })
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	userID, _, codes := newTwoFactorUser(t)
+
+	// Wrong codes in a row and the lock each one sets, with the lock of the previous one
+	// waited out before the next code
+	tests := []struct {
+		failures int
+		lockout  time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{10, 32 * time.Minute},
+		{11, time.Hour},
+		{12, time.Hour},
+		{30, time.Hour},
+	}
+	failures := 0
+	for _, test := range tests {
+		for failures < test.failures {
+			db.Get().Model(&TOTPCredential{}).Where("user_id = ?", userID).Update("locked_until", nil)
+			before := time.Now()
+			if err := useTwoFactorCode(userID, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Fatalf("wrong code %d: %v, want %v", failures+1, err, ErrInvalidTwoFactorCode)
+			}
+			after := time.Now()
+			failures++
+
+			credential := loadTOTPCredential(t, userID)
+			if credential.FailedAttempts != failures {
+				t.Fatalf("%d wrong codes counted as %d", failures, credential.FailedAttempts)
+			}
+			if failures < test.failures {
+				continue
+			}
+			if test.lockout == 0 {
+				if credential.LockedUntil.Valid {
+					t.Errorf("%d wrong codes: locked until %s, want not locked", failures, credential.LockedUntil.Time)
+				}
+				continue
+			}
+			if !credential.LockedUntil.Valid {
+				t.Errorf("%d wrong codes: not locked, want locked for %s", failures, test.lockout)
+				continue
+			}
+			if lockedUntil := credential.LockedUntil.Time; lockedUntil.Before(before.Add(test.lockout)) || lockedUntil.After(after.Add(test.lockout)) {
+				t.Errorf("%d wrong codes: locked for %s, want %s", failures, lockedUntil.Sub(before).Round(time.Second), test.lockout)
+			}
+		}
+	}
+
+	// While locked, right codes are refused without counting them
+	if err := useTwoFactorCode(userID, codes[0]); !errors.Is(err, ErrTwoFactorLocked) {
+		t.Fatalf("right code while locked: %v, want %v", err, ErrTwoFactorLocked)
+	}
+	if credential := loadTOTPCredential(t, userID); credential.FailedAttempts != failures {
+		t.Errorf("code while locked counted: %d, want %d", credential.FailedAttempts, failures)
+	}
+	if count, _ := CountRecoveryCodes(userID); count != recoveryCodeCount {
+		t.Errorf("recovery code used while locked: %d left", count)
+	}
+
+	// Once the lock ran out, a right code unlocks and resets the count
+	db.Get().Model(&TOTPCredential{}).Where("user_id = ?", userID).Update("locked_until", time.Now().Add(-time.Second))
+	if err := useTwoFactorCode(userID, codes[0]); err != nil {
+		t.Fatalf("right code after the lock: %v", err)
+	}
+	if credential := loadTOTPCredential(t, userID); credential.FailedAttempts != 0 || credential.LockedUntil.Valid {
+		t.Errorf("after a right code: %d failed attempts, locked %t", credential.FailedAttempts, credential.LockedUntil.Valid)
+	}
+}
+
+func TestTOTPCodeSteps(t *testing.T) {
+	userID, secret, _ := newTwoFactorUser(t)
+
+	// The code of the current step confirmed the setup
+	tests := []struct {
+		name  string
+		steps int
+		err   error
+	}{
+		{"current step again", 0, ErrInvalidTwoFactorCode},
+		{"previous step", -1, ErrInvalidTwoFactorCode},
+		{"next step", 1, nil},
+		{"next step again", 1, ErrInvalidTwoFactorCode},
+		{"current step after the next", 0, ErrInvalidTwoFactorCode},
+		{"two steps ahead", 2, ErrInvalidTwoFactorCode},
+	}
+	for _, test := range tests {
+		resetTwoFactorFailures(userID)
+		if err := useTwoFactorCode(userID, totpTestCode(t, secret, test.steps)); !errors.Is(err, test.err) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		resetTwoFactorFailures(userID)
+		if err := useTwoFactorCode(userID, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("code %q: %v, want %v", code, err, ErrInvalidTwoFactorCode)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	userID, _, codes := newTwoFactorUser(t)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"first use", codes[0], nil},
+		{"second use", codes[0], ErrInvalidTwoFactorCode},
+		{"upper case without dashes", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), nil},
+		{"dashed again", codes[1], ErrInvalidTwoFactorCode},
+		{"with spaces", strings.ReplaceAll(codes[2], "-", " "), nil},
+		{"unknown", "aaaa-bbbb-cccc-dddd", ErrInvalidTwoFactorCode},
+	}
+	for _, test := range tests {
+		if err := useTwoFactorCode(userID, test.code); !errors.Is(err, test.err) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+	}
+	if count, _ := CountRecoveryCodes(userID); count != recoveryCodeCount-3 {
+		t.Errorf("%d recovery codes left, want %d", count, recoveryCodeCount-3)
+	}
+
+	// New codes replace the old ones
+	newCodes, err := RegenerateRecoveryCodes(userID, twoFactorTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := useTwoFactorCode(userID, codes[3]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("replaced code: %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	if err := useTwoFactorCode(userID, newCodes[0]); err != nil {
+		t.Errorf("new code: %v", err)
+	}
+}
+
+func TestLoginChallenge(t *testing.T) {
+	userID, _, codes := newTwoFactorUser(t)
+
+	tests := []struct {
+		name    string
+		prepare func(token string)
+		wrong   int // wrong codes entered first
+		err     error
+	}{
+		{"right code", nil, 0, nil},
+		{"right code after wrong ones", nil, loginChallengeAttempts - 1, nil},
+		{"exhausted", nil, loginChallengeAttempts, ErrInvalidLoginChallenge},
+		{"expired", func(token string) {
+			db.Get().Model(&LoginChallenge{}).Where("token_hash = ?", hashAPIToken(token)).
+				Update("expires_at", time.Now().Add(-time.Second))
+		}, 0, ErrInvalidLoginChallenge},
+		{"unknown", func(token string) {
+			db.Get().Where("token_hash = ?", hashAPIToken(token)).Delete(&LoginChallenge{})
+		}, 0, ErrInvalidLoginChallenge},
+	}
+	for i, test := range tests {
+		token, err := CreateLoginChallenge(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.prepare != nil {
+			test.prepare(token)
+		}
+		for range test.wrong {
+			if _, err := AnswerLoginChallenge(token, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Fatalf("%s: wrong code: %v, want %v", test.name, err, ErrInvalidTwoFactorCode)
+			}
+		}
+		// The lockout across challenges is tested on its own
+		resetTwoFactorFailures(userID)
+
+		if err := CheckLoginChallenge(token); !errors.Is(err, test.err) {
+			t.Errorf("%s: check: %v, want %v", test.name, err, test.err)
+		}
+		user, err := AnswerLoginChallenge(token, codes[i])
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && user.ID != userID {
+			t.Errorf("%s: logged in user %d, want %d", test.name, user.ID, userID)
+		}
+		if err == nil {
+			// A challenge is used up by the right code
+			if _, err := AnswerLoginChallenge(token, codes[len(codes)-1-i]); !errors.Is(err, ErrInvalidLoginChallenge) {
+				t.Errorf("%s: answered again: %v, want %v", test.name, err, ErrInvalidLoginChallenge)
+			}
+		}
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	userID, secret, codes := newTwoFactorUser(t)
+
+	tests := []struct {
+		name     string
+		password string
+		code     string
+		err      error
+	}{
+		{"wrong password", "wrong", totpTestCode(t, secret, 1), ErrWrongPassword},
+		{"no code", twoFactorTestPassword, "", ErrInvalidTwoFactorCode},
+		{"wrong code", twoFactorTestPassword, "000000", ErrInvalidTwoFactorCode},
+		{"used code", twoFactorTestPassword, totpTestCode(t, secret, 0), ErrInvalidTwoFactorCode},
+		{"recovery code", twoFactorTestPassword, codes[0], nil},
+		{"disabled", twoFactorTestPassword, codes[1], ErrTwoFactorNotEnabled},
+	}
+	for _, test := range tests {
+		if err := DisableTwoFactor(userID, test.password, test.code); !errors.Is(err, test.err) {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+		enabled, err := TwoFactorEnabled(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled != (test.err != nil && test.err != ErrTwoFactorNotEnabled) {
+			t.Errorf("%s: enabled %t", test.name, enabled)
+		}
+	}
+	if count, _ := CountRecoveryCodes(userID); count != 0 {
+		t.Errorf("%d recovery codes left after disabling", count)
+	}
+}
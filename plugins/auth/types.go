@@ -2,7 +2,6 @@ package auth
 
 import (
 	"database/sql"
-	"gothstack/app/db"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,41 +10,66 @@ import (
 
 // Event name constants
 const (
-	UserSignupEvent         = "auth.signup"
-	ResendVerificationEvent = "auth.resend.verification"
+	UserSignupEvent           = "auth.signup"
+	ResendVerificationEvent   = "auth.resend.verification"
+	PasswordResetRequestEvent = "auth.password.reset.request"
+	PasswordResetEvent        = "auth.password.reset"
+	PasswordChangeEvent       = "auth.password.change"
+	EmailChangeRequestEvent   = "auth.email.change.request"
+	EmailChangeEvent          = "auth.email.change"
 )
 
+// EventUser is the user in the payloads of the auth events. Payloads are stored in the
+// outbox, so they only hold what the event handlers need and never the password hash.
+type EventUser struct {
+	ID        uint
+	Email     string
+	FirstName string
+	UpdatedAt time.Time
+}
+
+func newEventUser(user User) EventUser {
+	return EventUser{ID: user.ID, Email: user.Email, FirstName: user.FirstName, UpdatedAt: user.UpdatedAt}
+}
+
 // UserWithVerificationToken is a struct that will be sent over the
-// auth.signup event. It holds the User struct and the Verification token string.
+// auth.signup event. It holds the User struct and the sealed Verification token.
 type UserWithVerificationToken struct {
-	User  User
-	Token string
+	User  EventUser
+	Token SealedToken
 }
 
 type Auth struct {
 	UserID   uint
 	Email    string
 	LoggedIn bool
+	Scope    string // scope of the API token of the request, empty for browser sessions
 }
 
 func (auth Auth) Check() bool {
 	return auth.LoggedIn
 }
 
+// CanWrite reports whether the request may change data. Browser sessions and
+// write tokens can, read tokens cannot.
+func (auth Auth) CanWrite() bool {
+	return auth.LoggedIn && auth.Scope != APITokenScopeRead
+}
+
 type User struct {
 	gorm.Model
 
 	Email           string
 	FirstName       string
 	LastName        string
-	PasswordHash    string
+	PasswordHash    string `json:"-"`
 	Role            string
 	EmailVerifiedAt sql.NullTime
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
 
-func createUserFromFormValues(values SignupFormValues) (User, error) {
+func createUserFromFormValues(tx *gorm.DB, values SignupFormValues) (User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(values.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return User{}, err
@@ -57,7 +81,7 @@ func createUserFromFormValues(values SignupFormValues) (User, error) {
 		Role:         "user",
 		PasswordHash: string(hash),
 	}
-	result := db.Get().Create(&user)
+	result := tx.Create(&user)
 	return user, result.Error
 }
 
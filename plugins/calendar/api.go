@@ -0,0 +1,362 @@
+package calendar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gothstack/plugins/auth"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"gorm.io/gorm"
+)
+
+// API pagination limits
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 200
+)
+
+// apiMaxBodySize is the largest JSON request body the API accepts
+const apiMaxBodySize = 1 << 20
+
+// APIError is the error body of the JSON API. Fields holds validation errors keyed by JSON field name.
+type APIError struct {
+	Status  int                 `json:"-"`
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// APIErrorBody is the body of every error response
+type APIErrorBody struct {
+	Error *APIError `json:"error"`
+}
+
+// apiErrorf returns an APIError with a formatted message
+func apiErrorf(status int, code, format string, args ...any) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// apiValidationError converts form validation errors to an APIError, renaming the fields
+// the form handlers use to their JSON names
+func apiValidationError(errs v.Errors, names map[string]string) *APIError {
+	fields := make(map[string][]string, len(errs))
+	for field, messages := range errs {
+		if name, ok := names[field]; ok {
+			field = name
+		}
+		fields[field] = append(fields[field], messages...)
+	}
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: "validation_failed", Message: "validation failed", Fields: fields}
+}
+
+// APIList is the body of paginated list responses
+type APIList[T any] struct {
+	Data       []T           `json:"data"`
+	Pagination APIPagination `json:"pagination"`
+}
+
+// APIPagination describes the page of a list response
+type APIPagination struct {
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+	Total  int64 `json:"total"`
+}
+
+// apiPage returns one page of items already loaded in memory
+func apiPage[T any](items []T, page APIPagination) APIList[T] {
+	page.Total = int64(len(items))
+	start := min(page.Offset, len(items))
+	end := min(start+page.Limit, len(items))
+	return APIList[T]{Data: items[start:end], Pagination: page}
+}
+
+// writeAPIJSON writes v as the JSON response body. Unlike kit.JSON it sets the content type
+// before writing the status.
+func writeAPIJSON(kit *kit.Kit, status int, v any) error {
+	kit.Response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	kit.Response.WriteHeader(status)
+	return json.NewEncoder(kit.Response).Encode(v)
+}
+
+// writeAPINoContent writes an empty response
+func writeAPINoContent(kit *kit.Kit) error {
+	kit.Response.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// decodeAPIJSON decodes the JSON request body into v, rejecting other content types and unknown fields
+func decodeAPIJSON(kit *kit.Kit, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(kit.Request.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return apiErrorf(http.StatusUnsupportedMediaType, "unsupported_media_type", "request body must be application/json")
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(kit.Response, kit.Request.Body, apiMaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return apiErrorf(http.StatusBadRequest, "invalid_json", "invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// apiPagination reads the limit and offset query parameters
+func apiPagination(kit *kit.Kit) (APIPagination, error) {
+	page := APIPagination{Limit: apiDefaultLimit}
+	query := kit.Request.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			return page, apiErrorf(http.StatusBadRequest, "invalid_parameter", "limit must be between 1 and %d", apiMaxLimit)
+		}
+		page.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, apiErrorf(http.StatusBadRequest, "invalid_parameter", "offset must be a non-negative integer")
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+// apiURLID parses a numeric ID path parameter
+func apiURLID(value, name string) (uint, error) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, apiErrorf(http.StatusNotFound, "not_found", "invalid %s ID %q", name, value)
+	}
+	return uint(id), nil
+}
+
+// apiHandler adapts an API handler, writing returned errors as JSON error bodies.
+// Missing records become 404 responses and unexpected errors are logged and hidden.
+func apiHandler(h kit.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		kit := &kit.Kit{Response: w, Request: r}
+		err := h(kit)
+		if err == nil {
+			return
+		}
+		var apiErr *APIError
+		switch {
+		case errors.As(err, &apiErr):
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apiErr = apiErrorf(http.StatusNotFound, "not_found", "not found")
+		default:
+			slog.Error("api error", "err", err.Error(), "path", r.URL.Path)
+			apiErr = apiErrorf(http.StatusInternalServerError, "internal_error", "internal server error")
+		}
+		writeAPIJSON(kit, apiErr.Status, APIErrorBody{Error: apiErr})
+	}
+}
+
+// requireAPIAuth rejects requests without an authenticated user with a JSON 401 instead of
+// the login redirect of the HTML routes, and requests changing data with a read token with a 403
+func requireAPIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(kit.AuthKey{}).(auth.Auth)
+		var err *APIError
+		switch {
+		case !ok || !user.Check():
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			err = apiErrorf(http.StatusUnauthorized, "unauthorized", "authentication required")
+		case !user.CanWrite() && r.Method != http.MethodGet && r.Method != http.MethodHead:
+			err = apiErrorf(http.StatusForbidden, "insufficient_scope", "the API token is read only")
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		apiHandler(func(kit *kit.Kit) error { return err })(w, r)
+	})
+}
+
+// APICalendar is a calendar in API responses
+type APICalendar struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Work           bool      `json:"work"`
+	DailyWorkHours float64   `json:"daily_work_hours"`
+	SharedWorkday  bool      `json:"shared_workday"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// APICalendarInput is the request body for creating a calendar
+type APICalendarInput struct {
+	Name           string  `json:"name"`
+	Work           bool    `json:"work"`
+	DailyWorkHours float64 `json:"daily_work_hours"`
+	SharedWorkday  bool    `json:"shared_workday"`
+}
+
+func newAPICalendar(calendar Calendar) APICalendar {
+	return APICalendar{
+		ID:             calendar.ID,
+		Name:           calendar.Name,
+		Work:           calendar.Work,
+		DailyWorkHours: calendar.DailyWorkHours,
+		SharedWorkday:  calendar.SharedWorkday,
+		CreatedAt:      calendar.CreatedAt,
+		UpdatedAt:      calendar.UpdatedAt,
+	}
+}
+
+// APIEntry is a calendar entry in API responses. A zero WorkResourceID means no resource
+// and empty times an entry without a time of day.
+type APIEntry struct {
+	ID             uint      `json:"id"`
+	CalendarID     uint      `json:"calendar_id"`
+	Date           string    `json:"date"`
+	Hours          float64   `json:"hours"`
+	Text           string    `json:"text"`
+	WorkResourceID uint      `json:"work_resource_id"`
+	StartTime      string    `json:"start_time"`
+	EndTime        string    `json:"end_time"`
+	Tags           []string  `json:"tags"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// APIEntryInput is the request body for creating and replacing a calendar entry.
+// Tags are added to the #tags written in the text.
+type APIEntryInput struct {
+	Date           string   `json:"date"`
+	Hours          float64  `json:"hours"`
+	Text           string   `json:"text"`
+	WorkResourceID uint     `json:"work_resource_id"`
+	StartTime      string   `json:"start_time"`
+	EndTime        string   `json:"end_time"`
+	Tags           []string `json:"tags"`
+}
+
+// apiEntryFields maps the entry form fields to their JSON names
+var apiEntryFields = map[string]string{"resource": "work_resource_id", "startTime": "start_time"}
+
+func newAPIEntry(entry CalendarEntry) APIEntry {
+	tags := make([]string, 0, len(entry.Tags))
+	for _, tag := range entry.Tags {
+		tags = append(tags, tag.Name)
+	}
+	return APIEntry{
+		ID:             entry.ID,
+		CalendarID:     entry.CalendarID,
+		Date:           entry.Date.Format("2006-01-02"),
+		Hours:          entry.Hours,
+		Text:           entry.Text,
+		WorkResourceID: entry.WorkResourceID,
+		StartTime:      entry.StartTime,
+		EndTime:        entry.EndTime,
+		Tags:           NormalizeTags(tags),
+		CreatedAt:      entry.CreatedAt,
+		UpdatedAt:      entry.UpdatedAt,
+	}
+}
+
+// APIWorkResource is a work resource in API responses. Shared resources belong to the
+// user and are attached to the calendar.
+type APIWorkResource struct {
+	ID                  uint      `json:"id"`
+	ParentID            uint      `json:"parent_id"`
+	Kind                string    `json:"kind"`
+	Name                string    `json:"name"`
+	Path                string    `json:"path"`
+	ResourcesPercentage int       `json:"resources_percentage"`
+	Shared              bool      `json:"shared"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// APIWorkResourceInput is the request body for creating and replacing a work resource
+type APIWorkResourceInput struct {
+	Name                string `json:"name"`
+	Kind                string `json:"kind"`
+	ParentID            uint   `json:"parent_id"`
+	ResourcesPercentage int    `json:"resources_percentage"`
+}
+
+// apiWorkResourceFields maps the work resource form fields to their JSON names
+var apiWorkResourceFields = map[string]string{"parent": "parent_id"}
+
+func newAPIWorkResource(item WorkResourceTreeItem) APIWorkResource {
+	return APIWorkResource{
+		ID:                  item.Resource.ID,
+		ParentID:            item.Resource.ParentID,
+		Kind:                item.Resource.Kind,
+		Name:                item.Resource.Name,
+		Path:                item.Path,
+		ResourcesPercentage: item.Resource.ResourcesPercentage,
+		Shared:              item.Resource.IsShared(),
+		CreatedAt:           item.Resource.CreatedAt,
+		UpdatedAt:           item.Resource.UpdatedAt,
+	}
+}
+
+// APIMonthStats is the work statistics of a calendar month
+type APIMonthStats struct {
+	Year           int                     `json:"year"`
+	Month          int                     `json:"month"`
+	WorkingDays    int                     `json:"working_days"`
+	TotalWorkHours float64                 `json:"total_work_hours"`
+	LoggedHours    float64                 `json:"logged_hours"`
+	Progress       float64                 `json:"progress"`
+	Holidays       []APIHoliday            `json:"holidays"`
+	Resources      []APIResourceMonthStats `json:"resources"`
+}
+
+// APIHoliday is a public holiday on a weekday of the month
+type APIHoliday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// APIResourceMonthStats is the statistics of one resource, rolled up to projects and clients
+type APIResourceMonthStats struct {
+	ResourceID  uint    `json:"resource_id"`
+	Kind        string  `json:"kind"`
+	Path        string  `json:"path"`
+	Percentage  int     `json:"percentage"`
+	TargetHours float64 `json:"target_hours"`
+	LoggedHours float64 `json:"logged_hours"`
+	Progress    float64 `json:"progress"`
+}
+
+// newAPIMonthStats converts month statistics, listing the resources in tree order
+func newAPIMonthStats(year, month int, stats WorkMonthStats, tree []WorkResourceTreeItem) APIMonthStats {
+	result := APIMonthStats{
+		Year:           year,
+		Month:          month,
+		WorkingDays:    stats.WorkingDays,
+		TotalWorkHours: stats.TotalWorkHours,
+		LoggedHours:    stats.LoggedHours,
+		Progress:       stats.Progress,
+		Holidays:       make([]APIHoliday, 0, len(stats.Holidays)),
+		Resources:      make([]APIResourceMonthStats, 0, len(tree)),
+	}
+	for _, holiday := range stats.Holidays {
+		result.Holidays = append(result.Holidays, APIHoliday{Date: holiday.Date.Format("2006-01-02"), Name: holiday.Name})
+	}
+	for _, item := range tree {
+		resourceStats := stats.ResourceStats[item.Resource.ID]
+		result.Resources = append(result.Resources, APIResourceMonthStats{
+			ResourceID:  item.Resource.ID,
+			Kind:        item.Resource.Kind,
+			Path:        item.Path,
+			Percentage:  resourceStats.Percentage,
+			TargetHours: resourceStats.TargetHours,
+			LoggedHours: resourceStats.LoggedHours,
+			Progress:    resourceStats.Progress,
+		})
+	}
+	return result
+}
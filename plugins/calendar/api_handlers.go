@@ -0,0 +1,473 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiCalendar loads the calendar in the URL, which must belong to the user
+func apiCalendar(kit *kit.Kit) (Calendar, error) {
+	calendarID, err := apiURLID(chi.URLParam(kit.Request, "id"), "calendar")
+	if err != nil {
+		return Calendar{}, err
+	}
+	return GetCalendar(calendarID, kit.Auth().(auth.Auth).UserID)
+}
+
+// HandleAPICalendarList lists the calendars of the user
+func HandleAPICalendarList(kit *kit.Kit) error {
+	page, err := apiPagination(kit)
+	if err != nil {
+		return err
+	}
+	calendars, err := ListCalendars(kit.Auth().(auth.Auth).UserID)
+	if err != nil {
+		return err
+	}
+	items := make([]APICalendar, len(calendars))
+	for i, calendar := range calendars {
+		items[i] = newAPICalendar(calendar)
+	}
+	return writeAPIJSON(kit, http.StatusOK, apiPage(items, page))
+}
+
+// HandleAPICalendarCreate creates a calendar
+func HandleAPICalendarCreate(kit *kit.Kit) error {
+	var input APICalendarInput
+	if err := decodeAPIJSON(kit, &input); err != nil {
+		return err
+	}
+	values := CalendarFormValues{Name: input.Name, Work: input.Work, Hours: input.DailyWorkHours, SharedWorkday: input.SharedWorkday}
+	errors, ok := v.Validate(values, calendarSchema)
+	if values.Hours < 0 || values.Hours > 24 {
+		errors.Add("daily_work_hours", "Daily work hours must be between 0 and 24")
+		ok = false
+	}
+	if !ok {
+		return apiValidationError(errors, nil)
+	}
+
+	calendar, err := CreateCalendar(values.Name, values.Work, values.Hours, values.SharedWorkday, kit.Auth().(auth.Auth).UserID)
+	if err != nil {
+		return err
+	}
+	kit.Response.Header().Set("Location", fmt.Sprintf("/api/v1/calendars/%d", calendar.ID))
+	return writeAPIJSON(kit, http.StatusCreated, newAPICalendar(calendar))
+}
+
+// HandleAPICalendarGet returns a calendar
+func HandleAPICalendarGet(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	return writeAPIJSON(kit, http.StatusOK, newAPICalendar(calendar))
+}
+
+// apiEntryFilter reads the entry list filter from the query parameters
+func apiEntryFilter(kit *kit.Kit) (AgendaFilter, error) {
+	query := kit.Request.URL.Query()
+	filter := AgendaFilter{Text: query.Get("q"), Sort: query.Get("sort")}
+	var err error
+	if value := query.Get("from"); value != "" {
+		if filter.From, err = time.Parse("2006-01-02", value); err != nil {
+			return filter, apiErrorf(http.StatusBadRequest, "invalid_parameter", "from must be a date in YYYY-MM-DD format")
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if filter.To, err = time.Parse("2006-01-02", value); err != nil {
+			return filter, apiErrorf(http.StatusBadRequest, "invalid_parameter", "to must be a date in YYYY-MM-DD format")
+		}
+	}
+	if value := query.Get("work_resource_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return filter, apiErrorf(http.StatusBadRequest, "invalid_parameter", "work_resource_id must be a resource ID")
+		}
+		filter.WorkResourceID = uint(id)
+	}
+	if _, ok := AgendaSortOptions[filter.Sort]; filter.Sort != "" && !ok {
+		return filter, apiErrorf(http.StatusBadRequest, "invalid_parameter", "sort must be one of date_desc, date_asc, hours_desc or hours_asc")
+	}
+	return filter, nil
+}
+
+// HandleAPIEntryList lists the entries of a calendar, filtered by date range, resource and text
+func HandleAPIEntryList(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	page, err := apiPagination(kit)
+	if err != nil {
+		return err
+	}
+	filter, err := apiEntryFilter(kit)
+	if err != nil {
+		return err
+	}
+	filter.Limit, filter.Offset = page.Limit, page.Offset
+
+	entries, err := ListAgendaEntries(calendar.ID, filter)
+	if err != nil {
+		return err
+	}
+	totals, err := SumAgendaEntries(calendar.ID, filter)
+	if err != nil {
+		return err
+	}
+	page.Total = totals.Entries
+	items := make([]APIEntry, len(entries))
+	for i, entry := range entries {
+		items[i] = newAPIEntry(entry)
+	}
+	return writeAPIJSON(kit, http.StatusOK, APIList[APIEntry]{Data: items, Pagination: page})
+}
+
+// validateAPIEntry validates an entry request body with the rules of the entry forms
+func validateAPIEntry(calendar Calendar, input APIEntryInput) (CalendarEntryFormValues, time.Time, error) {
+	values := CalendarEntryFormValues{
+		Date:           input.Date,
+		Hours:          input.Hours,
+		Text:           input.Text,
+		WorkResourceID: input.WorkResourceID,
+		Tags:           strings.Join(input.Tags, ","),
+		StartTime:      input.StartTime,
+		EndTime:        input.EndTime,
+	}
+	errors, ok := v.Validate(values, calendarEntrySchema)
+
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return values, time.Time{}, err
+	}
+	if !validateEntryResource(values, WorkResourceTaskItems(resources), errors) {
+		ok = false
+	}
+	if !validateEntryTimes(values, errors) {
+		ok = false
+	}
+	date, err := time.Parse("2006-01-02", values.Date)
+	if err != nil && values.Date != "" {
+		errors.Add("date", "Invalid date format. Please use YYYY-MM-DD.")
+		ok = false
+	}
+	if !ok {
+		return values, date, apiValidationError(errors, apiEntryFields)
+	}
+	return values, date, nil
+}
+
+// HandleAPIEntryCreate creates an entry in a calendar
+func HandleAPIEntryCreate(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	var input APIEntryInput
+	if err := decodeAPIJSON(kit, &input); err != nil {
+		return err
+	}
+	values, date, err := validateAPIEntry(calendar, input)
+	if err != nil {
+		return err
+	}
+
+	entry, err := CreateCalendarEntry(calendar.ID, kit.Auth().(auth.Auth).UserID, date, values)
+	if err != nil {
+		return err
+	}
+	kit.Response.Header().Set("Location", fmt.Sprintf("/api/v1/calendars/%d/entries/%d", calendar.ID, entry.ID))
+	return writeAPIJSON(kit, http.StatusCreated, newAPIEntry(entry))
+}
+
+// apiEntry loads the entry in the URL, which must belong to the calendar
+func apiEntry(kit *kit.Kit, calendar Calendar) (CalendarEntry, error) {
+	entryID, err := apiURLID(chi.URLParam(kit.Request, "entry_id"), "entry")
+	if err != nil {
+		return CalendarEntry{}, err
+	}
+	entry, err := GetCalendarEntry(entryID)
+	if err != nil {
+		return entry, err
+	}
+	if entry.CalendarID != calendar.ID {
+		return entry, apiErrorf(http.StatusNotFound, "not_found", "entry %d not found in calendar %d", entryID, calendar.ID)
+	}
+	return entry, nil
+}
+
+// HandleAPIEntryGet returns an entry of a calendar
+func HandleAPIEntryGet(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := apiEntry(kit, calendar)
+	if err != nil {
+		return err
+	}
+	return writeAPIJSON(kit, http.StatusOK, newAPIEntry(entry))
+}
+
+// HandleAPIEntryUpdate replaces an entry of a calendar
+func HandleAPIEntryUpdate(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := apiEntry(kit, calendar)
+	if err != nil {
+		return err
+	}
+	var input APIEntryInput
+	if err := decodeAPIJSON(kit, &input); err != nil {
+		return err
+	}
+	values, date, err := validateAPIEntry(calendar, input)
+	if err != nil {
+		return err
+	}
+
+	entry, err = UpdateCalendarEntry(entry.ID, kit.Auth().(auth.Auth).UserID, date, values)
+	if err != nil {
+		return err
+	}
+	return writeAPIJSON(kit, http.StatusOK, newAPIEntry(entry))
+}
+
+// HandleAPIEntryDelete deletes an entry of a calendar
+func HandleAPIEntryDelete(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := apiEntry(kit, calendar)
+	if err != nil {
+		return err
+	}
+	if err := DeleteCalendarEntry(entry); err != nil {
+		return err
+	}
+	return writeAPINoContent(kit)
+}
+
+// apiWorkResources loads the resources of the calendar in tree order
+func apiWorkResources(calendar Calendar) ([]WorkResource, []WorkResourceTreeItem, error) {
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resources, BuildWorkResourceTree(resources), nil
+}
+
+// findWorkResourceItem returns the tree item of a resource
+func findWorkResourceItem(tree []WorkResourceTreeItem, id uint) (WorkResourceTreeItem, bool) {
+	for _, item := range tree {
+		if item.Resource.ID == id {
+			return item, true
+		}
+	}
+	return WorkResourceTreeItem{}, false
+}
+
+// apiWorkResource loads the resource in the URL, which must be a resource of the calendar.
+// Shared resources can be read but are changed from the shared resources of the user.
+func apiWorkResource(kit *kit.Kit, calendar Calendar, tree []WorkResourceTreeItem, change bool) (WorkResourceTreeItem, error) {
+	resourceID, err := apiURLID(chi.URLParam(kit.Request, "resource_id"), "resource")
+	if err != nil {
+		return WorkResourceTreeItem{}, err
+	}
+	item, ok := findWorkResourceItem(tree, resourceID)
+	if !ok {
+		return item, apiErrorf(http.StatusNotFound, "not_found", "resource %d not found in calendar %d", resourceID, calendar.ID)
+	}
+	if change && item.Resource.IsShared() {
+		return item, apiErrorf(http.StatusConflict, "shared_resource", "resource %d is shared and cannot be changed through a calendar", resourceID)
+	}
+	return item, nil
+}
+
+// validateAPIWorkResource validates a work resource request body with the rules of the resource forms
+func validateAPIWorkResource(input APIWorkResourceInput, resourceID uint, resources []WorkResource) (WorkResourceFormValues, error) {
+	values := WorkResourceFormValues{
+		Name:                input.Name,
+		Kind:                input.Kind,
+		ParentID:            input.ParentID,
+		ResourcesPercentage: input.ResourcesPercentage,
+	}
+	errors, ok := v.Validate(values, workResourceSchema)
+	if !validateResourcesPercentage(values, errors) {
+		ok = false
+	}
+	if !validateResourceHierarchy(&values, resourceID, false, resources, errors) {
+		ok = false
+	}
+	if !ok {
+		return values, apiValidationError(errors, apiWorkResourceFields)
+	}
+	return values, nil
+}
+
+// HandleAPIWorkResourceList lists the resources of a calendar in tree order
+func HandleAPIWorkResourceList(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	page, err := apiPagination(kit)
+	if err != nil {
+		return err
+	}
+	_, tree, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	items := make([]APIWorkResource, len(tree))
+	for i, item := range tree {
+		items[i] = newAPIWorkResource(item)
+	}
+	return writeAPIJSON(kit, http.StatusOK, apiPage(items, page))
+}
+
+// HandleAPIWorkResourceCreate creates a resource in a calendar
+func HandleAPIWorkResourceCreate(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	var input APIWorkResourceInput
+	if err := decodeAPIJSON(kit, &input); err != nil {
+		return err
+	}
+	resources, _, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	values, err := validateAPIWorkResource(input, 0, resources)
+	if err != nil {
+		return err
+	}
+
+	resource, err := CreateWorkResource(values.Name, kit.Auth().(auth.Auth).UserID, calendar.ID, values.ParentID, values.Kind, values.ResourcesPercentage)
+	if err != nil {
+		return err
+	}
+	item, _ := findWorkResourceItem(BuildWorkResourceTree(append(resources, resource)), resource.ID)
+	kit.Response.Header().Set("Location", fmt.Sprintf("/api/v1/calendars/%d/resources/%d", calendar.ID, resource.ID))
+	return writeAPIJSON(kit, http.StatusCreated, newAPIWorkResource(item))
+}
+
+// HandleAPIWorkResourceGet returns a resource of a calendar
+func HandleAPIWorkResourceGet(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	_, tree, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	item, err := apiWorkResource(kit, calendar, tree, false)
+	if err != nil {
+		return err
+	}
+	return writeAPIJSON(kit, http.StatusOK, newAPIWorkResource(item))
+}
+
+// HandleAPIWorkResourceUpdate replaces a resource of a calendar
+func HandleAPIWorkResourceUpdate(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	resources, tree, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	item, err := apiWorkResource(kit, calendar, tree, true)
+	if err != nil {
+		return err
+	}
+	var input APIWorkResourceInput
+	if err := decodeAPIJSON(kit, &input); err != nil {
+		return err
+	}
+	values, err := validateAPIWorkResource(input, item.Resource.ID, resources)
+	if err != nil {
+		return err
+	}
+
+	resource, err := UpdateWorkResource(item.Resource.ID, values.Name, values.ParentID, values.Kind, values.ResourcesPercentage)
+	if err != nil {
+		return err
+	}
+	for i := range resources {
+		if resources[i].ID == resource.ID {
+			resources[i] = resource
+		}
+	}
+	item, _ = findWorkResourceItem(BuildWorkResourceTree(resources), resource.ID)
+	return writeAPIJSON(kit, http.StatusOK, newAPIWorkResource(item))
+}
+
+// HandleAPIWorkResourceDelete deletes a resource of a calendar. Its sub-resources become top level resources.
+func HandleAPIWorkResourceDelete(kit *kit.Kit) error {
+	calendar, err := apiCalendar(kit)
+	if err != nil {
+		return err
+	}
+	_, tree, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	item, err := apiWorkResource(kit, calendar, tree, true)
+	if err != nil {
+		return err
+	}
+	if err := DeleteWorkResource(item.Resource.ID); err != nil {
+		return err
+	}
+	return writeAPINoContent(kit)
+}
+
+// HandleAPIMonthStats returns the work statistics of a calendar month
+func HandleAPIMonthStats(kit *kit.Kit) error {
+	year, yearErr := strconv.Atoi(chi.URLParam(kit.Request, "year"))
+	month, monthErr := strconv.Atoi(chi.URLParam(kit.Request, "month"))
+	if yearErr != nil || monthErr != nil || year < 1 || year > 9999 || month < 1 || month > 12 {
+		return apiErrorf(http.StatusBadRequest, "invalid_parameter", "year and month must form a valid month, e.g. 2026/1")
+	}
+	calendarID, err := apiURLID(chi.URLParam(kit.Request, "id"), "calendar")
+	if err != nil {
+		return err
+	}
+	calendar, err := GetCalendarWithEntriesByMonth(calendarID, kit.Auth().(auth.Auth).UserID, year, month)
+	if err != nil {
+		return err
+	}
+	resources, tree, err := apiWorkResources(calendar)
+	if err != nil {
+		return err
+	}
+	stats := calculateWorkStats(calendar, resources, year, month)
+	return writeAPIJSON(kit, http.StatusOK, newAPIMonthStats(year, month, stats, tree))
+}
+
+// HandleAPINotFound answers unknown API routes
+func HandleAPINotFound(kit *kit.Kit) error {
+	return apiErrorf(http.StatusNotFound, "not_found", "no API route %s %s", kit.Request.Method, kit.Request.URL.Path)
+}
+
+// HandleAPIMethodNotAllowed answers API routes called with an unsupported method
+func HandleAPIMethodNotAllowed(kit *kit.Kit) error {
+	return apiErrorf(http.StatusMethodNotAllowed, "method_not_allowed", "method %s is not allowed on %s", kit.Request.Method, kit.Request.URL.Path)
+}
@@ -0,0 +1,117 @@
+package calendar
+
+import (
+	"net/http"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// apiRoute describes a route of the JSON API. The same table registers the routes and
+// generates the OpenAPI document, so that the document cannot drift from the router.
+type apiRoute struct {
+	Method    string
+	Path      string // chi pattern below /api/v1, path parameters are integer IDs
+	Handler   kit.HandlerFunc
+	Operation string // OpenAPI operationId, also the method name in the Go client
+	Summary   string
+	Query     []apiParam
+	Request   any // zero value of the request body type, nil for none
+	Response  any // zero value of the response body type, nil for 204 responses
+	Status    int // status of a successful response
+}
+
+// apiParam is a query parameter of an API route
+type apiParam struct {
+	Name        string
+	Type        string // OpenAPI type: string or integer
+	Format      string
+	Enum        []string
+	Description string
+}
+
+// apiPaginationParams are the query parameters of every list route
+var apiPaginationParams = []apiParam{
+	{Name: "limit", Type: "integer", Description: "Page size, 1 to 200, 50 by default"},
+	{Name: "offset", Type: "integer", Description: "Number of items to skip"},
+}
+
+// apiRoutes lists every route of the JSON API
+var apiRoutes = []apiRoute{
+	{
+		Method: http.MethodGet, Path: "/calendars", Handler: HandleAPICalendarList,
+		Operation: "ListCalendars", Summary: "List the calendars of the user",
+		Query: apiPaginationParams, Response: APIList[APICalendar]{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodPost, Path: "/calendars", Handler: HandleAPICalendarCreate,
+		Operation: "CreateCalendar", Summary: "Create a calendar",
+		Request: APICalendarInput{}, Response: APICalendar{}, Status: http.StatusCreated,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}", Handler: HandleAPICalendarGet,
+		Operation: "GetCalendar", Summary: "Get a calendar",
+		Response: APICalendar{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}/stats/{year}/{month}", Handler: HandleAPIMonthStats,
+		Operation: "GetMonthStats", Summary: "Get the work statistics of a month",
+		Response: APIMonthStats{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}/entries", Handler: HandleAPIEntryList,
+		Operation: "ListEntries", Summary: "List the entries of a calendar",
+		Query: append([]apiParam{
+			{Name: "from", Type: "string", Format: "date", Description: "First day of the entries"},
+			{Name: "to", Type: "string", Format: "date", Description: "Last day of the entries"},
+			{Name: "work_resource_id", Type: "integer", Description: "Only entries of the resource"},
+			{Name: "q", Type: "string", Description: "Only entries whose text contains the string"},
+			{Name: "sort", Type: "string", Enum: []string{"date_desc", "date_asc", "hours_desc", "hours_asc"}, Description: "Order of the entries, date_desc by default"},
+		}, apiPaginationParams...),
+		Response: APIList[APIEntry]{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodPost, Path: "/calendars/{id}/entries", Handler: HandleAPIEntryCreate,
+		Operation: "CreateEntry", Summary: "Create an entry",
+		Request: APIEntryInput{}, Response: APIEntry{}, Status: http.StatusCreated,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}/entries/{entry_id}", Handler: HandleAPIEntryGet,
+		Operation: "GetEntry", Summary: "Get an entry",
+		Response: APIEntry{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodPut, Path: "/calendars/{id}/entries/{entry_id}", Handler: HandleAPIEntryUpdate,
+		Operation: "UpdateEntry", Summary: "Replace an entry",
+		Request: APIEntryInput{}, Response: APIEntry{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodDelete, Path: "/calendars/{id}/entries/{entry_id}", Handler: HandleAPIEntryDelete,
+		Operation: "DeleteEntry", Summary: "Delete an entry",
+		Status: http.StatusNoContent,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}/resources", Handler: HandleAPIWorkResourceList,
+		Operation: "ListWorkResources", Summary: "List the work resources of a calendar in tree order",
+		Query: apiPaginationParams, Response: APIList[APIWorkResource]{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodPost, Path: "/calendars/{id}/resources", Handler: HandleAPIWorkResourceCreate,
+		Operation: "CreateWorkResource", Summary: "Create a work resource",
+		Request: APIWorkResourceInput{}, Response: APIWorkResource{}, Status: http.StatusCreated,
+	},
+	{
+		Method: http.MethodGet, Path: "/calendars/{id}/resources/{resource_id}", Handler: HandleAPIWorkResourceGet,
+		Operation: "GetWorkResource", Summary: "Get a work resource",
+		Response: APIWorkResource{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodPut, Path: "/calendars/{id}/resources/{resource_id}", Handler: HandleAPIWorkResourceUpdate,
+		Operation: "UpdateWorkResource", Summary: "Replace a work resource",
+		Request: APIWorkResourceInput{}, Response: APIWorkResource{}, Status: http.StatusOK,
+	},
+	{
+		Method: http.MethodDelete, Path: "/calendars/{id}/resources/{resource_id}", Handler: HandleAPIWorkResourceDelete,
+		Operation: "DeleteWorkResource", Summary: "Delete a work resource, its sub-resources become top level resources",
+		Status: http.StatusNoContent,
+	},
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gothstack/plugins/auth"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -29,6 +30,7 @@ type CalendarFormValues struct {
 	Name           string  `form:"name"`
 	Work           bool    `form:"work"`
 	Hours          float64 `form:"hours"`
+	SharedWorkday  bool    `form:"shared_workday"`
 	SuccessMessage string
 }
 
@@ -57,7 +59,7 @@ func HandleCalendarCreatePost(kit *kit.Kit) error {
 	}
 	auth := kit.Auth().(auth.Auth)
 	userID := auth.UserID
-	calendar, err := CreateCalendar(values.Name, values.Work, values.Hours, userID)
+	calendar, err := CreateCalendar(values.Name, values.Work, values.Hours, values.SharedWorkday, userID)
 	if err != nil {
 		return kit.Render(CalendarForm(values, errors))
 	}
@@ -66,19 +68,111 @@ func HandleCalendarCreatePost(kit *kit.Kit) error {
 	return kit.Render(CalendarForm(CalendarFormValues{SuccessMessage: values.SuccessMessage}, errors))
 }
 
-// HandleCalendarView handles viewing a specific calendar
+// agendaPageSize is the number of entries per agenda page
+const agendaPageSize = 50
+
+// AgendaPageData holds data for the agenda view of a calendar
+type AgendaPageData struct {
+	Calendar      Calendar
+	Resources     []WorkResourceTreeItem
+	TotalResource int
+	Values        AgendaFormValues
+	Entries       []CalendarEntry
+	Totals        AgendaTotals
+	Page          int
+	PageCount     int
+}
+
+// AgendaFormValues holds the agenda filter form, read from the query string
+type AgendaFormValues struct {
+	From           string // "2006-01-02"
+	To             string // "2006-01-02"
+	WorkResourceID uint
+	Text           string
+	MinHours       string
+	MaxHours       string
+	Sort           string
+}
+
+// PageURL returns the agenda URL of the calendar for another page with the same filters
+func (values AgendaFormValues) PageURL(calendarID uint, page int) string {
+	query := url.Values{}
+	query.Set("from", values.From)
+	query.Set("to", values.To)
+	query.Set("resource", strconv.FormatUint(uint64(values.WorkResourceID), 10))
+	query.Set("text", values.Text)
+	query.Set("min_hours", values.MinHours)
+	query.Set("max_hours", values.MaxHours)
+	query.Set("sort", values.Sort)
+	query.Set("page", strconv.Itoa(page))
+	return fmt.Sprintf("/calendars/%d?%s", calendarID, query.Encode())
+}
+
+// SortedByDate reports whether the agenda is in date order, so entries can be grouped by week and day
+func (values AgendaFormValues) SortedByDate() bool {
+	return values.Sort == "date_desc" || values.Sort == "date_asc"
+}
+
+// HandleCalendarView renders the paginated agenda of a calendar.
+// The date range defaults to the current month.
 func HandleCalendarView(kit *kit.Kit) error {
 
 	yearStr := kit.Request.URL.Query().Get("year")
 	monthStr := kit.Request.URL.Query().Get("month")
 	if yearStr != "" || monthStr != "" {
-		return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%s/month?year=%s?month=%s", chi.URLParam(kit.Request, "id"), yearStr, monthStr))
+		return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%s/month?year=%s&month=%s", chi.URLParam(kit.Request, "id"), yearStr, monthStr))
 	}
 
 	idStr := chi.URLParam(kit.Request, "id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		return fmt.Errorf("invalid meal option ID: %w", err)
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+
+	query := kit.Request.URL.Query()
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	values := AgendaFormValues{
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Text:     query.Get("text"),
+		MinHours: query.Get("min_hours"),
+		MaxHours: query.Get("max_hours"),
+		Sort:     query.Get("sort"),
+	}
+	if _, ok := AgendaSortOptions[values.Sort]; !ok {
+		values.Sort = "date_desc"
+	}
+	// Entry dates are stored as UTC midnight, so the range bounds are too
+	filter := AgendaFilter{Text: values.Text, Sort: values.Sort, Limit: agendaPageSize}
+	if filter.From, err = time.Parse("2006-01-02", values.From); err != nil {
+		filter.From = monthStart
+		values.From = filter.From.Format("2006-01-02")
+	}
+	if filter.To, err = time.Parse("2006-01-02", values.To); err != nil {
+		filter.To = monthStart.AddDate(0, 1, -1)
+		values.To = filter.To.Format("2006-01-02")
+	}
+	if resourceID, err := strconv.ParseUint(query.Get("resource"), 10, 32); err == nil {
+		values.WorkResourceID = uint(resourceID)
+		filter.WorkResourceID = uint(resourceID)
+	}
+	if h, err := strconv.ParseFloat(values.MinHours, 64); err == nil {
+		filter.MinHours = h
+	}
+	if h, err := strconv.ParseFloat(values.MaxHours, 64); err == nil {
+		filter.MaxHours = h
+	}
+	page := 1
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 1 {
+		page = p
+	}
+	filter.Offset = (page - 1) * agendaPageSize
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(id), userID)
+	if err != nil {
+		return err
 	}
 	resources, err := ListWorkResourcesByCalendar(uint(id))
 	if err != nil {
@@ -88,15 +182,25 @@ func HandleCalendarView(kit *kit.Kit) error {
 	for _, resource := range resources {
 		total += resource.ResourcesPercentage
 	}
-	userID := kit.Auth().(auth.Auth).UserID
-	calendar, err := GetCalendarWithEntries(uint(id), userID)
+	entries, err := ListAgendaEntries(calendar.ID, filter)
 	if err != nil {
 		return err
 	}
-	now := time.Now()
-	year, month, _ := now.Date()
-	//get current year and month
-	return kit.Render(CalendarView(calendar, resources, total, year, int(month)))
+	totals, err := SumAgendaEntries(calendar.ID, filter)
+	if err != nil {
+		return err
+	}
+
+	return kit.Render(CalendarView(AgendaPageData{
+		Calendar:      calendar,
+		Resources:     BuildWorkResourceTree(resources),
+		TotalResource: total,
+		Values:        values,
+		Entries:       entries,
+		Totals:        totals,
+		Page:          page,
+		PageCount:     int((totals.Entries + agendaPageSize - 1) / agendaPageSize),
+	}))
 }
 
 // WorkMonthStats holds statistics about working hours for a month
@@ -109,10 +213,13 @@ type WorkMonthStats struct {
 	ResourceStats  map[uint]ResourceMonthStats // Stats per resource
 }
 
-// ResourceMonthStats holds statistics for a single resource in a month
+// ResourceMonthStats holds statistics for a single resource in a month.
+// Clients and projects include the allocation and hours of everything below them.
 type ResourceMonthStats struct {
 	ResourceID   uint
 	ResourceName string
+	Kind         string
+	ParentID     uint
 	Percentage   int
 	TargetHours  float64 // Target hours for this resource
 	LoggedHours  float64 // Hours logged for this resource
@@ -175,7 +282,7 @@ func HandleCalendarViewByMonth(kit *kit.Kit) error {
 	workStats := calculateWorkStats(calendar, resources, currentYear, currentMonth)
 
 	// Render the view
-	return kit.Render(CalendarViewMonthly(calendar, resources, totalResource, currentYear, currentMonth, workStats))
+	return kit.Render(CalendarViewMonthly(calendar, BuildWorkResourceTree(resources), totalResource, currentYear, currentMonth, workStats))
 }
 
 // calculateWorkStats calculates work statistics for a given month
@@ -219,6 +326,8 @@ func calculateWorkStats(calendar Calendar, resources []WorkResource, year, month
 		stats.ResourceStats[resource.ID] = ResourceMonthStats{
 			ResourceID:   resource.ID,
 			ResourceName: resource.Name,
+			Kind:         resource.Kind,
+			ParentID:     resource.ParentID,
 			Percentage:   resource.ResourcesPercentage,
 			TargetHours:  resourceTarget,
 			LoggedHours:  0,
@@ -235,12 +344,36 @@ func calculateWorkStats(calendar Calendar, resources []WorkResource, year, month
 		if entry.WorkResourceID > 0 {
 			if resourceStats, exists := stats.ResourceStats[entry.WorkResourceID]; exists {
 				resourceStats.LoggedHours += entry.Hours
-				resourceStats.Progress = (resourceStats.LoggedHours / resourceStats.TargetHours) * 100
 				stats.ResourceStats[entry.WorkResourceID] = resourceStats
 			}
 		}
 	}
 
+	// Roll task allocations and hours up to their projects and clients
+	resourcesByID := make(map[uint]WorkResource, len(resources))
+	for _, resource := range resources {
+		resourcesByID[resource.ID] = resource
+	}
+	ownStats := make(map[uint]ResourceMonthStats, len(stats.ResourceStats))
+	for id, resourceStats := range stats.ResourceStats {
+		ownStats[id] = resourceStats
+	}
+	for id, resourceStats := range ownStats {
+		for _, ancestorID := range workResourceAncestors(id, resourcesByID) {
+			ancestorStats := stats.ResourceStats[ancestorID]
+			ancestorStats.Percentage += resourceStats.Percentage
+			ancestorStats.TargetHours += resourceStats.TargetHours
+			ancestorStats.LoggedHours += resourceStats.LoggedHours
+			stats.ResourceStats[ancestorID] = ancestorStats
+		}
+	}
+	for id, resourceStats := range stats.ResourceStats {
+		if resourceStats.TargetHours > 0 {
+			resourceStats.Progress = (resourceStats.LoggedHours / resourceStats.TargetHours) * 100
+			stats.ResourceStats[id] = resourceStats
+		}
+	}
+
 	stats.LoggedHours = totalLogged
 	if stats.TotalWorkHours > 0 {
 		stats.Progress = (stats.LoggedHours / stats.TotalWorkHours) * 100
@@ -0,0 +1,233 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVDateFormats are the date formats the CSV import understands, keyed by Go layout
+var CSVDateFormats = []struct {
+	Layout string
+	Label  string
+}{
+	{"2006-01-02", "2026-01-31 (ISO)"},
+	{"2.1.2006", "31.1.2026 (Finnish)"},
+	{"2/1/2006", "31/1/2026 (day first)"},
+	{"1/2/2006", "1/31/2026 (month first)"},
+}
+
+// CSVImportDelimiters maps the delimiter options of the CSV import to their runes
+var CSVImportDelimiters = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+}
+
+// CSVImportMapping tells which column holds which entry field, -1 for unmapped columns
+type CSVImportMapping struct {
+	Date       int
+	Hours      int
+	Text       int
+	Resource   int
+	DateFormat string // one of CSVDateFormats
+	Delimiter  string // one of CSVImportDelimiters
+	Header     bool   // the first row holds column names
+}
+
+// CSVImportRow is a parsed data row of an imported CSV file
+type CSVImportRow struct {
+	Line   int // line number in the file, for error reports
+	Entry  CalendarEntry
+	Errors []string
+}
+
+// CSVImportResult is the outcome of parsing every row of an imported CSV file
+type CSVImportResult struct {
+	Rows      []CSVImportRow
+	Invalid   []CSVImportRow // rows with errors
+	Hours     float64        // total hours of the valid rows
+	From, To  time.Time      // date range of the valid rows
+	Resources int            // distinct resources of the valid rows
+}
+
+// detectCSVDelimiter returns the delimiter option that occurs most on the first line
+func detectCSVDelimiter(content []byte) string {
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	best, count := "comma", 0
+	for option, delimiter := range CSVImportDelimiters {
+		if n := bytes.Count(firstLine, []byte(string(delimiter))); n > count {
+			best, count = option, n
+		}
+	}
+	return best
+}
+
+// readCSVRecords reads every record of the file, which may start with a byte order mark
+func readCSVRecords(content []byte, delimiter string) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.Comma = CSVImportDelimiters[delimiter]
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+	}
+	return records, nil
+}
+
+// CSVColumnNames returns the names of the columns, from the header row when there is one
+func CSVColumnNames(records [][]string, header bool) []string {
+	width := 0
+	for _, record := range records {
+		width = max(width, len(record))
+	}
+	names := make([]string, width)
+	for i := range names {
+		names[i] = fmt.Sprintf("Column %d", i+1)
+		if header && len(records) > 0 && i < len(records[0]) && strings.TrimSpace(records[0][i]) != "" {
+			names[i] = strings.TrimSpace(records[0][i])
+		}
+	}
+	return names
+}
+
+// guessCSVMapping maps columns whose header names look like entry fields
+func guessCSVMapping(names []string) CSVImportMapping {
+	mapping := CSVImportMapping{Date: -1, Hours: -1, Text: -1, Resource: -1}
+	guesses := []struct {
+		field *int
+		words []string
+	}{
+		{&mapping.Date, []string{"date", "day", "päivä", "pvm"}},
+		{&mapping.Hours, []string{"hours", "hour", "duration", "time", "tunnit", "h"}},
+		{&mapping.Text, []string{"text", "description", "notes", "note", "kuvaus"}},
+		{&mapping.Resource, []string{"resource", "project", "projekti"}},
+	}
+	for _, guess := range guesses {
+		for i, name := range names {
+			if *guess.field >= 0 {
+				break
+			}
+			for _, word := range guess.words {
+				if strings.EqualFold(strings.TrimSpace(name), word) {
+					*guess.field = i
+				}
+			}
+		}
+	}
+	return mapping
+}
+
+// parseCSVHours parses hours written with a decimal point or comma, or as h:mm
+func parseCSVHours(value string) (float64, error) {
+	if hours, minutes, ok := strings.Cut(value, ":"); ok {
+		h, err := strconv.Atoi(hours)
+		if err != nil {
+			return 0, err
+		}
+		m, err := strconv.Atoi(minutes)
+		if err != nil || m < 0 || m >= 60 {
+			return 0, fmt.Errorf("invalid minutes %q", minutes)
+		}
+		return float64(h) + float64(m)/60, nil
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+}
+
+// csvResourceLookup finds tasks by their path or, when unambiguous, by their name
+type csvResourceLookup map[string]uint
+
+// newCSVResourceLookup indexes the tasks by lower case path and name. Names shared
+// by several tasks are left out, so that they have to be written as a path.
+func newCSVResourceLookup(tasks []WorkResourceTreeItem) csvResourceLookup {
+	lookup := make(csvResourceLookup)
+	names := make(map[string]int)
+	for _, task := range tasks {
+		names[strings.ToLower(task.Resource.Name)]++
+	}
+	for _, task := range tasks {
+		if name := strings.ToLower(task.Resource.Name); names[name] == 1 {
+			lookup[name] = task.Resource.ID
+		}
+	}
+	for _, task := range tasks {
+		lookup[strings.ToLower(task.Path)] = task.Resource.ID
+	}
+	return lookup
+}
+
+// ParseCSVImport parses and validates every data row of a CSV file against the mapping
+func ParseCSVImport(calendar Calendar, tasks []WorkResourceTreeItem, records [][]string, mapping CSVImportMapping) CSVImportResult {
+	var result CSVImportResult
+	lookup := newCSVResourceLookup(tasks)
+	resources := make(map[uint]bool)
+	cell := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+
+	for i, record := range records {
+		if i == 0 && mapping.Header {
+			continue
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row := CSVImportRow{Line: i + 1}
+
+		date, err := time.Parse(mapping.DateFormat, cell(record, mapping.Date))
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid date %q", cell(record, mapping.Date)))
+		}
+
+		var hours float64
+		if value := cell(record, mapping.Hours); value != "" {
+			hours, err = parseCSVHours(value)
+			if err != nil || hours < 0 || hours > 24 {
+				row.Errors = append(row.Errors, fmt.Sprintf("invalid hours %q", value))
+			}
+		} else if calendar.Work {
+			row.Errors = append(row.Errors, "missing hours")
+		}
+
+		text := cell(record, mapping.Text)
+		if text == "" {
+			row.Errors = append(row.Errors, "missing text")
+		}
+
+		var resourceID uint
+		if name := cell(record, mapping.Resource); name != "" {
+			var ok bool
+			resourceID, ok = lookup[strings.ToLower(name)]
+			if !ok {
+				row.Errors = append(row.Errors, fmt.Sprintf("unknown or ambiguous resource %q", name))
+			}
+		}
+
+		row.Entry = newCalendarEntry(calendar.ID, date, text, hours, resourceID)
+		result.Rows = append(result.Rows, row)
+		if len(row.Errors) > 0 {
+			result.Invalid = append(result.Invalid, row)
+			continue
+		}
+		result.Hours += hours
+		if result.From.IsZero() || date.Before(result.From) {
+			result.From = date
+		}
+		if date.After(result.To) {
+			result.To = date
+		}
+		if resourceID != 0 {
+			resources[resourceID] = true
+		}
+	}
+	result.Resources = len(resources)
+	return result
+}
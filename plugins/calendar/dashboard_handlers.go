@@ -0,0 +1,144 @@
+package calendar
+
+import (
+	"gothstack/plugins/auth"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// dashboardColors are the colours given to calendars on the dashboard, in calendar order
+var dashboardColors = []string{"bg-blue-500", "bg-green-500", "bg-purple-500", "bg-orange-500", "bg-pink-500", "bg-teal-500"}
+
+// DashboardCalendar holds the month totals of one calendar on the dashboard
+type DashboardCalendar struct {
+	Calendar    Calendar
+	Color       string
+	TargetHours float64 // Zero for calendars that are not work calendars
+	LoggedHours float64
+}
+
+// DashboardDayHours holds the hours a calendar has on a dashboard day
+type DashboardDayHours struct {
+	Calendar *DashboardCalendar
+	Hours    float64
+	Entries  []CalendarEntry
+}
+
+// DashboardDay holds one day of the dashboard month grid
+type DashboardDay struct {
+	DayStats                      // Combined over all calendars, against the combined daily target
+	Calendars []DashboardDayHours // Calendars with entries on this day
+}
+
+// DashboardData holds data for the combined dashboard of all calendars
+type DashboardData struct {
+	Year          int
+	Month         int
+	Calendars     []DashboardCalendar
+	LeadingBlanks int // Empty grid cells before the first day so that weeks start on Monday
+	Days          []DashboardDay
+	WorkingDays   int
+	DailyTarget   float64 // Combined daily target of the work calendars
+	TargetHours   float64 // Combined target of the work calendars for the month
+	WorkLogged    float64 // Hours logged in work calendars
+	TotalLogged   float64 // Hours logged in all calendars
+}
+
+// HandleDashboard renders all calendars of the user overlaid in one month grid
+func HandleDashboard(kit *kit.Kit) error {
+	year, month := time.Now().Year(), int(time.Now().Month())
+	if y, err := strconv.Atoi(kit.Request.URL.Query().Get("year")); err == nil {
+		year = y
+	}
+	if m, err := strconv.Atoi(kit.Request.URL.Query().Get("month")); err == nil && m >= 1 && m <= 12 {
+		month = m
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	calendars, err := ListCalendarsWithEntriesByDateRange(userID, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+
+	return kit.Render(Dashboard(calculateDashboard(calendars, year, month)))
+}
+
+// combinedDailyTarget returns the daily target of all work calendars together. The
+// targets of work calendars are summed, except for calendars marked as sharing the
+// working day, e.g. one job split over several calendars. Their hours fall within the
+// day of the other work calendars, so they only raise the target up to their own.
+func combinedDailyTarget(calendars []Calendar) float64 {
+	target, shared := 0.0, 0.0
+	for _, calendar := range calendars {
+		switch {
+		case !calendar.Work:
+		case calendar.SharedWorkday:
+			shared = max(shared, calendar.DailyWorkHours)
+		default:
+			target += calendar.DailyWorkHours
+		}
+	}
+	return max(target, shared)
+}
+
+// calculateDashboard merges the day statistics of every calendar into one month grid
+func calculateDashboard(calendars []Calendar, year, month int) DashboardData {
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	days := start.AddDate(0, 1, -1).Day()
+	data := DashboardData{
+		Year:          year,
+		Month:         month,
+		Calendars:     make([]DashboardCalendar, len(calendars)),
+		LeadingBlanks: (int(start.Weekday()) + 6) % 7,
+		WorkingDays:   calculateWorkStats(Calendar{}, nil, year, month).WorkingDays,
+		DailyTarget:   combinedDailyTarget(calendars),
+	}
+
+	// The combined grid uses a calendar that only carries the combined daily target
+	combined := calculateDayStats(Calendar{DailyWorkHours: data.DailyTarget}, start, days)
+	data.Days = make([]DashboardDay, days)
+	for i := range combined {
+		data.Days[i].DayStats = combined[i]
+	}
+
+	for i, calendar := range calendars {
+		data.Calendars[i] = DashboardCalendar{
+			Calendar: calendar,
+			Color:    dashboardColors[i%len(dashboardColors)],
+		}
+		dashboardCalendar := &data.Calendars[i]
+		stats := calculateWorkStats(calendar, nil, year, month)
+		if calendar.Work {
+			dashboardCalendar.TargetHours = stats.TotalWorkHours
+			data.WorkLogged += stats.LoggedHours
+		}
+		dashboardCalendar.LoggedHours = stats.LoggedHours
+		data.TotalLogged += stats.LoggedHours
+
+		for d, day := range calculateDayStats(calendar, start, days) {
+			if len(day.Entries) == 0 {
+				continue
+			}
+			data.Days[d].Calendars = append(data.Days[d].Calendars, DashboardDayHours{
+				Calendar: dashboardCalendar,
+				Hours:    day.LoggedHours,
+				Entries:  day.Entries,
+			})
+			data.Days[d].Entries = append(data.Days[d].Entries, day.Entries...)
+			data.Days[d].LoggedHours += day.LoggedHours
+			data.Days[d].IsAbsence = data.Days[d].IsAbsence || day.IsAbsence
+		}
+	}
+
+	// Running totals of the combined grid follow the merged logged hours
+	running := 0.0
+	for d := range data.Days {
+		running += data.Days[d].LoggedHours
+		data.Days[d].RunningLogged = running
+	}
+	data.TargetHours = float64(data.WorkingDays) * data.DailyTarget
+	return data
+}
@@ -0,0 +1,220 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// Validation schema for entries added and edited inline in the day view,
+// where the date comes from the URL
+var dayEntrySchema = v.Schema{
+	"text": v.Rules(v.Min(1)), // ensure a non-empty text string
+}
+
+// DayPageData holds data for the day view
+type DayPageData struct {
+	Calendar   Calendar
+	Day        DayStats
+	Tasks      []WorkResourceTreeItem
+	KnownTags  []string
+	FormValues CalendarEntryFormValues // quick add form
+	FormErrors v.Errors
+	EditID     uint // entry being edited inline, zero when none
+	EditValues CalendarEntryFormValues
+	EditErrors v.Errors
+}
+
+// loadDayPageData loads the calendar, entries, tasks and tags of the day in the URL
+func loadDayPageData(kit *kit.Kit) (DayPageData, error) {
+	var data DayPageData
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return data, fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	date, err := time.Parse("2006-01-02", chi.URLParam(kit.Request, "date"))
+	if err != nil {
+		return data, fmt.Errorf("invalid date: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	data.Calendar, err = GetCalendarWithEntriesByDateRange(uint(calendarID), userID, date, date.AddDate(0, 0, 1))
+	if err != nil {
+		return data, err
+	}
+	data.Day = calculateDayStats(data.Calendar, date, 1)[0]
+
+	resources, err := ListWorkResourcesByCalendar(data.Calendar.ID)
+	if err != nil {
+		return data, err
+	}
+	data.Tasks = WorkResourceTaskItems(resources)
+	data.KnownTags, err = ListTagNames(userID)
+	if err != nil {
+		return data, err
+	}
+	data.FormValues = CalendarEntryFormValues{Hours: data.Day.remainingHours()}
+	return data, nil
+}
+
+// remainingHours returns the hours left to reach the daily target, used as the quick add default
+func (d DayStats) remainingHours() float64 {
+	if d.LoggedHours >= d.TargetHours {
+		return 0
+	}
+	return d.TargetHours - d.LoggedHours
+}
+
+// dayEntry returns the entry of the URL if it belongs to the day being shown
+func (data DayPageData) dayEntry(kit *kit.Kit) (CalendarEntry, error) {
+	entryID, err := strconv.ParseUint(chi.URLParam(kit.Request, "entry_id"), 10, 32)
+	if err != nil {
+		return CalendarEntry{}, fmt.Errorf("invalid entry ID: %w", err)
+	}
+	for _, entry := range data.Day.Entries {
+		if entry.ID == uint(entryID) {
+			return entry, nil
+		}
+	}
+	return CalendarEntry{}, fmt.Errorf("entry %d not found on %s", entryID, data.Day.Date.Format("2006-01-02"))
+}
+
+// HandleCalendarViewByDay renders the day view of a calendar
+func HandleCalendarViewByDay(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(CalendarViewDaily(data))
+}
+
+// HandleDayEntries renders the entries of the day view, used to cancel an inline edit
+func HandleDayEntries(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(DayEntries(data))
+}
+
+// HandleDayEntryCreatePost processes the quick add form of the day view
+func HandleDayEntryCreatePost(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+
+	var values CalendarEntryFormValues
+	errors, ok := v.Request(kit.Request, &values, dayEntrySchema)
+	if !validateEntryResource(values, data.Tasks, errors) {
+		ok = false
+	}
+	if !validateEntryTimes(values, errors) {
+		ok = false
+	}
+	if !ok {
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(DayEntries(data))
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	if _, err := CreateCalendarEntry(data.Calendar.ID, userID, data.Day.Date, values); err != nil {
+		errors.Add("general", "Failed to create calendar entry.")
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(DayEntries(data))
+	}
+
+	// Reload so the totals include the new entry
+	data, err = loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(DayEntries(data))
+}
+
+// HandleDayEntryEdit renders the day view entries with the inline edit form of one entry
+func HandleDayEntryEdit(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := data.dayEntry(kit)
+	if err != nil {
+		return err
+	}
+
+	data.EditID = entry.ID
+	data.EditValues = CalendarEntryFormValues{
+		Text:           entry.Text,
+		Hours:          entry.Hours,
+		WorkResourceID: entry.WorkResourceID,
+		Tags:           TagNames(entry.Tags),
+		StartTime:      entry.StartTime,
+		EndTime:        entry.EndTime,
+	}
+	return kit.Render(DayEntries(data))
+}
+
+// HandleDayEntryEditPost processes the inline edit form of the day view
+func HandleDayEntryEditPost(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := data.dayEntry(kit)
+	if err != nil {
+		return err
+	}
+
+	var values CalendarEntryFormValues
+	errors, ok := v.Request(kit.Request, &values, dayEntrySchema)
+	if !validateEntryResource(values, data.Tasks, errors) {
+		ok = false
+	}
+	if !validateEntryTimes(values, errors) {
+		ok = false
+	}
+	if !ok {
+		data.EditID, data.EditValues, data.EditErrors = entry.ID, values, errors
+		return kit.Render(DayEntries(data))
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	if _, err := UpdateCalendarEntry(entry.ID, userID, entry.Date, values); err != nil {
+		errors.Add("general", "Failed to update calendar entry.")
+		data.EditID, data.EditValues, data.EditErrors = entry.ID, values, errors
+		return kit.Render(DayEntries(data))
+	}
+
+	data, err = loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(DayEntries(data))
+}
+
+// HandleDayEntryDelete deletes an entry from the day view and renders the remaining entries
+func HandleDayEntryDelete(kit *kit.Kit) error {
+	data, err := loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	entry, err := data.dayEntry(kit)
+	if err != nil {
+		return err
+	}
+	if err := DeleteCalendarEntry(entry); err != nil {
+		return err
+	}
+
+	data, err = loadDayPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(DayEntries(data))
+}
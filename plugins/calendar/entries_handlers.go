@@ -19,13 +19,43 @@ var calendarEntrySchema = v.Schema{
 	"text": v.Rules(v.Min(1)), // ensure a non-empty text string
 }
 
+// Custom validation that entries are only logged against task resources of the calendar
+func validateEntryResource(values CalendarEntryFormValues, tasks []WorkResourceTreeItem, errors v.Errors) bool {
+	if values.WorkResourceID == 0 {
+		return true
+	}
+	for _, task := range tasks {
+		if task.Resource.ID == values.WorkResourceID {
+			return true
+		}
+	}
+	errors.Add("resource", "Entries must be logged against a task of this calendar")
+	return false
+}
+
+// validateEntryTimes checks that the optional start and end times of an entry are given together
+// as "15:04" and adds an error to the startTime field otherwise
+func validateEntryTimes(values CalendarEntryFormValues, errors v.Errors) bool {
+	if values.StartTime == "" && values.EndTime == "" {
+		return true
+	}
+	_, startErr := time.Parse("15:04", values.StartTime)
+	_, endErr := time.Parse("15:04", values.EndTime)
+	if startErr != nil || endErr != nil {
+		errors.Add("startTime", "Give both a start and an end time, or neither")
+		return false
+	}
+	return true
+}
+
 // CalendarEntryPageData holds data for the calendar entry pages
 type CalendarEntryPageData struct {
 	Calendar      Calendar
-	WorkResources []WorkResource
+	WorkResources []WorkResourceTreeItem
 	FormValues    CalendarEntryFormValues
 	FormErrors    v.Errors
 	EntryID       uint
+	KnownTags     []string
 }
 
 // CalendarEntryFormValues holds form data for calendar entries
@@ -34,6 +64,9 @@ type CalendarEntryFormValues struct {
 	Hours          float64 `form:"hours"`
 	Text           string  `form:"text"`
 	WorkResourceID uint    `form:"resource"`
+	Tags           string  `form:"tags"`       // explicit tags, in addition to #tags written in the text
+	StartTime      string  `form:"start_time"` // optional "15:04", given together with EndTime
+	EndTime        string  `form:"end_time"`
 	SuccessMessage string
 }
 
@@ -78,11 +111,17 @@ func HandleCalendarEntryCreate(kit *kit.Kit) error {
 		Hours: calendar.DailyWorkHours,           // Default hours from calendar
 	}
 
+	knownTags, err := ListTagNames(userID)
+	if err != nil {
+		return err
+	}
+
 	// Render the entry creation form
 	data := CalendarEntryPageData{
 		Calendar:      calendar,
-		WorkResources: resources,
+		WorkResources: WorkResourceTaskItems(resources),
 		FormValues:    formValues,
+		KnownTags:     knownTags,
 	}
 	return kit.Render(CalendarEntryCreate(data))
 }
@@ -111,28 +150,41 @@ func HandleCalendarEntryCreatePost(kit *kit.Kit) error {
 	if err != nil {
 		slog.Error("Failed to list work resources", "error", err)
 	}
+	tasks := WorkResourceTaskItems(resources)
+	knownTags, err := ListTagNames(userID)
+	if err != nil {
+		slog.Error("Failed to list tags", "error", err)
+	}
+
+	if !validateEntryResource(values, tasks, errors) {
+		ok = false
+	}
+	if !validateEntryTimes(values, errors) {
+		ok = false
+	}
 
 	if !ok {
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, 0))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, 0))
 	}
 
 	// Convert the date string to a time.Time value
 	entryDate, err := time.Parse("2006-01-02", values.Date)
 	if err != nil {
 		errors.Add("date", "Invalid date format. Please use YYYY-MM-DD.")
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, 0))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, 0))
 	}
 
 	// Create the new calendar entry
-	entry, err := CreateCalendarEntry(uint(calendarID), entryDate, values.Text, values.Hours, values.WorkResourceID)
+	entry, err := CreateCalendarEntry(uint(calendarID), userID, entryDate, values)
 	if err != nil {
 		errors.Add("general", "Failed to create calendar entry.")
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, 0))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, 0))
 	}
+	knownTags = NormalizeTags(append(knownTags, EntryTags(values.Text, values.Tags)...))
 
 	// Set a success message and re-render the form
 	values.SuccessMessage = fmt.Sprintf("New entry created on %s with ID %d", entryDate.Format("2006-01-02"), entry.ID)
-	return kit.Render(CalendarEntryForm(CalendarEntryFormValues{SuccessMessage: values.SuccessMessage}, errors, calendar, resources, 0))
+	return kit.Render(CalendarEntryForm(CalendarEntryFormValues{SuccessMessage: values.SuccessMessage}, errors, calendar, tasks, knownTags, 0))
 }
 
 // HandleCalendarEntryEdit renders the entry edit form (GET request)
@@ -171,14 +223,23 @@ func HandleCalendarEntryEdit(kit *kit.Kit) error {
 		Text:           entry.Text,
 		Hours:          entry.Hours,
 		WorkResourceID: entry.WorkResourceID,
+		Tags:           TagNames(entry.Tags),
+		StartTime:      entry.StartTime,
+		EndTime:        entry.EndTime,
+	}
+
+	knownTags, err := ListTagNames(userID)
+	if err != nil {
+		return err
 	}
 
 	// Render the calendar entry edit form
 	data := CalendarEntryPageData{
 		Calendar:      calendar,
-		WorkResources: resources,
+		WorkResources: WorkResourceTaskItems(resources),
 		FormValues:    values,
 		EntryID:       uint(entryID),
+		KnownTags:     knownTags,
 	}
 	return kit.Render(CalendarEntryEdit(data))
 }
@@ -216,29 +277,43 @@ func HandleCalendarEntryEditPost(kit *kit.Kit) error {
 	if err != nil {
 		slog.Error("Failed to list work resources", "error", err)
 	}
+	tasks := WorkResourceTaskItems(resources)
+	knownTags, err := ListTagNames(userID)
+	if err != nil {
+		slog.Error("Failed to list tags", "error", err)
+	}
+
+	if !validateEntryResource(values, tasks, errors) {
+		ok = false
+	}
+	if !validateEntryTimes(values, errors) {
+		ok = false
+	}
 
 	if !ok {
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, uint(entryID)))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, uint(entryID)))
 	}
 
 	// Parse the date
 	entryDate, err := time.Parse("2006-01-02", values.Date)
 	if err != nil {
 		errors.Add("date", "Invalid date format. Please use YYYY-MM-DD.")
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, uint(entryID)))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, uint(entryID)))
 	}
 
 	// Update the calendar entry
 	// year, month, week := getDateComponents(entryDate)
-	updatedEntry, err := UpdateCalendarEntry(uint(entryID), entryDate, values.Text, values.Hours, values.WorkResourceID)
+	updatedEntry, err := UpdateCalendarEntry(uint(entryID), userID, entryDate, values)
 	if err != nil {
 		errors.Add("general", "Failed to update calendar entry.")
-		return kit.Render(CalendarEntryForm(values, errors, calendar, resources, uint(entryID)))
+		return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, uint(entryID)))
 	}
+	values.Tags = TagNames(updatedEntry.Tags)
+	knownTags = NormalizeTags(append(knownTags, EntryTags(values.Text, values.Tags)...))
 
 	// Set a success message
 	values.SuccessMessage = fmt.Sprintf("Entry updated successfully on %s", updatedEntry.Date.Format("2006-01-02"))
-	return kit.Render(CalendarEntryForm(values, errors, calendar, resources, uint(entryID)))
+	return kit.Render(CalendarEntryForm(values, errors, calendar, tasks, knownTags, uint(entryID)))
 }
 
 // HandleCalendarEntryDelete processes the request to delete a calendar entry
@@ -259,7 +334,7 @@ func HandleCalendarEntryDelete(kit *kit.Kit) error {
 	calendarID := entry.CalendarID
 
 	// Delete the calendar entry
-	err = DeleteCalendarEntry(uint(entryID))
+	err = DeleteCalendarEntry(entry)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,87 @@
+package calendar
+
+import (
+	"gothstack/app/outbox"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CalendarEvent is the payload of the calendar, entry and work resource events. Data is the
+// API representation of the calendar, entry or work resource, so that event subscribers and
+// webhooks see the same fields as API clients. Deleted objects are sent as they were before.
+type CalendarEvent struct {
+	Event      string    `json:"event"`
+	CalendarID uint      `json:"calendar_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// CalendarEvents lists the events emitted about calendars, in the order shown to users
+var CalendarEvents = []string{
+	CalendarCreatedEvent,
+	CalendarEntryCreatedEvent,
+	CalendarEntryUpdatedEvent,
+	CalendarEntryDeletedEvent,
+	WorkResourceCreatedEvent,
+	WorkResourceUpdatedEvent,
+	WorkResourceDeletedEvent,
+}
+
+// newCalendarEvent returns an event about a calendar occurring now
+func newCalendarEvent(name string, calendarID uint, data any) CalendarEvent {
+	return CalendarEvent{Event: name, CalendarID: calendarID, OccurredAt: time.Now().UTC(), Data: data}
+}
+
+// publishCalendarEvents writes events to the outbox in the transaction of the change they are about
+func publishCalendarEvents(tx *gorm.DB, events ...CalendarEvent) error {
+	for _, evt := range events {
+		if err := outbox.Publish(tx, evt.Event, evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishEntryEvent publishes an event of an entry, which should have its tags loaded
+func publishEntryEvent(tx *gorm.DB, name string, entry CalendarEntry) error {
+	return publishCalendarEvents(tx, newCalendarEvent(name, entry.CalendarID, newAPIEntry(entry)))
+}
+
+// workResourceEvents returns an event of a work resource for each calendar it belongs to:
+// its own calendar, or the calendars a shared resource is attached to. For deletions it is
+// called before deleting, while the resource still has its place in the tree.
+func workResourceEvents(tx *gorm.DB, name string, resource WorkResource) ([]CalendarEvent, error) {
+	calendarIDs := []uint{resource.CalendarID}
+	if resource.IsShared() {
+		calendarIDs = nil
+		err := tx.Model(&CalendarWorkResource{}).Where("work_resource_id = ?", resource.ID).
+			Pluck("calendar_id", &calendarIDs).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var events []CalendarEvent
+	for _, calendarID := range calendarIDs {
+		resources, err := listWorkResourcesByCalendar(tx, calendarID)
+		if err != nil {
+			return nil, err
+		}
+		item, ok := findWorkResourceItem(BuildWorkResourceTree(resources), resource.ID)
+		if !ok {
+			item = WorkResourceTreeItem{Resource: resource, Path: resource.Name}
+		}
+		events = append(events, newCalendarEvent(name, calendarID, newAPIWorkResource(item)))
+	}
+	return events, nil
+}
+
+// publishWorkResourceEvent publishes an event of a created or updated work resource
+func publishWorkResourceEvent(tx *gorm.DB, name string, resource WorkResource) error {
+	events, err := workResourceEvents(tx, name, resource)
+	if err != nil {
+		return err
+	}
+	return publishCalendarEvents(tx, events...)
+}
@@ -0,0 +1,498 @@
+package calendar
+
+import (
+	"encoding/csv"
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"github.com/go-chi/chi/v5"
+)
+
+// EntryCSVColumns are the columns of the entry CSV export, in their default order
+var EntryCSVColumns = []string{"date", "week", "resource", "hours", "text", "type"}
+
+// StatsCSVColumns are the columns of the monthly statistics CSV export, in their default order
+var StatsCSVColumns = []string{"month", "working_days", "resource", "kind", "allocation", "target", "logged", "progress"}
+
+// csvExportBatchSize is the number of entries read from the database at a time while exporting
+const csvExportBatchSize = 500
+
+// maxStatsExportMonths limits the months of a single statistics export
+const maxStatsExportMonths = 60
+
+// Entry types written to exports
+const (
+	EntryTypeWork     = "work"
+	EntryTypePersonal = "personal"
+	EntryTypeAbsence  = "absence"
+)
+
+// EntryType returns the type of an entry for exports: an absence when it carries an
+// absence tag, otherwise work or personal depending on the calendar
+func EntryType(entry CalendarEntry, calendar Calendar) string {
+	switch {
+	case entry.IsAbsence():
+		return EntryTypeAbsence
+	case calendar.Work:
+		return EntryTypeWork
+	default:
+		return EntryTypePersonal
+	}
+}
+
+// CSVOptions holds the configurable layout of a CSV export
+type CSVOptions struct {
+	Columns      []string
+	Delimiter    rune
+	DecimalComma bool // write 7,50 instead of 7.50, as Finnish Excel expects with semicolons
+}
+
+// parseCSVOptions reads the columns, delimiter and decimal query parameters of a CSV export.
+// Columns default to all available columns in their default order.
+func parseCSVOptions(query url.Values, available []string) (CSVOptions, error) {
+	options := CSVOptions{Columns: available, Delimiter: ','}
+	if columns := strings.TrimSpace(query.Get("columns")); columns != "" {
+		options.Columns = nil
+		for _, column := range strings.Split(columns, ",") {
+			column = strings.TrimSpace(column)
+			if !slices.Contains(available, column) {
+				return options, fmt.Errorf("unknown column %q, available columns are %s", column, strings.Join(available, ","))
+			}
+			options.Columns = append(options.Columns, column)
+		}
+	}
+	switch query.Get("delimiter") {
+	case "", "comma", ",":
+		options.Delimiter = ','
+	case "semicolon", ";":
+		options.Delimiter = ';'
+	case "tab", "\t":
+		options.Delimiter = '\t'
+	default:
+		return options, fmt.Errorf("unknown delimiter %q, use comma, semicolon or tab", query.Get("delimiter"))
+	}
+	switch query.Get("decimal") {
+	case "", "point":
+	case "comma":
+		options.DecimalComma = true
+	default:
+		return options, fmt.Errorf("unknown decimal separator %q, use point or comma", query.Get("decimal"))
+	}
+	return options, nil
+}
+
+// formatNumber formats a number with two decimals using the decimal separator of the options
+func (options CSVOptions) formatNumber(value float64) string {
+	number := strconv.FormatFloat(value, 'f', 2, 64)
+	if options.DecimalComma {
+		number = strings.Replace(number, ".", ",", 1)
+	}
+	return number
+}
+
+// newCSVWriter sets the download headers and returns a CSV writer on the response.
+// A byte order mark is written first so that Excel reads the file as UTF-8.
+func newCSVWriter(kit *kit.Kit, filename string, options CSVOptions) (*csv.Writer, error) {
+	kit.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	kit.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	kit.Response.WriteHeader(http.StatusOK)
+	if _, err := kit.Response.Write([]byte("\ufeff")); err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(kit.Response)
+	writer.Comma = options.Delimiter
+	return writer, nil
+}
+
+// entryCSVValue returns the value of an entry for a column of the entry CSV export
+func entryCSVValue(entry CalendarEntry, calendar Calendar, column string, options CSVOptions) string {
+	switch column {
+	case "date":
+		return entry.Date.Format("2006-01-02")
+	case "week":
+		_, week := entry.Date.ISOWeek()
+		return strconv.Itoa(week)
+	case "resource":
+		return entry.WorkResource.Name
+	case "hours":
+		return options.formatNumber(entry.Hours)
+	case "text":
+		return entry.Text
+	case "type":
+		return EntryType(entry, calendar)
+	}
+	return ""
+}
+
+// HandleEntriesCSVExport streams the entries of a calendar within a date range as CSV.
+// The range defaults to the current month.
+func HandleEntriesCSVExport(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	query := kit.Request.URL.Query()
+	options, err := parseCSVOptions(query, EntryCSVColumns)
+	if err != nil {
+		return kit.Text(http.StatusBadRequest, err.Error())
+	}
+
+	// Entry dates are stored as UTC midnight, so the range bounds are too
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+	if d, err := time.Parse("2006-01-02", query.Get("from")); err == nil {
+		from = d
+	}
+	if d, err := time.Parse("2006-01-02", query.Get("to")); err == nil {
+		to = d
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("calendar-%d-entries-%s-%s.csv", calendar.ID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	writer, err := newCSVWriter(kit, filename, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(options.Columns); err != nil {
+		return err
+	}
+	err = StreamEntriesByDateRange(calendar.ID, from, to, csvExportBatchSize, func(entries []CalendarEntry) error {
+		for _, entry := range entries {
+			record := make([]string, len(options.Columns))
+			for i, column := range options.Columns {
+				record[i] = entryCSVValue(entry, calendar, column, options)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// statsCSVRecord returns the record of a resource, or of the whole month when item is nil,
+// for the monthly statistics CSV export
+func statsCSVRecord(month time.Time, stats WorkMonthStats, item *WorkResourceTreeItem, options CSVOptions) []string {
+	values := map[string]string{
+		"month":        month.Format("2006-01"),
+		"working_days": strconv.Itoa(stats.WorkingDays),
+	}
+	if item == nil {
+		values["resource"] = "Total"
+		values["target"] = options.formatNumber(stats.TotalWorkHours)
+		values["logged"] = options.formatNumber(stats.LoggedHours)
+		values["progress"] = options.formatNumber(stats.Progress)
+	} else {
+		resourceStats := stats.ResourceStats[item.Resource.ID]
+		values["resource"] = item.Path
+		values["kind"] = item.Resource.Kind
+		values["allocation"] = strconv.Itoa(resourceStats.Percentage)
+		values["target"] = options.formatNumber(resourceStats.TargetHours)
+		values["logged"] = options.formatNumber(resourceStats.LoggedHours)
+		values["progress"] = options.formatNumber(resourceStats.Progress)
+	}
+
+	record := make([]string, len(options.Columns))
+	for i, column := range options.Columns {
+		record[i] = values[column]
+	}
+	return record
+}
+
+// HandleStatsCSVExport writes the monthly work statistics of a calendar as CSV, one row per
+// resource and a total row for each month. The range defaults to the months of the current year.
+func HandleStatsCSVExport(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	query := kit.Request.URL.Query()
+	options, err := parseCSVOptions(query, StatsCSVColumns)
+	if err != nil {
+		return kit.Text(http.StatusBadRequest, err.Error())
+	}
+
+	from := time.Date(time.Now().Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 11, 0)
+	if d, err := time.Parse("2006-01", query.Get("from")); err == nil {
+		from = d
+	}
+	if d, err := time.Parse("2006-01", query.Get("to")); err == nil {
+		to = d
+	}
+	if to.Before(from) || from.AddDate(0, maxStatsExportMonths-1, 0).Before(to) {
+		return kit.Text(http.StatusBadRequest, fmt.Sprintf("the export range must be 1 to %d months", maxStatsExportMonths))
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return err
+	}
+	tree := BuildWorkResourceTree(resources)
+
+	filename := fmt.Sprintf("calendar-%d-stats-%s-%s.csv", calendar.ID, from.Format("2006-01"), to.Format("2006-01"))
+	writer, err := newCSVWriter(kit, filename, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(options.Columns); err != nil {
+		return err
+	}
+	for month := from; !month.After(to); month = month.AddDate(0, 1, 0) {
+		monthCalendar, err := GetCalendarWithEntriesByMonth(calendar.ID, userID, month.Year(), int(month.Month()))
+		if err != nil {
+			return err
+		}
+		stats := calculateWorkStats(monthCalendar, resources, month.Year(), int(month.Month()))
+		for i := range tree {
+			if err := writer.Write(statsCSVRecord(month, stats, &tree[i], options)); err != nil {
+				return err
+			}
+		}
+		if err := writer.Write(statsCSVRecord(month, stats, nil, options)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// HandleExport renders the export page of a calendar
+func HandleExport(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+	return kit.Render(ExportPage(calendar, time.Now()))
+}
+
+// timesheetSheet builds the xlsx sheet of a month: days as rows, task resources as columns
+// and row and column totals as formulas, so that annotations do not break them
+func timesheetSheet(calendar Calendar, tasks []WorkResourceTreeItem, year, month int) xlsxSheet {
+	first := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	days := calculateDayStats(calendar, first, first.AddDate(0, 1, -1).Day())
+
+	columnOf := make(map[uint]int, len(tasks))
+	header := []xlsxCell{{Value: "Date", Style: xlsxStyleHeader}}
+	widths := []float64{16}
+	for i, task := range tasks {
+		columnOf[task.Resource.ID] = i + 1
+		header = append(header, xlsxCell{Value: task.Path, Style: xlsxStyleHeader})
+		widths = append(widths, 14)
+	}
+	unassigned := len(tasks) + 1
+	total, target, difference, notes := unassigned+1, unassigned+2, unassigned+3, unassigned+4
+	for _, name := range []string{"Unassigned", "Total", "Target", "Difference", "Notes"} {
+		header = append(header, xlsxCell{Value: name, Style: xlsxStyleHeader})
+		widths = append(widths, 12)
+	}
+	widths[notes] = 50
+
+	sheet := xlsxSheet{
+		Name:      fmt.Sprintf("%s %d", time.Month(month), year),
+		Columns:   widths,
+		Rows:      [][]xlsxCell{header},
+		FreezeRow: true,
+	}
+	for r, day := range days {
+		row := r + 1
+		text, date, hours := xlsxStyleDefault, xlsxStyleDate, xlsxStyleHours
+		switch {
+		case day.IsHoliday:
+			text, date, hours = xlsxStyleHoliday, xlsxStyleHolidayDate, xlsxStyleHolidayHours
+		case day.IsWeekend:
+			text, date, hours = xlsxStyleWeekend, xlsxStyleWeekendDate, xlsxStyleWeekendHours
+		}
+
+		cells := make([]xlsxCell, notes+1)
+		for c := range cells {
+			cells[c].Style = hours
+		}
+		cells[0] = xlsxCell{Value: day.Date, Style: date}
+		var texts []string
+		if day.IsHoliday {
+			texts = append(texts, day.HolidayName)
+		}
+		for _, entry := range day.Entries {
+			column, ok := columnOf[entry.WorkResourceID]
+			if !ok {
+				column = unassigned
+			}
+			logged, _ := cells[column].Value.(float64)
+			cells[column].Value = logged + entry.Hours
+			texts = append(texts, entry.Text)
+		}
+		cells[total].Formula = fmt.Sprintf("SUM(%s:%s)", xlsxRef(1, row), xlsxRef(unassigned, row))
+		cells[target].Value = day.TargetHours
+		cells[difference].Formula = fmt.Sprintf("%s-%s", xlsxRef(total, row), xlsxRef(target, row))
+		cells[notes] = xlsxCell{Value: strings.Join(texts, "; "), Style: text}
+		sheet.Rows = append(sheet.Rows, cells)
+	}
+
+	totals := []xlsxCell{{Value: "Total", Style: xlsxStyleHeader}}
+	for c := 1; c <= difference; c++ {
+		totals = append(totals, xlsxCell{
+			Formula: fmt.Sprintf("SUM(%s:%s)", xlsxRef(c, 1), xlsxRef(c, len(days))),
+			Style:   xlsxStyleTotal,
+		})
+	}
+	sheet.Rows = append(sheet.Rows, totals)
+	return sheet
+}
+
+// timesheetSummarySheet builds a sheet that sums the totals rows of the month sheets
+func timesheetSummarySheet(months []xlsxSheet) xlsxSheet {
+	sheet := xlsxSheet{
+		Name:      "Summary",
+		Columns:   []float64{18, 12, 12, 12},
+		FreezeRow: true,
+		Rows: [][]xlsxCell{{
+			{Value: "Month", Style: xlsxStyleHeader},
+			{Value: "Logged", Style: xlsxStyleHeader},
+			{Value: "Target", Style: xlsxStyleHeader},
+			{Value: "Difference", Style: xlsxStyleHeader},
+		}},
+	}
+	for _, month := range months {
+		totalsRow := len(month.Rows) - 1
+		difference := len(month.Rows[totalsRow]) - 1
+		sheet.Rows = append(sheet.Rows, []xlsxCell{
+			{Value: month.Name},
+			{Formula: xlsxSheetRef(month.Name, difference-2, totalsRow), Style: xlsxStyleHours},
+			{Formula: xlsxSheetRef(month.Name, difference-1, totalsRow), Style: xlsxStyleHours},
+			{Formula: xlsxSheetRef(month.Name, difference, totalsRow), Style: xlsxStyleHours},
+		})
+	}
+	last := len(months)
+	sheet.Rows = append(sheet.Rows, []xlsxCell{
+		{Value: "Total", Style: xlsxStyleHeader},
+		{Formula: fmt.Sprintf("SUM(%s:%s)", xlsxRef(1, 1), xlsxRef(1, last)), Style: xlsxStyleTotal},
+		{Formula: fmt.Sprintf("SUM(%s:%s)", xlsxRef(2, 1), xlsxRef(2, last)), Style: xlsxStyleTotal},
+		{Formula: fmt.Sprintf("SUM(%s:%s)", xlsxRef(3, 1), xlsxRef(3, last)), Style: xlsxStyleTotal},
+	})
+	return sheet
+}
+
+// HandleTimesheetXLSXExport writes an xlsx timesheet workbook of a calendar with one sheet
+// per month. Without a month query parameter the whole year is exported with a summary sheet.
+func HandleTimesheetXLSXExport(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	query := kit.Request.URL.Query()
+	year := time.Now().Year()
+	if y, err := strconv.Atoi(query.Get("year")); err == nil {
+		year = y
+	}
+	months := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if m, err := strconv.Atoi(query.Get("month")); err == nil && m >= 1 && m <= 12 {
+		months = []int{m}
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return err
+	}
+	tasks := WorkResourceTaskItems(resources)
+
+	var sheets []xlsxSheet
+	for _, month := range months {
+		monthCalendar, err := GetCalendarWithEntriesByMonth(calendar.ID, userID, year, month)
+		if err != nil {
+			return err
+		}
+		sheets = append(sheets, timesheetSheet(monthCalendar, tasks, year, month))
+	}
+	filename := fmt.Sprintf("calendar-%d-timesheet-%d.xlsx", calendar.ID, year)
+	if len(months) == 1 {
+		filename = fmt.Sprintf("calendar-%d-timesheet-%d-%02d.xlsx", calendar.ID, year, months[0])
+	} else {
+		sheets = append([]xlsxSheet{timesheetSummarySheet(sheets)}, sheets...)
+	}
+
+	kit.Response.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	kit.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return writeXLSX(kit.Response, sheets)
+}
+
+// HandleTimesheetPDFExport writes the printable PDF timesheet of a calendar month with
+// signature lines for the employee and the supervisor. The month defaults to the current month.
+func HandleTimesheetPDFExport(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	query := kit.Request.URL.Query()
+	year, month := time.Now().Year(), int(time.Now().Month())
+	if y, err := strconv.Atoi(query.Get("year")); err == nil {
+		year = y
+	}
+	if m, err := strconv.Atoi(query.Get("month")); err == nil && m >= 1 && m <= 12 {
+		month = m
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendarWithEntriesByMonth(uint(calendarID), userID, year, month)
+	if err != nil {
+		return err
+	}
+	employee, err := GetCalendarOwner(calendar)
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return err
+	}
+
+	first := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	timesheet := timesheetPDF{
+		Calendar: calendar,
+		Employee: employee,
+		Year:     year,
+		Month:    month,
+		Days:     calculateDayStats(calendar, first, first.AddDate(0, 1, -1).Day()),
+		Stats:    calculateWorkStats(calendar, resources, year, month),
+		Tree:     BuildWorkResourceTree(resources),
+	}
+
+	filename := fmt.Sprintf("calendar-%d-timesheet-%d-%02d.pdf", calendar.ID, year, month)
+	kit.Response.Header().Set("Content-Type", "application/pdf")
+	kit.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return timesheet.Write(kit.Response)
+}
@@ -0,0 +1,168 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// Validation schema for the window of a calendar feed
+var feedSchema = v.Schema{
+	"pastDays":   v.Rules(v.GTE(0), v.LTE(MaxFeedWindowDays)),
+	"futureDays": v.Rules(v.GTE(0), v.LTE(MaxFeedWindowDays)),
+}
+
+// FeedFormValues holds form data for the window of a calendar feed
+type FeedFormValues struct {
+	PastDays   int `form:"past_days"`
+	FutureDays int `form:"future_days"`
+}
+
+// FeedPageData holds data for the feed settings page of a calendar
+type FeedPageData struct {
+	Calendar   Calendar
+	Feed       *CalendarFeed // nil when the calendar has no feed
+	URL        string        // absolute URL of the feed
+	FormValues FeedFormValues
+	FormErrors v.Errors
+	Message    string
+}
+
+// requestBaseURL returns the base URL for building absolute URLs. It is APP_URL when set, as
+// the headers of a request are up to the client, or else the scheme and host the request was made to.
+func requestBaseURL(r *http.Request) string {
+	if appURL := kit.Getenv("APP_URL", ""); appURL != "" {
+		return strings.TrimRight(appURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// loadFeedPageData loads the calendar in the URL and its feed
+func loadFeedPageData(kit *kit.Kit) (FeedPageData, error) {
+	var data FeedPageData
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return data, fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	userID := kit.Auth().(auth.Auth).UserID
+	data.Calendar, err = GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return data, err
+	}
+
+	data.FormValues = FeedFormValues{PastDays: DefaultFeedPastDays, FutureDays: DefaultFeedFutureDays}
+	feed, err := GetCalendarFeed(data.Calendar.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return data, nil
+	}
+	if err != nil {
+		return data, err
+	}
+	data.setFeed(kit, feed)
+	return data, nil
+}
+
+// setFeed sets the feed shown on the page
+func (data *FeedPageData) setFeed(kit *kit.Kit, feed CalendarFeed) {
+	data.Feed = &feed
+	data.URL = requestBaseURL(kit.Request) + "/feeds/" + feed.Token + ".ics"
+	data.FormValues = FeedFormValues{PastDays: feed.PastDays, FutureDays: feed.FutureDays}
+}
+
+// HandleCalendarFeedSettings renders the feed settings page of a calendar
+func HandleCalendarFeedSettings(kit *kit.Kit) error {
+	data, err := loadFeedPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(CalendarFeedSettings(data))
+}
+
+// HandleCalendarFeedPost creates the feed of a calendar or updates its window
+func HandleCalendarFeedPost(kit *kit.Kit) error {
+	data, err := loadFeedPageData(kit)
+	if err != nil {
+		return err
+	}
+
+	var values FeedFormValues
+	errors, ok := v.Request(kit.Request, &values, feedSchema)
+	if !ok {
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(CalendarFeedSettings(data))
+	}
+
+	created := data.Feed == nil
+	feed, err := SaveCalendarFeed(data.Calendar.ID, values.PastDays, values.FutureDays)
+	if err != nil {
+		errors.Add("general", "Failed to save the feed.")
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(CalendarFeedSettings(data))
+	}
+	data.setFeed(kit, feed)
+	data.Message = "Feed window saved."
+	if created {
+		data.Message = "Feed created. Subscribe to the URL below in your calendar application."
+	}
+	return kit.Render(CalendarFeedSettings(data))
+}
+
+// HandleCalendarFeedRegenerate replaces the token of the feed, so that the previous URL stops working
+func HandleCalendarFeedRegenerate(kit *kit.Kit) error {
+	data, err := loadFeedPageData(kit)
+	if err != nil {
+		return err
+	}
+	feed, err := RegenerateCalendarFeedToken(data.Calendar.ID)
+	if err != nil {
+		return err
+	}
+	data.setFeed(kit, feed)
+	data.Message = "Feed URL regenerated. Subscriptions to the previous URL no longer work."
+	return kit.Render(CalendarFeedSettings(data))
+}
+
+// HandleCalendarFeedRevoke deletes the feed of a calendar
+func HandleCalendarFeedRevoke(kit *kit.Kit) error {
+	data, err := loadFeedPageData(kit)
+	if err != nil {
+		return err
+	}
+	if err := RevokeCalendarFeed(data.Calendar.ID); err != nil {
+		return err
+	}
+	return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%d/feed", data.Calendar.ID))
+}
+
+// HandleCalendarFeed serves the iCalendar feed of the token in the URL. The token is the
+// only credential, so unknown tokens get a plain 404 without revealing anything else.
+func HandleCalendarFeed(kit *kit.Kit) error {
+	feed, err := GetCalendarFeedByToken(chi.URLParam(kit.Request, "token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && feed.Calendar.ID == 0) {
+		return kit.Text(http.StatusNotFound, "feed not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	kit.Response.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	kit.Response.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"calendar-%d.ics\"", feed.CalendarID))
+	kit.Response.Header().Set("Cache-Control", "private, max-age=300")
+	return WriteCalendarFeed(kit.Response, feed, time.Now())
+}
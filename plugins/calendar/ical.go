@@ -0,0 +1,184 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icalProductID identifies this application in the PRODID of generated iCalendar data
+const icalProductID = "-//gothstack//calendar//EN"
+
+// icalWriter writes RFC 5545 content lines, escaping values and folding lines longer than 75 octets
+type icalWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Line writes a property with an already formatted value. Once a write has failed the
+// following writes are skipped and the error is returned by Err.
+func (iw *icalWriter) Line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+	line := name + ":" + value
+	var builder strings.Builder
+	for len(line) > 75 {
+		// Fold on a rune boundary, continuation lines start with a space
+		cut := 75
+		if builder.Len() > 0 {
+			cut = 74
+		}
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		builder.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	builder.WriteString(line + "\r\n")
+	_, iw.err = io.WriteString(iw.w, builder.String())
+}
+
+// Text writes a property with a TEXT value
+func (iw *icalWriter) Text(name, value string) {
+	iw.Line(name, icalEscape(value))
+}
+
+// Err returns the first error of the writes
+func (iw *icalWriter) Err() error {
+	return iw.err
+}
+
+// icalEscape escapes a TEXT value
+func icalEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(text)
+}
+
+// icalDate formats a date as a DATE value
+func icalDate(date time.Time) string {
+	return date.Format("20060102")
+}
+
+// icalUTC formats an instant as a UTC DATE-TIME value
+func icalUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icalEntryTimes returns the local start and end of a timed entry. Times are stored without
+// a time zone, so they are written as floating times shown as is in every time zone.
+// An end before the start is on the next day.
+func icalEntryTimes(entry CalendarEntry) (string, string, error) {
+	start, err := time.Parse("2006-01-02 15:04", entry.Date.Format("2006-01-02")+" "+entry.StartTime)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid start time of entry %d: %w", entry.ID, err)
+	}
+	end, err := time.Parse("2006-01-02 15:04", entry.Date.Format("2006-01-02")+" "+entry.EndTime)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid end time of entry %d: %w", entry.ID, err)
+	}
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start.Format("20060102T150405"), end.Format("20060102T150405"), nil
+}
+
+// writeICalEntry writes an entry as a VEVENT, timed when the entry has a start and end time
+// and all-day otherwise
+func writeICalEntry(iw *icalWriter, calendar Calendar, entry CalendarEntry) error {
+	iw.Line("BEGIN", "VEVENT")
+	iw.Text("UID", fmt.Sprintf("entry-%d@gothstack", entry.ID))
+	iw.Line("DTSTAMP", icalUTC(entry.UpdatedAt))
+	iw.Line("LAST-MODIFIED", icalUTC(entry.UpdatedAt))
+	if entry.HasTime() {
+		start, end, err := icalEntryTimes(entry)
+		if err != nil {
+			return err
+		}
+		iw.Line("DTSTART", start)
+		iw.Line("DTEND", end)
+	} else {
+		iw.Line("DTSTART;VALUE=DATE", icalDate(entry.Date))
+		iw.Line("DTEND;VALUE=DATE", icalDate(entry.Date.AddDate(0, 0, 1)))
+		iw.Line("TRANSP", "TRANSPARENT")
+	}
+	iw.Text("SUMMARY", entry.Text)
+
+	var description []string
+	if calendar.Work || entry.Hours > 0 {
+		description = append(description, fmt.Sprintf("Hours: %.2f", entry.Hours))
+	}
+	if entry.WorkResource.Name != "" {
+		description = append(description, "Resource: "+entry.WorkResource.Name)
+	}
+	if len(entry.Tags) > 0 {
+		description = append(description, "Tags: "+TagNames(entry.Tags))
+	}
+	if len(description) > 0 {
+		iw.Text("DESCRIPTION", strings.Join(description, "\n"))
+	}
+	if len(entry.Tags) > 0 {
+		categories := make([]string, len(entry.Tags))
+		for i, tag := range entry.Tags {
+			categories[i] = icalEscape(tag.Name)
+		}
+		iw.Line("CATEGORIES", strings.Join(categories, ","))
+	}
+	iw.Line("END", "VEVENT")
+	return iw.Err()
+}
+
+// writeICalHoliday writes a public holiday as an all-day VEVENT
+func writeICalHoliday(iw *icalWriter, holiday FinnishHoliday, stamp time.Time) {
+	iw.Line("BEGIN", "VEVENT")
+	iw.Text("UID", "holiday-"+icalDate(holiday.Date)+"@gothstack")
+	iw.Line("DTSTAMP", icalUTC(stamp))
+	iw.Line("DTSTART;VALUE=DATE", icalDate(holiday.Date))
+	iw.Line("DTEND;VALUE=DATE", icalDate(holiday.Date.AddDate(0, 0, 1)))
+	iw.Text("SUMMARY", holiday.Name)
+	iw.Text("DESCRIPTION", holiday.Description)
+	iw.Line("CATEGORIES", "Holiday")
+	iw.Line("TRANSP", "TRANSPARENT")
+	iw.Line("END", "VEVENT")
+}
+
+// WriteCalendarFeed writes the entries and holidays within the window of the feed as an iCalendar object
+func WriteCalendarFeed(w io.Writer, feed CalendarFeed, now time.Time) error {
+	iw := &icalWriter{w: w}
+	from, to := feed.Window(now)
+
+	iw.Line("BEGIN", "VCALENDAR")
+	iw.Line("VERSION", "2.0")
+	iw.Text("PRODID", icalProductID)
+	iw.Line("CALSCALE", "GREGORIAN")
+	iw.Line("METHOD", "PUBLISH")
+	iw.Text("X-WR-CALNAME", feed.Calendar.Name)
+	iw.Line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	iw.Line("X-PUBLISHED-TTL", "PT1H")
+
+	err := StreamEntriesByDateRange(feed.Calendar.ID, from, to, csvExportBatchSize, func(entries []CalendarEntry) error {
+		for _, entry := range entries {
+			if err := writeICalEntry(iw, feed.Calendar, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for year := from.Year(); year <= to.Year(); year++ {
+		for _, holiday := range GetFinnishHolidays(year) {
+			day := time.Date(holiday.Date.Year(), holiday.Date.Month(), holiday.Date.Day(), 0, 0, 0, 0, time.UTC)
+			if day.Before(from) || day.After(to) {
+				continue
+			}
+			writeICalHoliday(iw, holiday, now)
+		}
+	}
+
+	iw.Line("END", "VCALENDAR")
+	return iw.Err()
+}
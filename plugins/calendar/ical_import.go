@@ -0,0 +1,272 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ICalEvent is a VEVENT parsed from an iCalendar file
+type ICalEvent struct {
+	UID          string
+	RecurrenceID string // set on modified occurrences of recurring events
+	Summary      string
+	Description  string
+	Start        time.Time // in the local time zone, midnight for all-day events
+	End          time.Time
+	AllDay       bool
+	Recurring    bool // only the first occurrence of a recurring event is imported
+}
+
+// ImportUID returns the identifier stored on entries imported from the event
+func (e ICalEvent) ImportUID() string {
+	if e.RecurrenceID != "" {
+		return "ics:" + e.UID + "#" + e.RecurrenceID
+	}
+	return "ics:" + e.UID
+}
+
+// Date returns the day of the entry created from the event
+func (e ICalEvent) Date() time.Time {
+	return time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Hours maps the duration of the event to logged hours, rounded to a quarter of an hour.
+// All-day events count as dailyHours for each day they span.
+func (e ICalEvent) Hours(dailyHours float64) float64 {
+	if e.AllDay {
+		days := math.Round(e.End.Sub(e.Start).Hours() / 24)
+		if days < 1 {
+			days = 1
+		}
+		return days * dailyHours
+	}
+	return math.Round(e.End.Sub(e.Start).Hours()*4) / 4
+}
+
+// icalProperty is a content line split into its name, parameters and raw value
+type icalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icalContentLines reads the unfolded content lines of an iCalendar stream
+func icalContentLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalProperty splits a content line, honouring quoted parameter values
+func parseICalProperty(line string) (icalProperty, error) {
+	property := icalProperty{Params: make(map[string]string)}
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property, fmt.Errorf("invalid content line %q", line)
+	}
+	property.Value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	property.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		property.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return property, nil
+}
+
+// icalUnescape decodes a TEXT value
+func icalUnescape(text string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(text)
+}
+
+// parseICalTime parses a DATE or DATE-TIME property into the local time zone. UTC times
+// and times with a known TZID are converted, floating times are taken as local times.
+func parseICalTime(property icalProperty) (time.Time, bool, error) {
+	value := property.Value
+	if property.Params["VALUE"] == "DATE" || len(value) == 8 {
+		date, err := time.ParseInLocation("20060102", value, time.Local)
+		return date, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t.Local(), false, err
+	}
+	location := time.Local
+	if tzid := property.Params["TZID"]; tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t.Local(), false, err
+}
+
+// icalDurationPattern matches the DURATION values of RFC 5545, e.g. PT1H30M or P1D
+var icalDurationPattern = regexp.MustCompile(`^([+-]?)P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICalDuration parses a DURATION value
+func parseICalDuration(value string) (time.Duration, error) {
+	match := icalDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var duration time.Duration
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	for i, unit := range units {
+		if match[i+2] != "" {
+			n, _ := strconv.Atoi(match[i+2])
+			duration += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		duration = -duration
+	}
+	return duration, nil
+}
+
+// ParseICalEvents parses the VEVENTs of an iCalendar file. Cancelled events are left out,
+// events without an end last until the end of their start day when all-day and are
+// instantaneous otherwise, as in RFC 5545.
+func ParseICalEvents(r io.Reader) ([]ICalEvent, error) {
+	lines, err := icalContentLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read iCalendar file: %w", err)
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	var events []ICalEvent
+	var event *ICalEvent
+	var duration time.Duration
+	var hasEnd, cancelled bool
+	depth := 0 // nesting of components inside the VEVENT, such as VALARM
+	for number, line := range lines {
+		property, err := parseICalProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+		value := strings.ToUpper(property.Value)
+		switch {
+		case property.Name == "BEGIN" && value == "VEVENT" && event == nil:
+			event = &ICalEvent{}
+			duration, hasEnd, cancelled, depth = 0, false, false, 0
+			continue
+		case event == nil:
+			continue
+		case property.Name == "BEGIN":
+			depth++
+			continue
+		case property.Name == "END" && value == "VEVENT" && depth == 0:
+			if event.UID == "" || event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event without UID or DTSTART", number+1)
+			}
+			if !hasEnd {
+				event.End = event.Start.Add(duration)
+				if event.AllDay && duration == 0 {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			if !cancelled {
+				events = append(events, *event)
+			}
+			event = nil
+			continue
+		case property.Name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch property.Name {
+		case "UID":
+			event.UID = property.Value
+		case "RECURRENCE-ID":
+			event.RecurrenceID = property.Value
+		case "SUMMARY":
+			event.Summary = strings.TrimSpace(icalUnescape(property.Value))
+		case "DESCRIPTION":
+			event.Description = strings.TrimSpace(icalUnescape(property.Value))
+		case "STATUS":
+			cancelled = value == "CANCELLED"
+		case "RRULE", "RDATE":
+			event.Recurring = true
+		case "DTSTART":
+			event.Start, event.AllDay, err = parseICalTime(property)
+		case "DTEND":
+			event.End, _, err = parseICalTime(property)
+			hasEnd = true
+		case "DURATION":
+			duration, err = parseICalDuration(property.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+	}
+	return events, nil
+}
+
+// keywords returns the lower case words of at least three letters in text
+func keywords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	result := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) >= 3 {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// SuggestWorkResource returns the task whose name and parent names share the most keywords
+// with the text, or zero when no task matches
+func SuggestWorkResource(text string, tasks []WorkResourceTreeItem) uint {
+	words := make(map[string]bool)
+	for _, word := range keywords(text) {
+		words[word] = true
+	}
+	var best uint
+	bestScore := 0
+	for _, task := range tasks {
+		score := 0
+		for _, word := range keywords(task.Path) {
+			if words[word] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = task.Resource.ID, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,495 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"gothstack/plugins/auth"
+	"strconv"
+	"strings"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxImportFileSize limits the size of uploaded import files
+const maxImportFileSize = 2 << 20
+
+// ICalImportRow is an event of an uploaded .ics file in the import preview
+type ICalImportRow struct {
+	Index          int
+	Event          ICalEvent
+	Hours          float64
+	WorkResourceID uint // suggested from the summary, or chosen in the preview
+	Imported       bool // an entry with the UID of the event already exists
+}
+
+// ICalImportPageData holds data for the .ics import pages
+type ICalImportPageData struct {
+	Calendar Calendar
+	Tasks    []WorkResourceTreeItem
+	Rows     []ICalImportRow
+	Content  string // the uploaded file, base64 encoded, posted back with the selection
+	Error    string
+	Created  int
+	Done     bool
+}
+
+// loadImportCalendar loads the calendar in the URL and its tasks
+func loadImportCalendar(kit *kit.Kit) (Calendar, []WorkResourceTreeItem, error) {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return Calendar{}, nil, fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return calendar, nil, err
+	}
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return calendar, nil, err
+	}
+	return calendar, WorkResourceTaskItems(resources), nil
+}
+
+// readUploadedFile returns the content of the file field of a multipart form
+func readUploadedFile(kit *kit.Kit, field string) ([]byte, error) {
+	if err := kit.Request.ParseMultipartForm(maxImportFileSize); err != nil {
+		return nil, fmt.Errorf("the upload could not be read: %w", err)
+	}
+	file, header, err := kit.Request.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("choose a file to import")
+	}
+	defer file.Close()
+	if header.Size > maxImportFileSize {
+		return nil, fmt.Errorf("the file is larger than %d MB", maxImportFileSize>>20)
+	}
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(file); err != nil {
+		return nil, fmt.Errorf("the upload could not be read: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// icalImportRows parses the events of the file and marks the ones already imported
+func icalImportRows(calendar Calendar, tasks []WorkResourceTreeItem, content []byte) ([]ICalImportRow, error) {
+	events, err := ParseICalEvents(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]string, len(events))
+	for i, event := range events {
+		uids[i] = event.ImportUID()
+	}
+	imported, err := ListImportedUIDs(calendar.ID, uids)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]ICalImportRow, len(events))
+	for i, event := range events {
+		rows[i] = ICalImportRow{
+			Index:          i,
+			Event:          event,
+			Hours:          event.Hours(calendar.DailyWorkHours),
+			WorkResourceID: SuggestWorkResource(event.Summary+" "+event.Description, tasks),
+			Imported:       imported[event.ImportUID()],
+		}
+	}
+	return rows, nil
+}
+
+// HandleICalImport renders the .ics upload form
+func HandleICalImport(kit *kit.Kit) error {
+	calendar, tasks, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(ICalImportPage(ICalImportPageData{Calendar: calendar, Tasks: tasks}))
+}
+
+// HandleICalImportPreview parses an uploaded .ics file and renders its events for selection
+func HandleICalImportPreview(kit *kit.Kit) error {
+	calendar, tasks, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	data := ICalImportPageData{Calendar: calendar, Tasks: tasks}
+
+	content, err := readUploadedFile(kit, "file")
+	if err != nil {
+		data.Error = err.Error()
+		return kit.Render(ICalImportPage(data))
+	}
+	data.Rows, err = icalImportRows(calendar, tasks, content)
+	if err != nil {
+		data.Error = fmt.Sprintf("The file could not be parsed: %v", err)
+		return kit.Render(ICalImportPage(data))
+	}
+	if len(data.Rows) == 0 {
+		data.Error = "The file has no events."
+		return kit.Render(ICalImportPage(data))
+	}
+	data.Content = base64.StdEncoding.EncodeToString(content)
+	return kit.Render(ICalImportPage(data))
+}
+
+// HandleICalImportPost creates entries from the events selected in the preview, with the hours
+// and resources chosen there. Events imported before are skipped.
+func HandleICalImportPost(kit *kit.Kit) error {
+	calendar, tasks, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	data := ICalImportPageData{Calendar: calendar, Tasks: tasks}
+	if err := kit.Request.ParseForm(); err != nil {
+		return fmt.Errorf("failed to parse form: %w", err)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(kit.Request.PostForm.Get("content"))
+	if err != nil {
+		data.Error = "The uploaded file was lost, upload it again."
+		return kit.Render(ICalImportPage(data))
+	}
+	data.Rows, err = icalImportRows(calendar, tasks, content)
+	if err != nil {
+		data.Error = fmt.Sprintf("The file could not be parsed: %v", err)
+		return kit.Render(ICalImportPage(data))
+	}
+	data.Content = kit.Request.PostForm.Get("content")
+
+	selected := make(map[int]bool)
+	for _, value := range kit.Request.PostForm["import"] {
+		if index, err := strconv.Atoi(value); err == nil {
+			selected[index] = true
+		}
+	}
+
+	var entries []CalendarEntry
+	for i, row := range data.Rows {
+		if !selected[row.Index] || row.Imported {
+			continue
+		}
+		if hours, err := strconv.ParseFloat(kit.Request.PostForm.Get(fmt.Sprintf("hours_%d", row.Index)), 64); err == nil && hours >= 0 {
+			data.Rows[i].Hours = hours
+		}
+		resourceID, _ := strconv.ParseUint(kit.Request.PostForm.Get(fmt.Sprintf("resource_%d", row.Index)), 10, 32)
+		data.Rows[i].WorkResourceID = uint(resourceID)
+		if !validateEntryResource(CalendarEntryFormValues{WorkResourceID: uint(resourceID)}, tasks, v.Errors{}) {
+			data.Error = fmt.Sprintf("Event %q must be logged against a task of this calendar.", row.Event.Summary)
+			return kit.Render(ICalImportPage(data))
+		}
+
+		text := row.Event.Summary
+		if text == "" {
+			text = "(no title)"
+		}
+		entry := newCalendarEntry(calendar.ID, row.Event.Date(), text, data.Rows[i].Hours, uint(resourceID))
+		entry.ImportUID = row.Event.ImportUID()
+		// entry times are within one day, an event past midnight is imported with its hours only
+		start, end := row.Event.Start, row.Event.End
+		if !row.Event.AllDay && start.Format("2006-01-02") == end.Format("2006-01-02") && !end.Before(start) {
+			entry.StartTime = start.Format("15:04")
+			entry.EndTime = end.Format("15:04")
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		data.Error = "Select at least one event that has not been imported yet."
+		return kit.Render(ICalImportPage(data))
+	}
+
+	data.Created, err = ImportCalendarEntries(calendar.OwnerID, entries)
+	if err != nil {
+		data.Error = fmt.Sprintf("Import failed, no entries were created: %v", err)
+		return kit.Render(ICalImportPage(data))
+	}
+	data.Done = true
+	data.Rows, data.Content = nil, ""
+	return kit.Render(ICalImportPage(data))
+}
+
+// maxCSVImportErrors limits the invalid rows listed in a CSV import report
+const maxCSVImportErrors = 100
+
+// CSVImportPageData holds data for the steps of the CSV import wizard
+type CSVImportPageData struct {
+	Calendar Calendar
+	Content  string // the uploaded file, base64 encoded, posted back with the mapping
+	Mapping  CSVImportMapping
+	Columns  []string
+	Sample   [][]string // the first data rows, shown while mapping
+	Result   *CSVImportResult
+	Created  int
+	Done     bool
+	Error    string
+}
+
+// csvImportStep loads the records of the file and fills the mapping step of the wizard
+func (data *CSVImportPageData) csvImportStep(content []byte) ([][]string, error) {
+	records, err := readCSVRecords(content, data.Mapping.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	data.Content = base64.StdEncoding.EncodeToString(content)
+	data.Columns = CSVColumnNames(records, data.Mapping.Header)
+	sample := records
+	if data.Mapping.Header && len(sample) > 0 {
+		sample = sample[1:]
+	}
+	data.Sample = sample[:min(len(sample), 5)]
+	return records, nil
+}
+
+// HandleCSVImport renders the upload step of the CSV import wizard
+func HandleCSVImport(kit *kit.Kit) error {
+	calendar, _, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(CSVImportPage(CSVImportPageData{Calendar: calendar}))
+}
+
+// HandleCSVImportMap reads an uploaded CSV file and renders the column mapping step
+func HandleCSVImportMap(kit *kit.Kit) error {
+	calendar, _, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	data := CSVImportPageData{Calendar: calendar}
+
+	content, err := readUploadedFile(kit, "file")
+	if err != nil {
+		data.Error = err.Error()
+		return kit.Render(CSVImportPage(data))
+	}
+	delimiter := kit.Request.FormValue("delimiter")
+	if _, ok := CSVImportDelimiters[delimiter]; !ok {
+		delimiter = detectCSVDelimiter(content)
+	}
+	header := kit.Request.FormValue("header") == "on"
+
+	data.Mapping = CSVImportMapping{Date: -1, Hours: -1, Text: -1, Resource: -1}
+	data.Mapping.Header, data.Mapping.Delimiter = header, delimiter
+	if _, err := data.csvImportStep(content); err != nil {
+		data.Error = err.Error()
+		data.Content = ""
+		return kit.Render(CSVImportPage(data))
+	}
+	if header {
+		data.Mapping = guessCSVMapping(data.Columns)
+		data.Mapping.Header, data.Mapping.Delimiter = header, delimiter
+	}
+	data.Mapping.DateFormat = CSVDateFormats[0].Layout
+	return kit.Render(CSVImportPage(data))
+}
+
+// HandleCSVImportPost validates every row against the column mapping and reports the errors
+// row by row. Unless it is a dry run, the entries are created in one transaction when every
+// row is valid.
+func HandleCSVImportPost(kit *kit.Kit) error {
+	calendar, tasks, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	data := CSVImportPageData{Calendar: calendar}
+	if err := kit.Request.ParseForm(); err != nil {
+		return fmt.Errorf("failed to parse form: %w", err)
+	}
+	form := kit.Request.PostForm
+
+	column := func(name string) int {
+		index, err := strconv.Atoi(form.Get(name))
+		if err != nil {
+			return -1
+		}
+		return index
+	}
+	data.Mapping = CSVImportMapping{
+		Date:       column("date_column"),
+		Hours:      column("hours_column"),
+		Text:       column("text_column"),
+		Resource:   column("resource_column"),
+		DateFormat: form.Get("date_format"),
+		Delimiter:  form.Get("delimiter"),
+		Header:     form.Get("header") == "on",
+	}
+	if _, ok := CSVImportDelimiters[data.Mapping.Delimiter]; !ok {
+		data.Mapping.Delimiter = "comma"
+	}
+	content, err := base64.StdEncoding.DecodeString(form.Get("content"))
+	if err != nil {
+		data.Error = "The uploaded file was lost, upload it again."
+		return kit.Render(CSVImportPage(data))
+	}
+	records, err := data.csvImportStep(content)
+	if err != nil {
+		data.Error = err.Error()
+		return kit.Render(CSVImportPage(data))
+	}
+
+	validFormat := false
+	for _, format := range CSVDateFormats {
+		validFormat = validFormat || format.Layout == data.Mapping.DateFormat
+	}
+	if !validFormat || data.Mapping.Date < 0 || data.Mapping.Text < 0 || (calendar.Work && data.Mapping.Hours < 0) {
+		data.Error = "Map the date, text and hours columns and pick a date format."
+		return kit.Render(CSVImportPage(data))
+	}
+
+	result := ParseCSVImport(calendar, tasks, records, data.Mapping)
+	data.Result = &result
+	if form.Get("action") != "import" {
+		return kit.Render(CSVImportPage(data))
+	}
+	if len(result.Invalid) > 0 {
+		data.Error = "Nothing was imported, fix the rows below first."
+		return kit.Render(CSVImportPage(data))
+	}
+	if len(result.Rows) == 0 {
+		data.Error = "The file has no data rows."
+		return kit.Render(CSVImportPage(data))
+	}
+
+	entries := make([]CalendarEntry, len(result.Rows))
+	for i, row := range result.Rows {
+		entries[i] = row.Entry
+	}
+	data.Created, err = ImportCalendarEntries(calendar.OwnerID, entries)
+	if err != nil {
+		data.Error = fmt.Sprintf("Import failed, no entries were created: %v", err)
+		return kit.Render(CSVImportPage(data))
+	}
+	data.Done = true
+	return kit.Render(CSVImportPage(data))
+}
+
+// TrackerImportPageData holds data for the time tracker import pages
+type TrackerImportPageData struct {
+	Calendar     Calendar
+	Format       string
+	Days         []TrackerDay
+	NewResources []string // resource paths created by the import
+	Hours        float64  // total hours of the days not imported before
+	Invalid      int      // days with errors, which are not imported
+	Content      string   // the uploaded file, base64 encoded, posted back to import
+	Error        string
+	Created      int
+	Resources    int
+	Done         bool
+}
+
+// trackerImportPreview parses the export into days and marks the days imported before,
+// the days with errors and the resources the import would create
+func trackerImportPreview(data *TrackerImportPageData, content []byte) error {
+	entries, err := ParseTrackerExport(data.Format, content)
+	if err != nil {
+		return err
+	}
+	data.Days = AggregateTrackerEntries(entries)
+
+	uids := make([]string, len(data.Days))
+	for i, day := range data.Days {
+		uids[i] = day.ImportUID(data.Format)
+	}
+	imported, err := ListImportedUIDs(data.Calendar.ID, uids)
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByCalendar(data.Calendar.ID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, item := range BuildWorkResourceTree(resources) {
+		existing[strings.ToLower(item.Path)] = true
+	}
+
+	data.NewResources, data.Hours, data.Invalid = nil, 0, 0
+	for i, day := range data.Days {
+		data.Days[i].Imported = imported[uids[i]]
+		if len(day.Errors) > 0 {
+			data.Invalid++
+			continue
+		}
+		if data.Days[i].Imported {
+			continue
+		}
+		data.Hours += day.Hours
+		if path := day.Path(); path != "" && !existing[strings.ToLower(path)] {
+			existing[strings.ToLower(path)] = true
+			data.NewResources = append(data.NewResources, path)
+		}
+	}
+	return nil
+}
+
+// HandleTrackerImport renders the time tracker export upload form
+func HandleTrackerImport(kit *kit.Kit) error {
+	calendar, _, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(TrackerImportPage(TrackerImportPageData{Calendar: calendar, Format: TrackerFormats[0].Key}))
+}
+
+// HandleTrackerImportPreview parses an uploaded time tracker export and renders the entries
+// and resources the import would create
+func HandleTrackerImportPreview(kit *kit.Kit) error {
+	calendar, _, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	data := TrackerImportPageData{Calendar: calendar, Format: TrackerFormats[0].Key}
+
+	content, err := readUploadedFile(kit, "file")
+	if err != nil {
+		data.Error = err.Error()
+		return kit.Render(TrackerImportPage(data))
+	}
+	data.Format = kit.Request.FormValue("format")
+	if err := trackerImportPreview(&data, content); err != nil {
+		data.Error = fmt.Sprintf("The file could not be read: %v", err)
+		return kit.Render(TrackerImportPage(data))
+	}
+	if len(data.Days) == 0 {
+		data.Error = "The file has no time entries."
+		return kit.Render(TrackerImportPage(data))
+	}
+	data.Content = base64.StdEncoding.EncodeToString(content)
+	return kit.Render(TrackerImportPage(data))
+}
+
+// HandleTrackerImportPost imports the days of a previewed time tracker export
+func HandleTrackerImportPost(kit *kit.Kit) error {
+	calendar, _, err := loadImportCalendar(kit)
+	if err != nil {
+		return err
+	}
+	if err := kit.Request.ParseForm(); err != nil {
+		return fmt.Errorf("failed to parse form: %w", err)
+	}
+	data := TrackerImportPageData{Calendar: calendar, Format: kit.Request.PostForm.Get("format")}
+
+	content, err := base64.StdEncoding.DecodeString(kit.Request.PostForm.Get("content"))
+	if err != nil {
+		data.Error = "The uploaded file was lost, upload it again."
+		return kit.Render(TrackerImportPage(data))
+	}
+	if err := trackerImportPreview(&data, content); err != nil {
+		data.Error = fmt.Sprintf("The file could not be read: %v", err)
+		return kit.Render(TrackerImportPage(data))
+	}
+
+	data.Created, data.Resources, err = ImportTrackerDays(calendar, data.Format, data.Days)
+	if err != nil {
+		data.Error = fmt.Sprintf("Import failed, nothing was created: %v", err)
+		data.Content = kit.Request.PostForm.Get("content")
+		return kit.Render(TrackerImportPage(data))
+	}
+	data.Done = true
+	data.Days = nil
+	return kit.Render(TrackerImportPage(data))
+}
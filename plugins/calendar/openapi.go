@@ -0,0 +1,181 @@
+package calendar
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// apiVersion is the version of the JSON API in the OpenAPI document
+const apiVersion = "1.0.0"
+
+// openAPIPathParam matches the parameters of chi route patterns
+var openAPIPathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIBuilder collects the component schemas while the operations are generated
+type openAPIBuilder struct {
+	schemas map[string]any
+}
+
+// schemaName returns the component name of a type: the name without the API prefix,
+// and for generic lists the element name followed by List
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.Index(name, "["); i >= 0 {
+		element := name[i+1 : len(name)-1]
+		name = element[strings.LastIndex(element, ".")+1:] + name[:i][len("API"):]
+	}
+	return strings.TrimPrefix(name, "API")
+}
+
+// schema returns the schema of a type, adding structs to the components and referencing them
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = nil // placeholder against recursion
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// structSchema returns the object schema of a struct from its json tags. Fields of response
+// types are always present and so required; input fields are optional and default to zero.
+func (b *openAPIBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.HasSuffix(t.Name(), "Input") && !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonContent returns the content of a JSON request or response body
+func (b *openAPIBuilder) jsonContent(v any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(v))}}
+}
+
+// operation returns the OpenAPI operation of a route
+func (b *openAPIBuilder) operation(route apiRoute) map[string]any {
+	var parameters []any
+	for _, match := range openAPIPathParam.FindAllStringSubmatch(route.Path, -1) {
+		parameters = append(parameters, map[string]any{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "integer"},
+		})
+	}
+	for _, param := range route.Query {
+		schema := map[string]any{"type": param.Type}
+		if param.Format != "" {
+			schema["format"] = param.Format
+		}
+		if len(param.Enum) > 0 {
+			schema["enum"] = param.Enum
+		}
+		parameters = append(parameters, map[string]any{
+			"name": param.Name, "in": "query", "description": param.Description, "schema": schema,
+		})
+	}
+
+	success := map[string]any{"description": http.StatusText(route.Status)}
+	if route.Response != nil {
+		success["content"] = b.jsonContent(route.Response)
+	}
+	operation := map[string]any{
+		"operationId": route.Operation,
+		"summary":     route.Summary,
+		"responses": map[string]any{
+			strconv.Itoa(route.Status): success,
+			"default":                  map[string]any{"description": "Error", "content": b.jsonContent(APIErrorBody{})},
+		},
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if route.Request != nil {
+		operation["requestBody"] = map[string]any{"required": true, "content": b.jsonContent(route.Request)}
+	}
+	return operation
+}
+
+// OpenAPIDocument returns the OpenAPI 3 document of the JSON API, generated from apiRoutes
+func OpenAPIDocument() map[string]any {
+	b := &openAPIBuilder{schemas: make(map[string]any)}
+	paths := make(map[string]map[string]any)
+	for _, route := range apiRoutes {
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]any)
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = b.operation(route)
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Calendar API",
+			"version":     apiVersion,
+			"description": "Calendars, entries, work resources and month statistics. Authenticate with a personal access token from the profile page.",
+		},
+		"servers": []any{map[string]any{"url": "/api/v1"}},
+		"security": []any{
+			map[string]any{"bearerAuth": []string{}},
+			map[string]any{"sessionCookie": []string{}},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth":    map[string]any{"type": "http", "scheme": "bearer"},
+				"sessionCookie": map[string]any{"type": "apiKey", "in": "cookie", "name": "user-session"},
+			},
+		},
+	}
+}
+
+// openAPIDocument is generated on first use, the routes do not change at runtime
+var openAPIDocument = sync.OnceValue(OpenAPIDocument)
+
+// HandleAPIOpenAPI serves the OpenAPI document of the JSON API
+func HandleAPIOpenAPI(kit *kit.Kit) error {
+	kit.Response.Header().Set("Access-Control-Allow-Origin", "*")
+	return writeAPIJSON(kit, http.StatusOK, openAPIDocument())
+}
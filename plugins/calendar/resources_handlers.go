@@ -26,9 +26,57 @@ func validateResourcesPercentage(values WorkResourceFormValues, errors v.Errors)
 	return true
 }
 
+// Custom validation for the position of a resource in the client -> project -> task tree.
+// Shared resources are changed from the shared resources of the user, out of sight of the
+// calendars they are attached to, so calendar specific resources cannot be placed under them.
+func validateResourceHierarchy(values *WorkResourceFormValues, resourceID uint, shared bool, resources []WorkResource, errors v.Errors) bool {
+	if values.Kind == "" {
+		values.Kind = WorkResourceKindTask
+	}
+	if parentKindOf(values.Kind) == "" && values.Kind != WorkResourceKindClient {
+		errors.Add("kind", "Kind must be client, project or task")
+		return false
+	}
+
+	byID := make(map[uint]WorkResource, len(resources))
+	for _, r := range resources {
+		byID[r.ID] = r
+	}
+
+	// Changing the kind would break the tree below the resource
+	if current, ok := byID[resourceID]; ok && current.Kind != values.Kind {
+		for _, r := range resources {
+			if r.ParentID == resourceID {
+				errors.Add("kind", "Kind cannot be changed while the resource has sub-resources")
+				return false
+			}
+		}
+	}
+
+	if values.ParentID == 0 {
+		return true
+	}
+	parent, ok := byID[values.ParentID]
+	if !ok || parent.ID == resourceID {
+		errors.Add("parent", "Parent must be another resource of this calendar")
+		return false
+	}
+	if parent.IsShared() && !shared {
+		errors.Add("parent", "Parent cannot be a shared resource")
+		return false
+	}
+	if parent.Kind != parentKindOf(values.Kind) {
+		errors.Add("parent", fmt.Sprintf("A %s can only be placed under a %s", values.Kind, parentKindOf(values.Kind)))
+		return false
+	}
+	return true
+}
+
 // WorkResourcePageData holds data for the work resource pages
 type WorkResourcePageData struct {
 	WorkResources []WorkResource
+	ResourceTree  []WorkResourceTreeItem
+	SharedTree    []WorkResourceTreeItem
 	Calendar      Calendar
 	FormValues    WorkResourceFormValues
 	FormErrors    v.Errors
@@ -37,6 +85,8 @@ type WorkResourcePageData struct {
 // WorkResourceFormValues holds form data for creating/updating a work resource
 type WorkResourceFormValues struct {
 	Name                string `form:"name"`
+	Kind                string `form:"kind"`
+	ParentID            uint   `form:"parent"`
 	ResourcesPercentage int    `form:"resources_percentage"`
 	SuccessMessage      string
 }
@@ -67,9 +117,17 @@ func HandleWorkResourceList(kit *kit.Kit) error {
 	for _, resource := range resources {
 		total += resource.ResourcesPercentage
 	}
+	// Shared resources of the user that can be attached to this calendar
+	shared, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+
 	// Render the work resources list page
 	data := WorkResourcePageData{
 		WorkResources: resources,
+		ResourceTree:  BuildWorkResourceTree(resources),
+		SharedTree:    BuildWorkResourceTree(shared),
 		Calendar:      calendar,
 	}
 	return kit.Render(WorkResourceList(data, total))
@@ -92,10 +150,16 @@ func HandleWorkResourceCreate(kit *kit.Kit) error {
 		return err
 	}
 
+	resources, err := ListWorkResourcesByCalendar(uint(calendarID))
+	if err != nil {
+		return err
+	}
+
 	// Render the work resource creation form
 	data := WorkResourcePageData{
-		Calendar:   calendar,
-		FormValues: WorkResourceFormValues{},
+		Calendar:     calendar,
+		ResourceTree: BuildWorkResourceTree(resources),
+		FormValues:   WorkResourceFormValues{Kind: WorkResourceKindTask},
 	}
 	return kit.Render(WorkResourceCreate(data))
 }
@@ -120,24 +184,34 @@ func HandleWorkResourceCreatePost(kit *kit.Kit) error {
 		return err
 	}
 
-	// Perform additional validation for resources percentage
+	resources, err := ListWorkResourcesByCalendar(uint(calendarID))
+	if err != nil {
+		return err
+	}
+
+	// Perform additional validation for resources percentage and tree position
 	if !validateResourcesPercentage(values, errors) {
 		ok = false
 	}
+	if !validateResourceHierarchy(&values, 0, false, resources, errors) {
+		ok = false
+	}
 
 	if !ok {
-		return kit.Render(WorkResourceForm(values, errors, calendar))
+		return kit.Render(WorkResourceForm(values, errors, calendar, BuildWorkResourceTree(resources)))
 	}
 	// Create the new work resource
-	resource, err := CreateWorkResource(values.Name, userID, uint(calendarID), values.ResourcesPercentage)
+	resource, err := CreateWorkResource(values.Name, userID, uint(calendarID), values.ParentID, values.Kind, values.ResourcesPercentage)
 	if err != nil {
 		errors.Add("general", "Failed to create work resource")
-		return kit.Render(WorkResourceForm(values, errors, calendar))
+		return kit.Render(WorkResourceForm(values, errors, calendar, BuildWorkResourceTree(resources)))
 	}
+	resources = append(resources, resource)
 
-	// Set a success message and re-render the form
+	// Set a success message and re-render the form, keeping the parent selected for the next sibling
 	success := fmt.Sprintf("New work resource created: %s with ID %d", values.Name, resource.ID)
-	return kit.Render(WorkResourceForm(WorkResourceFormValues{SuccessMessage: success}, errors, calendar))
+	next := WorkResourceFormValues{Kind: values.Kind, ParentID: values.ParentID, SuccessMessage: success}
+	return kit.Render(WorkResourceForm(next, errors, calendar, BuildWorkResourceTree(resources)))
 }
 
 // HandleWorkResourceEdit renders the work resource edit form (GET request)
@@ -162,16 +236,24 @@ func HandleWorkResourceEdit(kit *kit.Kit) error {
 		return err
 	}
 
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return err
+	}
+
 	// Populate form values from the existing resource
 	values := WorkResourceFormValues{
 		Name:                resource.Name,
+		Kind:                resource.Kind,
+		ParentID:            resource.ParentID,
 		ResourcesPercentage: resource.ResourcesPercentage,
 	}
 
 	// Render the work resource edit form
 	data := WorkResourcePageData{
-		Calendar:   calendar,
-		FormValues: values,
+		Calendar:     calendar,
+		ResourceTree: BuildWorkResourceTree(resources),
+		FormValues:   values,
 	}
 	return kit.Render(WorkResourceEdit(data, uint(resourceID)))
 }
@@ -202,25 +284,34 @@ func HandleWorkResourceEditPost(kit *kit.Kit) error {
 	var values WorkResourceFormValues
 	errors, ok := v.Request(kit.Request, &values, workResourceSchema)
 
-	// Perform additional validation for resources percentage
+	resources, err := ListWorkResourcesByCalendar(calendar.ID)
+	if err != nil {
+		return err
+	}
+	tree := BuildWorkResourceTree(resources)
+
+	// Perform additional validation for resources percentage and tree position
 	if !validateResourcesPercentage(values, errors) {
 		ok = false
 	}
+	if !validateResourceHierarchy(&values, uint(resourceID), false, resources, errors) {
+		ok = false
+	}
 
 	if !ok {
-		return kit.Render(WorkResourceEditForm(values, errors, calendar, uint(resourceID)))
+		return kit.Render(WorkResourceEditForm(values, errors, calendar, tree, uint(resourceID)))
 	}
 
 	// Update the work resource
-	updatedResource, err := UpdateWorkResource(uint(resourceID), values.Name, values.ResourcesPercentage)
+	updatedResource, err := UpdateWorkResource(uint(resourceID), values.Name, values.ParentID, values.Kind, values.ResourcesPercentage)
 	if err != nil {
 		errors.Add("general", "Failed to update work resource")
-		return kit.Render(WorkResourceEditForm(values, errors, calendar, uint(resourceID)))
+		return kit.Render(WorkResourceEditForm(values, errors, calendar, tree, uint(resourceID)))
 	}
 
 	// Set a success message
 	values.SuccessMessage = fmt.Sprintf("Work resource updated: %s", updatedResource.Name)
-	return kit.Render(WorkResourceEditForm(values, errors, calendar, uint(resourceID)))
+	return kit.Render(WorkResourceEditForm(values, errors, calendar, tree, uint(resourceID)))
 }
 
 // HandleWorkResourceDelete processes the request to delete a work resource
@@ -232,13 +323,26 @@ func HandleWorkResourceDelete(kit *kit.Kit) error {
 		return fmt.Errorf("invalid resource ID: %w", err)
 	}
 
-	// Retrieve the work resource details to get the calendar ID
+	calendarIDStr := chi.URLParam(kit.Request, "id")
+	calendarID, err := strconv.ParseUint(calendarIDStr, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+
+	// Only the owner of the calendar may delete its resources. Shared resources are deleted
+	// from the shared resources page and only detached from a calendar.
+	auth := kit.Auth().(auth.Auth)
+	calendar, err := GetCalendar(uint(calendarID), auth.UserID)
+	if err != nil {
+		return err
+	}
 	resource, err := GetWorkResource(uint(resourceID))
 	if err != nil {
 		return err
 	}
-
-	calendarID := resource.CalendarID
+	if resource.CalendarID != calendar.ID || resource.OwnerID != auth.UserID {
+		return fmt.Errorf("work resource %d does not belong to calendar %d", resource.ID, calendar.ID)
+	}
 
 	// Delete the work resource
 	err = DeleteWorkResource(uint(resourceID))
@@ -1,15 +1,39 @@
 package calendar
 
 import (
+	"gothstack/plugins/auth"
+
 	"github.com/anthdm/superkit/kit"
 	"github.com/go-chi/chi/v5"
 )
 
 func InitRoutes(router chi.Router, authConfig kit.AuthenticationConfig) {
+	// Calendar feeds are authenticated by the secret token in the URL
+	router.Get("/feeds/{token}.ics", kit.Handler(HandleCalendarFeed))
+
+	// OpenAPI document of the JSON API
+	router.Get("/api/openapi.json", kit.Handler(HandleAPIOpenAPI))
+
+	// JSON API, answering with JSON errors instead of login redirects and error pages.
+	// Besides the session cookie it accepts personal access tokens as Bearer tokens.
+	apiAuthConfig := authConfig
+	apiAuthConfig.AuthFunc = auth.WithBearerToken(authConfig.AuthFunc)
+	router.Route("/api/v1", func(api chi.Router) {
+		api.Use(kit.WithAuthentication(apiAuthConfig, false))
+		api.Use(requireAPIAuth)
+		api.NotFound(apiHandler(HandleAPINotFound))
+		api.MethodNotAllowed(apiHandler(HandleAPIMethodNotAllowed))
+
+		for _, route := range apiRoutes {
+			api.Method(route.Method, route.Path, apiHandler(route.Handler))
+		}
+	})
+
 	router.Group(func(auth chi.Router) {
 		// Apply authentication middleware with the true parameter to require authentication
 		auth.Use(kit.WithAuthentication(authConfig, true))
 		auth.Get("/calendars", kit.Handler(HandleCalendarList))
+		auth.Get("/dashboard", kit.Handler(HandleDashboard))
 		auth.Get("/calendars/create", kit.Handler(HandleCalendarCreate))
 		auth.Post("/calendars/create", kit.Handler(HandleCalendarCreatePost))
 		auth.Get("/calendars/{id}", kit.Handler(HandleCalendarView))
@@ -19,6 +43,49 @@ func InitRoutes(router chi.Router, authConfig kit.AuthenticationConfig) {
 		auth.Get("/calendars/{id}/month", kit.Handler(HandleCalendarViewByMonth))
 		auth.Get("/calendars/{id}/{year}/{month}", kit.Handler(HandleCalendarViewByMonth))
 
+		// Year, week and day views
+		auth.Get("/calendars/{id}/year/{year}", kit.Handler(HandleCalendarViewByYear))
+		auth.Get("/calendars/{id}/week", kit.Handler(HandleCalendarViewByWeek))
+		auth.Get("/calendars/{id}/week/{year}/{isoWeek}", kit.Handler(HandleCalendarViewByWeek))
+		auth.Get("/calendars/{id}/day/{date}", kit.Handler(HandleCalendarViewByDay))
+		auth.Get("/calendars/{id}/day/{date}/entries", kit.Handler(HandleDayEntries))
+		auth.Post("/calendars/{id}/day/{date}/entries", kit.Handler(HandleDayEntryCreatePost))
+		auth.Get("/calendars/{id}/day/{date}/entry/{entry_id}/edit", kit.Handler(HandleDayEntryEdit))
+		auth.Post("/calendars/{id}/day/{date}/entry/{entry_id}/edit", kit.Handler(HandleDayEntryEditPost))
+		auth.Delete("/calendars/{id}/day/{date}/entry/{entry_id}", kit.Handler(HandleDayEntryDelete))
+
+		// Exports
+		auth.Get("/calendars/{id}/export", kit.Handler(HandleExport))
+		auth.Get("/calendars/{id}/export/entries.csv", kit.Handler(HandleEntriesCSVExport))
+		auth.Get("/calendars/{id}/export/stats.csv", kit.Handler(HandleStatsCSVExport))
+		auth.Get("/calendars/{id}/export/timesheet.xlsx", kit.Handler(HandleTimesheetXLSXExport))
+		auth.Get("/calendars/{id}/export/timesheet.pdf", kit.Handler(HandleTimesheetPDFExport))
+
+		// Imports
+		auth.Get("/calendars/{id}/import/ics", kit.Handler(HandleICalImport))
+		auth.Post("/calendars/{id}/import/ics/preview", kit.Handler(HandleICalImportPreview))
+		auth.Post("/calendars/{id}/import/ics", kit.Handler(HandleICalImportPost))
+		auth.Get("/calendars/{id}/import/csv", kit.Handler(HandleCSVImport))
+		auth.Post("/calendars/{id}/import/csv/map", kit.Handler(HandleCSVImportMap))
+		auth.Post("/calendars/{id}/import/csv", kit.Handler(HandleCSVImportPost))
+		auth.Get("/calendars/{id}/import/tracker", kit.Handler(HandleTrackerImport))
+		auth.Post("/calendars/{id}/import/tracker/preview", kit.Handler(HandleTrackerImportPreview))
+		auth.Post("/calendars/{id}/import/tracker", kit.Handler(HandleTrackerImportPost))
+
+		// iCalendar feed settings
+		auth.Get("/calendars/{id}/feed", kit.Handler(HandleCalendarFeedSettings))
+		auth.Post("/calendars/{id}/feed", kit.Handler(HandleCalendarFeedPost))
+		auth.Post("/calendars/{id}/feed/regenerate", kit.Handler(HandleCalendarFeedRegenerate))
+		auth.Delete("/calendars/{id}/feed", kit.Handler(HandleCalendarFeedRevoke))
+
+		// Webhooks and their delivery logs
+		auth.Get("/calendars/{id}/webhooks", kit.Handler(HandleWebhookList))
+		auth.Post("/calendars/{id}/webhooks", kit.Handler(HandleWebhookCreate))
+		auth.Get("/calendars/{id}/webhooks/{webhook_id}", kit.Handler(HandleWebhookDeliveries))
+		auth.Delete("/calendars/{id}/webhooks/{webhook_id}", kit.Handler(HandleWebhookDelete))
+		auth.Post("/calendars/{id}/webhooks/{webhook_id}/ping", kit.Handler(HandleWebhookPing))
+		auth.Post("/calendars/{id}/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver", kit.Handler(HandleWebhookRedeliver))
+
 		// Work resources
 		auth.Get("/calendars/{id}/resources", kit.Handler(HandleWorkResourceList))
 
@@ -37,5 +104,24 @@ func InitRoutes(router chi.Router, authConfig kit.AuthenticationConfig) {
 
 		// Delete a work resource
 		auth.Delete("/calendars/{id}/resources/{resource_id}", kit.Handler(HandleWorkResourceDelete))
+
+		// Attach and detach shared work resources
+		auth.Post("/calendars/{id}/resources/attach", kit.Handler(HandleWorkResourceAttachPost))
+		auth.Delete("/calendars/{id}/resources/{resource_id}/attachment", kit.Handler(HandleWorkResourceDetach))
+
+		// Shared work resources
+		auth.Get("/resources", kit.Handler(HandleSharedResourceList))
+		auth.Get("/resources/report", kit.Handler(HandleSharedResourceReport))
+		auth.Get("/resources/create", kit.Handler(HandleSharedResourceCreate))
+		auth.Post("/resources/create", kit.Handler(HandleSharedResourceCreatePost))
+		auth.Get("/resources/{resource_id}/edit", kit.Handler(HandleSharedResourceEdit))
+		auth.Post("/resources/{resource_id}/edit", kit.Handler(HandleSharedResourceEditPost))
+		auth.Delete("/resources/{resource_id}", kit.Handler(HandleSharedResourceDelete))
+
+		// Tag based reporting
+		auth.Get("/tags/report", kit.Handler(HandleTagReport))
+
+		// Full-text search over entries
+		auth.Get("/search", kit.Handler(HandleSearch))
 	})
 }
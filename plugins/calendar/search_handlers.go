@@ -0,0 +1,116 @@
+package calendar
+
+import (
+	"gothstack/plugins/auth"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// searchPageSize is the number of search results per page
+const searchPageSize = 50
+
+// SearchPageData holds data for the entry search page
+type SearchPageData struct {
+	Values       SearchFormValues
+	Calendars    []Calendar
+	ResourceTree []WorkResourceTreeItem
+	Entries      []CalendarEntry
+	Total        int64
+	Page         int
+	PageCount    int
+}
+
+// SearchFormValues holds the search form, read from the query string
+type SearchFormValues struct {
+	Query          string
+	CalendarID     uint
+	WorkResourceID uint
+	From           string // "2006-01-02"
+	To             string // "2006-01-02"
+	MinHours       string
+	MaxHours       string
+}
+
+// PageURL returns the search URL for another page of the same search
+func (values SearchFormValues) PageURL(page int) string {
+	query := url.Values{}
+	query.Set("q", values.Query)
+	query.Set("calendar", strconv.FormatUint(uint64(values.CalendarID), 10))
+	query.Set("resource", strconv.FormatUint(uint64(values.WorkResourceID), 10))
+	query.Set("from", values.From)
+	query.Set("to", values.To)
+	query.Set("min_hours", values.MinHours)
+	query.Set("max_hours", values.MaxHours)
+	query.Set("page", strconv.Itoa(page))
+	return "/search?" + query.Encode()
+}
+
+// HandleSearch renders the full-text search page over the entries of the user's calendars
+func HandleSearch(kit *kit.Kit) error {
+	query := kit.Request.URL.Query()
+	values := SearchFormValues{
+		Query:    query.Get("q"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		MinHours: query.Get("min_hours"),
+		MaxHours: query.Get("max_hours"),
+	}
+	filter := EntrySearchFilter{Query: values.Query, Limit: searchPageSize}
+	if id, err := strconv.ParseUint(query.Get("calendar"), 10, 32); err == nil {
+		values.CalendarID = uint(id)
+		filter.CalendarID = uint(id)
+	}
+	if id, err := strconv.ParseUint(query.Get("resource"), 10, 32); err == nil {
+		values.WorkResourceID = uint(id)
+		filter.WorkResourceID = uint(id)
+	}
+	// Entry dates are stored as UTC midnight, so the range bounds are too
+	if d, err := time.Parse("2006-01-02", values.From); err == nil {
+		filter.From = d
+	}
+	if d, err := time.Parse("2006-01-02", values.To); err == nil {
+		filter.To = d
+	}
+	if h, err := strconv.ParseFloat(values.MinHours, 64); err == nil {
+		filter.MinHours = h
+	}
+	if h, err := strconv.ParseFloat(values.MaxHours, 64); err == nil {
+		filter.MaxHours = h
+	}
+	page := 1
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 1 {
+		page = p
+	}
+	filter.Offset = (page - 1) * searchPageSize
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendars, err := ListCalendars(userID)
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByOwner(userID)
+	if err != nil {
+		return err
+	}
+
+	data := SearchPageData{
+		Values:       values,
+		Calendars:    calendars,
+		ResourceTree: BuildWorkResourceTree(resources),
+		Page:         page,
+	}
+	// Only search once the user asked for something, not on the first page load
+	if len(query) > 0 {
+		entries, total, err := SearchCalendarEntries(userID, filter)
+		if err != nil {
+			return err
+		}
+		data.Entries = entries
+		data.Total = total
+		data.PageCount = int((total + searchPageSize - 1) / searchPageSize)
+	}
+	return kit.Render(SearchPage(data))
+}
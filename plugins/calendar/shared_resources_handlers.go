@@ -0,0 +1,358 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// SharedResourcePageData holds data for the shared work resource pages
+type SharedResourcePageData struct {
+	ResourceTree []WorkResourceTreeItem
+	Calendars    []Calendar
+	Links        []CalendarWorkResource
+	FormValues   WorkResourceFormValues
+	FormErrors   v.Errors
+}
+
+// AttachResourceFormValues holds form data for attaching a shared resource to a calendar
+type AttachResourceFormValues struct {
+	WorkResourceID      uint `form:"resource"`
+	ResourcesPercentage int  `form:"resources_percentage"`
+}
+
+// SharedResourceReport holds hours of shared resources summed across calendars for a month
+type SharedResourceReport struct {
+	Year      int
+	Month     int
+	Calendars []Calendar
+	Rows      []SharedResourceReportRow
+}
+
+// SharedResourceReportRow holds the cross-calendar statistics of one shared resource.
+// Clients and projects include the hours of everything below them.
+type SharedResourceReportRow struct {
+	Item          WorkResourceTreeItem
+	CalendarHours map[uint]float64 // Logged hours per calendar ID
+	TargetHours   float64          // Sum of the targets of every calendar the resource is attached to
+	LoggedHours   float64          // Sum of the logged hours across calendars
+}
+
+// HandleSharedResourceList renders the shared work resources of the user
+func HandleSharedResourceList(kit *kit.Kit) error {
+	userID := kit.Auth().(auth.Auth).UserID
+	resources, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+	calendars, err := ListCalendars(userID)
+	if err != nil {
+		return err
+	}
+	links, err := ListCalendarWorkResourcesByOwner(userID)
+	if err != nil {
+		return err
+	}
+
+	data := SharedResourcePageData{
+		ResourceTree: BuildWorkResourceTree(resources),
+		Calendars:    calendars,
+		Links:        links,
+	}
+	return kit.Render(SharedResourceList(data))
+}
+
+// HandleSharedResourceCreate renders the shared work resource creation form (GET request)
+func HandleSharedResourceCreate(kit *kit.Kit) error {
+	userID := kit.Auth().(auth.Auth).UserID
+	resources, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+
+	data := SharedResourcePageData{
+		ResourceTree: BuildWorkResourceTree(resources),
+		FormValues:   WorkResourceFormValues{Kind: WorkResourceKindProject},
+	}
+	return kit.Render(SharedResourceCreate(data))
+}
+
+// HandleSharedResourceCreatePost processes the form submission (POST request) for creating a shared work resource
+func HandleSharedResourceCreatePost(kit *kit.Kit) error {
+	var values WorkResourceFormValues
+	errors, ok := v.Request(kit.Request, &values, workResourceSchema)
+
+	userID := kit.Auth().(auth.Auth).UserID
+	resources, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+
+	if !validateResourceHierarchy(&values, 0, true, resources, errors) {
+		ok = false
+	}
+	if !ok {
+		return kit.Render(SharedResourceForm(values, errors, BuildWorkResourceTree(resources), 0))
+	}
+
+	// Shared resources carry no allocation of their own, it is set per calendar when attaching
+	resource, err := CreateWorkResource(values.Name, userID, 0, values.ParentID, values.Kind, 0)
+	if err != nil {
+		errors.Add("general", "Failed to create shared resource")
+		return kit.Render(SharedResourceForm(values, errors, BuildWorkResourceTree(resources), 0))
+	}
+	resources = append(resources, resource)
+
+	success := fmt.Sprintf("New shared resource created: %s with ID %d", resource.Name, resource.ID)
+	next := WorkResourceFormValues{Kind: values.Kind, ParentID: values.ParentID, SuccessMessage: success}
+	return kit.Render(SharedResourceForm(next, errors, BuildWorkResourceTree(resources), 0))
+}
+
+// HandleSharedResourceEdit renders the shared work resource edit form (GET request)
+func HandleSharedResourceEdit(kit *kit.Kit) error {
+	resourceID, err := strconv.ParseUint(chi.URLParam(kit.Request, "resource_id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid resource ID: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	resource, err := GetSharedWorkResource(uint(resourceID), userID)
+	if err != nil {
+		return err
+	}
+	resources, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+
+	data := SharedResourcePageData{
+		ResourceTree: BuildWorkResourceTree(resources),
+		FormValues: WorkResourceFormValues{
+			Name:     resource.Name,
+			Kind:     resource.Kind,
+			ParentID: resource.ParentID,
+		},
+	}
+	return kit.Render(SharedResourceEdit(data, resource.ID))
+}
+
+// HandleSharedResourceEditPost processes the form submission (POST request) for updating a shared work resource
+func HandleSharedResourceEditPost(kit *kit.Kit) error {
+	resourceID, err := strconv.ParseUint(chi.URLParam(kit.Request, "resource_id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid resource ID: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	if _, err := GetSharedWorkResource(uint(resourceID), userID); err != nil {
+		return err
+	}
+	resources, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+	tree := BuildWorkResourceTree(resources)
+
+	var values WorkResourceFormValues
+	errors, ok := v.Request(kit.Request, &values, workResourceSchema)
+	if !validateResourceHierarchy(&values, uint(resourceID), true, resources, errors) {
+		ok = false
+	}
+	if !ok {
+		return kit.Render(SharedResourceForm(values, errors, tree, uint(resourceID)))
+	}
+
+	updatedResource, err := UpdateWorkResource(uint(resourceID), values.Name, values.ParentID, values.Kind, 0)
+	if err != nil {
+		errors.Add("general", "Failed to update shared resource")
+		return kit.Render(SharedResourceForm(values, errors, tree, uint(resourceID)))
+	}
+
+	values.SuccessMessage = fmt.Sprintf("Shared resource updated: %s", updatedResource.Name)
+	return kit.Render(SharedResourceForm(values, errors, tree, uint(resourceID)))
+}
+
+// HandleSharedResourceDelete deletes a shared work resource and all of its calendar attachments
+func HandleSharedResourceDelete(kit *kit.Kit) error {
+	resourceID, err := strconv.ParseUint(chi.URLParam(kit.Request, "resource_id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid resource ID: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	if _, err := GetSharedWorkResource(uint(resourceID), userID); err != nil {
+		return err
+	}
+	if err := DeleteWorkResource(uint(resourceID)); err != nil {
+		return err
+	}
+	return kit.Redirect(http.StatusSeeOther, "/resources")
+}
+
+// HandleWorkResourceAttachPost attaches a shared resource to a calendar with a calendar specific allocation
+func HandleWorkResourceAttachPost(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+
+	shared, err := ListSharedWorkResources(userID)
+	if err != nil {
+		return err
+	}
+
+	var values AttachResourceFormValues
+	errors, ok := v.Request(kit.Request, &values, v.Schema{})
+	if values.ResourcesPercentage < 0 || values.ResourcesPercentage > 100 {
+		errors.Add("resources_percentage", "Resources percentage must be between 0 and 100")
+		ok = false
+	}
+	if _, err := GetSharedWorkResource(values.WorkResourceID, userID); err != nil {
+		errors.Add("resource", "Select one of your shared resources")
+		ok = false
+	}
+	if !ok {
+		return kit.Render(WorkResourceAttachForm(values, errors, calendar, BuildWorkResourceTree(shared)))
+	}
+
+	if _, err := AttachWorkResource(calendar.ID, values.WorkResourceID, values.ResourcesPercentage); err != nil {
+		errors.Add("general", "Failed to attach shared resource")
+		return kit.Render(WorkResourceAttachForm(values, errors, calendar, BuildWorkResourceTree(shared)))
+	}
+	return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%d/resources", calendar.ID))
+}
+
+// HandleWorkResourceDetach removes a shared resource from a calendar
+func HandleWorkResourceDetach(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	resourceID, err := strconv.ParseUint(chi.URLParam(kit.Request, "resource_id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid resource ID: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendar(uint(calendarID), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := DetachWorkResource(calendar.ID, uint(resourceID)); err != nil {
+		return err
+	}
+	return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%d/resources", calendar.ID))
+}
+
+// HandleSharedResourceReport renders the hours of shared resources summed across all calendars of the user
+func HandleSharedResourceReport(kit *kit.Kit) error {
+	year := time.Now().Year()
+	month := int(time.Now().Month())
+	if y, err := strconv.Atoi(kit.Request.URL.Query().Get("year")); err == nil {
+		year = y
+	}
+	if m, err := strconv.Atoi(kit.Request.URL.Query().Get("month")); err == nil && m >= 1 && m <= 12 {
+		month = m
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	report, err := buildSharedResourceReport(userID, year, month)
+	if err != nil {
+		return err
+	}
+	return kit.Render(SharedResourceReportView(report))
+}
+
+// buildSharedResourceReport sums the targets and logged hours of an owner's shared
+// resources over every calendar they are attached to
+func buildSharedResourceReport(ownerID uint, year, month int) (SharedResourceReport, error) {
+	report := SharedResourceReport{Year: year, Month: month}
+
+	resources, err := ListSharedWorkResources(ownerID)
+	if err != nil {
+		return report, err
+	}
+	calendars, err := ListCalendars(ownerID)
+	if err != nil {
+		return report, err
+	}
+	links, err := ListCalendarWorkResourcesByOwner(ownerID)
+	if err != nil {
+		return report, err
+	}
+
+	resourcesByID := make(map[uint]WorkResource, len(resources))
+	resourceIDs := make([]uint, 0, len(resources))
+	for _, r := range resources {
+		resourcesByID[r.ID] = r
+		resourceIDs = append(resourceIDs, r.ID)
+	}
+	hours, err := SumHoursByResource(ownerID, year, month, resourceIDs)
+	if err != nil {
+		return report, err
+	}
+
+	// Only calendars that use a shared resource get a column
+	usedCalendars := make(map[uint]bool)
+	for _, link := range links {
+		usedCalendars[link.CalendarID] = true
+	}
+	for _, h := range hours {
+		usedCalendars[h.CalendarID] = true
+	}
+	monthTargets := make(map[uint]float64)
+	for _, calendar := range calendars {
+		if !usedCalendars[calendar.ID] {
+			continue
+		}
+		report.Calendars = append(report.Calendars, calendar)
+		monthTargets[calendar.ID] = calculateWorkStats(calendar, nil, year, month).TotalWorkHours
+	}
+
+	rows := make(map[uint]*SharedResourceReportRow, len(resources))
+	tree := BuildWorkResourceTree(resources)
+	for _, item := range tree {
+		rows[item.Resource.ID] = &SharedResourceReportRow{Item: item, CalendarHours: make(map[uint]float64)}
+	}
+
+	// Add a resource's own numbers to itself and every ancestor
+	addToTree := func(resourceID, calendarID uint, target, logged float64) {
+		ids := append([]uint{resourceID}, workResourceAncestors(resourceID, resourcesByID)...)
+		for _, id := range ids {
+			row, ok := rows[id]
+			if !ok {
+				continue
+			}
+			row.TargetHours += target
+			row.LoggedHours += logged
+			if logged != 0 {
+				row.CalendarHours[calendarID] += logged
+			}
+		}
+	}
+	for _, link := range links {
+		target := monthTargets[link.CalendarID] * float64(link.ResourcesPercentage) / 100
+		addToTree(link.WorkResourceID, link.CalendarID, target, 0)
+	}
+	for _, h := range hours {
+		addToTree(h.WorkResourceID, h.CalendarID, 0, h.Hours)
+	}
+
+	for _, item := range tree {
+		report.Rows = append(report.Rows, *rows[item.Resource.ID])
+	}
+	return report, nil
+}
@@ -0,0 +1,69 @@
+package calendar
+
+import (
+	"gothstack/plugins/auth"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+)
+
+// TagReportData holds hours per tag for a date range
+type TagReportData struct {
+	From       string // "2006-01-02"
+	To         string // "2006-01-02"
+	CalendarID uint
+	Calendars  []Calendar
+	Rows       []TagHours
+	Untagged   TagHours
+}
+
+// HandleTagReport renders the hours per tag for a date range, independent of work resources.
+// The range defaults to the current month.
+func HandleTagReport(kit *kit.Kit) error {
+	// Entry dates are stored as UTC midnight, so the range bounds are too
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+
+	query := kit.Request.URL.Query()
+	if d, err := time.Parse("2006-01-02", query.Get("from")); err == nil {
+		from = d
+	}
+	if d, err := time.Parse("2006-01-02", query.Get("to")); err == nil {
+		to = d
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	var calendarID uint
+	if id, err := strconv.ParseUint(query.Get("calendar"), 10, 32); err == nil {
+		calendarID = uint(id)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendars, err := ListCalendars(userID)
+	if err != nil {
+		return err
+	}
+	// Include the whole last day of the range
+	end := to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	rows, err := SumHoursByTag(userID, calendarID, from, end)
+	if err != nil {
+		return err
+	}
+	untagged, err := SumUntaggedHours(userID, calendarID, from, end)
+	if err != nil {
+		return err
+	}
+
+	data := TagReportData{
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		CalendarID: calendarID,
+		Calendars:  calendars,
+		Rows:       rows,
+		Untagged:   untagged,
+	}
+	return kit.Render(TagReport(data))
+}
@@ -0,0 +1,219 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Column widths in millimetres of the daily table of the PDF timesheet
+var timesheetPDFColumns = []float64{22, 12, 16, 45, 85}
+
+// timesheetPDF holds what the PDF timesheet of a calendar month is built from
+type timesheetPDF struct {
+	Calendar Calendar
+	Employee auth.User
+	Year     int
+	Month    int
+	Days     []DayStats
+	Stats    WorkMonthStats
+	Tree     []WorkResourceTreeItem
+}
+
+// employeeName returns the full name of the employee, or the email when no name is set
+func (t timesheetPDF) employeeName() string {
+	name := strings.TrimSpace(t.Employee.FirstName + " " + t.Employee.LastName)
+	if name == "" {
+		return t.Employee.Email
+	}
+	return name
+}
+
+// Write renders the timesheet as an A4 PDF document
+func (t timesheetPDF) Write(w io.Writer) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	// Core fonts are cp1252 encoded, which covers Finnish letters
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	period := fmt.Sprintf("%s %d", time.Month(t.Month), t.Year)
+	pdf.SetTitle(tr("Timesheet "+period+" "+t.employeeName()), false)
+	pdf.SetAuthor(tr(t.employeeName()), false)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 8, tr(fmt.Sprintf("%s, %s - page %d/{nb}", t.Calendar.Name, period, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Heading
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, tr("Timesheet "+period), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, tr("Employee: "+t.employeeName()+" <"+t.Employee.Email+">"), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, tr("Calendar: "+t.Calendar.Name), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	// Target against logged hours
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, "Summary", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	summary := [][2]string{
+		{"Working days", fmt.Sprintf("%d", t.Stats.WorkingDays)},
+		{"Daily work hours", fmt.Sprintf("%.2f", t.Calendar.DailyWorkHours)},
+		{"Target hours", fmt.Sprintf("%.2f", t.Stats.TotalWorkHours)},
+		{"Logged hours", fmt.Sprintf("%.2f", t.Stats.LoggedHours)},
+		{"Difference", fmt.Sprintf("%+.2f", t.Stats.LoggedHours-t.Stats.TotalWorkHours)},
+	}
+	for _, line := range summary {
+		pdf.CellFormat(45, 6, line[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(25, 6, line[1], "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(3)
+
+	t.writeDays(pdf, tr)
+	t.writeResources(pdf, tr)
+	t.writeHolidays(pdf, tr)
+	t.writeSignatures(pdf, tr)
+	return pdf.Output(w)
+}
+
+// writeDaysHeader writes the header row of the daily table
+func writeDaysHeader(pdf *fpdf.Fpdf) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(229, 231, 235)
+	for i, title := range []string{"Date", "Day", "Hours", "Resource", "Description"} {
+		align := "L"
+		if i == 2 {
+			align = "R"
+		}
+		pdf.CellFormat(timesheetPDFColumns[i], 6, title, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+}
+
+// writeDays writes one row per entry, and one per day without entries, shading weekends and holidays
+func (t timesheetPDF) writeDays(pdf *fpdf.Fpdf, tr func(string) string) {
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, "Daily entries", "", 1, "L", false, 0, "")
+	writeDaysHeader(pdf)
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	row := func(day DayStats, hours, resource, text string) {
+		if pdf.GetY()+5 > pageHeight-bottom-15 {
+			pdf.AddPage()
+			writeDaysHeader(pdf)
+		}
+		fill := day.IsWeekend || day.IsHoliday
+		switch {
+		case day.IsHoliday:
+			pdf.SetFillColor(254, 226, 226)
+		case day.IsWeekend:
+			pdf.SetFillColor(219, 234, 254)
+		}
+		values := []string{day.Date.Format("02.01.2006"), day.Date.Format("Mon"), hours, resource, text}
+		for i, value := range values {
+			align := "L"
+			if i == 2 {
+				align = "R"
+			}
+			// Cut long values to the column so that every row stays one line high
+			for value != "" && pdf.GetStringWidth(tr(value)) > timesheetPDFColumns[i]-2 {
+				value = string([]rune(value)[:len([]rune(value))-1])
+			}
+			pdf.CellFormat(timesheetPDFColumns[i], 5, tr(value), "", 0, align, fill, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	for _, day := range t.Days {
+		note := ""
+		if day.IsHoliday {
+			note = day.HolidayName
+		}
+		if len(day.Entries) == 0 {
+			row(day, "", "", note)
+			continue
+		}
+		for _, entry := range day.Entries {
+			text := entry.Text
+			if note != "" {
+				text = note + ": " + text
+			}
+			row(day, fmt.Sprintf("%.2f", entry.Hours), entry.WorkResource.Name, text)
+		}
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(timesheetPDFColumns[0]+timesheetPDFColumns[1], 6, "Total", "T", 0, "L", false, 0, "")
+	pdf.CellFormat(timesheetPDFColumns[2], 6, fmt.Sprintf("%.2f", t.Stats.LoggedHours), "T", 0, "R", false, 0, "")
+	pdf.CellFormat(timesheetPDFColumns[3]+timesheetPDFColumns[4], 6, "", "T", 1, "L", false, 0, "")
+	pdf.Ln(3)
+}
+
+// writeResources writes the target and logged hours per resource
+func (t timesheetPDF) writeResources(pdf *fpdf.Fpdf, tr func(string) string) {
+	if len(t.Tree) == 0 {
+		return
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, "Resources", "", 1, "L", false, 0, "")
+	widths := []float64{80, 25, 25, 25, 25}
+	pdf.SetFont("Helvetica", "B", 9)
+	for i, title := range []string{"Resource", "Allocation", "Target", "Logged", "Progress"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 6, title, "B", 0, align, false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, item := range t.Tree {
+		stats := t.Stats.ResourceStats[item.Resource.ID]
+		pdf.CellFormat(widths[0], 5, tr(strings.Repeat("   ", item.Depth)+item.Resource.Name), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 5, fmt.Sprintf("%d%%", stats.Percentage), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 5, fmt.Sprintf("%.2f", stats.TargetHours), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 5, fmt.Sprintf("%.2f", stats.LoggedHours), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 5, fmt.Sprintf("%.1f%%", stats.Progress), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(3)
+}
+
+// writeHolidays lists the holidays on weekdays of the month
+func (t timesheetPDF) writeHolidays(pdf *fpdf.Fpdf, tr func(string) string) {
+	if len(t.Stats.Holidays) == 0 {
+		return
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, "Holidays", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, holiday := range t.Stats.Holidays {
+		pdf.CellFormat(0, 5, tr(holiday.Date.Format("Mon 02.01.")+"  "+holiday.Name), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(3)
+}
+
+// writeSignatures writes the signature lines of the employee and the supervisor,
+// kept together on the last page
+func (t timesheetPDF) writeSignatures(pdf *fpdf.Fpdf, tr func(string) string) {
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+40 > pageHeight-bottom-15 {
+		pdf.AddPage()
+	}
+	pdf.Ln(15)
+	left, _, _, _ := pdf.GetMargins()
+	y := pdf.GetY()
+	pdf.Line(left, y, left+80, y)
+	pdf.Line(left+100, y, left+180, y)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(100, 5, tr("Employee: "+t.employeeName()), "", 0, "L", false, 0, "")
+	pdf.CellFormat(80, 5, "Supervisor", "", 1, "L", false, 0, "")
+	pdf.CellFormat(100, 5, "Date and signature", "", 0, "L", false, 0, "")
+	pdf.CellFormat(80, 5, "Date and signature", "", 1, "L", false, 0, "")
+}
@@ -0,0 +1,354 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackerFormats names the time trackers whose exports can be imported
+var TrackerFormats = []struct {
+	Key   string
+	Label string
+}{
+	{"toggl", "Toggl Track (detailed report CSV)"},
+	{"clockify", "Clockify (detailed report CSV or JSON)"},
+	{"harvest", "Harvest (detailed time report CSV or API JSON)"},
+}
+
+// trackerDefaultTask is the task of tracker entries that have a project but no task
+const trackerDefaultTask = "General"
+
+// TrackerTimeEntry is a time entry read from a time tracker export
+type TrackerTimeEntry struct {
+	Date        time.Time
+	Client      string
+	Project     string
+	Task        string
+	Description string
+	Hours       float64
+}
+
+// TrackerDay is the time entries of one day and task aggregated into one calendar entry
+type TrackerDay struct {
+	Date     time.Time
+	Client   string
+	Project  string
+	Task     string
+	Text     string
+	Hours    float64
+	Entries  int
+	Imported bool     // an entry with the import UID already exists
+	Errors   []string // reasons the day is not imported
+}
+
+// Path returns the resource path of the day, empty for entries without a project
+func (d TrackerDay) Path() string {
+	if d.Project == "" {
+		return ""
+	}
+	parts := []string{d.Project, d.Task}
+	if d.Client != "" {
+		parts = append([]string{d.Client}, parts...)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// ImportUID returns the identifier stored on the entry created from the day, so
+// that importing an overlapping export again skips the days imported before
+func (d TrackerDay) ImportUID(format string) string {
+	return format + ":" + d.Date.Format("2006-01-02") + ":" + d.Path()
+}
+
+// trackerDateLayouts are tried in order on tracker dates, whose format depends on user settings
+var trackerDateLayouts = []string{"2006-01-02", "01/02/2006", "02.01.2006", "2.1.2006"}
+
+// parseTrackerDate parses the date of a tracker entry
+func parseTrackerDate(value string) (time.Time, error) {
+	for _, layout := range trackerDateLayouts {
+		if date, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseTrackerDuration parses a duration written as decimal hours or as h:mm:ss
+func parseTrackerDuration(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, ":") {
+		return strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	}
+	parts := strings.Split(value, ":")
+	var hours float64
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || i > 2 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		hours += float64(n) / []float64{1, 60, 3600}[i]
+	}
+	return hours, nil
+}
+
+// trackerCSV gives access to the columns of a tracker CSV export by their header names
+type trackerCSV struct {
+	columns map[string]int
+	records [][]string
+}
+
+// newTrackerCSV reads the export and checks that it has the required columns
+func newTrackerCSV(content []byte, required ...string) (trackerCSV, error) {
+	records, err := readCSVRecords(content, detectCSVDelimiter(content))
+	if err != nil {
+		return trackerCSV{}, err
+	}
+	if len(records) == 0 {
+		return trackerCSV{}, fmt.Errorf("the file is empty")
+	}
+	file := trackerCSV{columns: make(map[string]int), records: records[1:]}
+	for i, name := range records[0] {
+		file.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := file.columns[strings.ToLower(name)]; !ok {
+			return file, fmt.Errorf("the file has no %q column, is it the right export?", name)
+		}
+	}
+	return file, nil
+}
+
+// value returns the first of the named columns present in the record
+func (f trackerCSV) value(record []string, names ...string) string {
+	for _, name := range names {
+		if i, ok := f.columns[strings.ToLower(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// entries converts every record with the date and duration columns given
+func (f trackerCSV) entries(dateColumn string, durationColumns ...string) ([]TrackerTimeEntry, error) {
+	var entries []TrackerTimeEntry
+	for i, record := range f.records {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		date, err := parseTrackerDate(f.value(record, dateColumn))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		hours, err := parseTrackerDuration(f.value(record, durationColumns...))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		entries = append(entries, TrackerTimeEntry{
+			Date:        date,
+			Client:      f.value(record, "Client"),
+			Project:     f.value(record, "Project"),
+			Task:        f.value(record, "Task"),
+			Description: f.value(record, "Description", "Notes"),
+			Hours:       hours,
+		})
+	}
+	return entries, nil
+}
+
+// parseTogglExport reads a Toggl Track detailed report CSV
+func parseTogglExport(content []byte) ([]TrackerTimeEntry, error) {
+	file, err := newTrackerCSV(content, "Start date", "Duration", "Project")
+	if err != nil {
+		return nil, err
+	}
+	return file.entries("Start date", "Duration")
+}
+
+// clockifyJSONEntry is a time entry of a Clockify detailed report in JSON
+type clockifyJSONEntry struct {
+	Description  string `json:"description"`
+	ProjectName  string `json:"projectName"`
+	ClientName   string `json:"clientName"`
+	TaskName     string `json:"taskName"`
+	TimeInterval struct {
+		Start    time.Time       `json:"start"`
+		Duration json.RawMessage `json:"duration"` // seconds, or an ISO 8601 duration
+	} `json:"timeInterval"`
+}
+
+// parseClockifyExport reads a Clockify detailed report as CSV or JSON
+func parseClockifyExport(content []byte) ([]TrackerTimeEntry, error) {
+	if isJSON(content) {
+		var report struct {
+			TimeEntries []clockifyJSONEntry `json:"timeentries"`
+		}
+		var list []clockifyJSONEntry
+		if err := json.Unmarshal(content, &list); err != nil {
+			if err := json.Unmarshal(content, &report); err != nil {
+				return nil, fmt.Errorf("the file is not a Clockify JSON export: %w", err)
+			}
+			list = report.TimeEntries
+		}
+		entries := make([]TrackerTimeEntry, 0, len(list))
+		for i, item := range list {
+			var hours float64
+			var seconds float64
+			var iso string
+			if err := json.Unmarshal(item.TimeInterval.Duration, &seconds); err == nil {
+				hours = seconds / 3600
+			} else if err := json.Unmarshal(item.TimeInterval.Duration, &iso); err == nil {
+				duration, err := parseICalDuration(iso)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: %w", i+1, err)
+				}
+				hours = duration.Hours()
+			} else {
+				return nil, fmt.Errorf("entry %d: invalid duration", i+1)
+			}
+			start := item.TimeInterval.Start.Local()
+			entries = append(entries, TrackerTimeEntry{
+				Date:        time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC),
+				Client:      item.ClientName,
+				Project:     item.ProjectName,
+				Task:        item.TaskName,
+				Description: item.Description,
+				Hours:       hours,
+			})
+		}
+		return entries, nil
+	}
+	file, err := newTrackerCSV(content, "Start Date", "Project")
+	if err != nil {
+		return nil, err
+	}
+	return file.entries("Start Date", "Duration (decimal)", "Duration (h)")
+}
+
+// harvestJSONEntry is a time entry of the Harvest API
+type harvestJSONEntry struct {
+	SpentDate string  `json:"spent_date"`
+	Hours     float64 `json:"hours"`
+	Notes     string  `json:"notes"`
+	Client    struct {
+		Name string `json:"name"`
+	} `json:"client"`
+	Project struct {
+		Name string `json:"name"`
+	} `json:"project"`
+	Task struct {
+		Name string `json:"name"`
+	} `json:"task"`
+}
+
+// parseHarvestExport reads a Harvest detailed time report CSV or time entries of the API
+func parseHarvestExport(content []byte) ([]TrackerTimeEntry, error) {
+	if isJSON(content) {
+		var response struct {
+			TimeEntries []harvestJSONEntry `json:"time_entries"`
+		}
+		if err := json.Unmarshal(content, &response); err != nil {
+			return nil, fmt.Errorf("the file is not a Harvest JSON export: %w", err)
+		}
+		entries := make([]TrackerTimeEntry, 0, len(response.TimeEntries))
+		for i, item := range response.TimeEntries {
+			date, err := parseTrackerDate(item.SpentDate)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+			entries = append(entries, TrackerTimeEntry{
+				Date:        date,
+				Client:      item.Client.Name,
+				Project:     item.Project.Name,
+				Task:        item.Task.Name,
+				Description: item.Notes,
+				Hours:       item.Hours,
+			})
+		}
+		return entries, nil
+	}
+	file, err := newTrackerCSV(content, "Date", "Hours", "Project")
+	if err != nil {
+		return nil, err
+	}
+	return file.entries("Date", "Hours")
+}
+
+// isJSON reports whether the content looks like a JSON document rather than CSV
+func isJSON(content []byte) bool {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\ufeff")))
+	return len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{')
+}
+
+// ParseTrackerExport reads the time entries of an export in one of the TrackerFormats
+func ParseTrackerExport(format string, content []byte) ([]TrackerTimeEntry, error) {
+	switch format {
+	case "toggl":
+		return parseTogglExport(content)
+	case "clockify":
+		return parseClockifyExport(content)
+	case "harvest":
+		return parseHarvestExport(content)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// AggregateTrackerEntries sums the time entries per day and task, joining their distinct
+// descriptions into the text of the day. Like the rows of a CSV import, a day is given errors
+// when one of its entries or their sum is not within 0 to 24 hours.
+func AggregateTrackerEntries(entries []TrackerTimeEntry) []TrackerDay {
+	index := make(map[string]int)
+	var days []TrackerDay
+	descriptions := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		day := TrackerDay{Date: entry.Date, Client: entry.Client, Project: entry.Project, Task: entry.Task}
+		if day.Project == "" {
+			day.Client, day.Task = "", ""
+		} else if day.Task == "" {
+			day.Task = trackerDefaultTask
+		}
+		key := day.Date.Format("2006-01-02") + "\x00" + day.Path()
+		i, ok := index[key]
+		if !ok {
+			i = len(days)
+			index[key] = i
+			days = append(days, day)
+			descriptions[key] = make(map[string]bool)
+		}
+		if entry.Hours < 0 || entry.Hours > 24 {
+			days[i].Errors = append(days[i].Errors, fmt.Sprintf("invalid hours %.2f in an entry", entry.Hours))
+		}
+		days[i].Hours += entry.Hours
+		days[i].Entries++
+		if description := strings.TrimSpace(entry.Description); description != "" && !descriptions[key][description] {
+			descriptions[key][description] = true
+			if days[i].Text != "" {
+				days[i].Text += "; "
+			}
+			days[i].Text += description
+		}
+	}
+	for i := range days {
+		days[i].Hours = math.Round(days[i].Hours*100) / 100
+		if days[i].Hours > 24 && len(days[i].Errors) == 0 {
+			days[i].Errors = append(days[i].Errors, fmt.Sprintf("%.2f hours in a day", days[i].Hours))
+		}
+		if days[i].Text == "" {
+			days[i].Text = days[i].Project
+		}
+		if days[i].Text == "" {
+			days[i].Text = "(no description)"
+		}
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		if !days[i].Date.Equal(days[j].Date) {
+			return days[i].Date.Before(days[j].Date)
+		}
+		return days[i].Path() < days[j].Path()
+	})
+	return days
+}
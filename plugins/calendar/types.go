@@ -3,6 +3,7 @@ package calendar
 import (
 	"fmt"
 	"gothstack/app/db"
+	"gothstack/app/outbox"
 	"gothstack/plugins/auth"
 	"time"
 
@@ -17,6 +18,7 @@ type Calendar struct {
 	OwnerID        uint   `gorm:"not null"`
 	Work           bool
 	DailyWorkHours float64
+	SharedWorkday  bool           // a work calendar sharing the working day of the other work calendars
 	CreatedAt      time.Time      `gorm:"not null"`
 	UpdatedAt      time.Time      `gorm:"not null"`
 	DeletedAt      gorm.DeletedAt `gorm:"index"`
@@ -37,6 +39,9 @@ type CalendarEntry struct {
 	Week           int       `gorm:"not null"`
 	Hours          float64
 	Text           string         `gorm:"not null"`
+	StartTime      string         // "15:04", empty for entries without a time of day
+	EndTime        string         // "15:04", empty for entries without a time of day
+	ImportUID      string         // identifier of the imported event or record, empty for entries created here
 	CreatedAt      time.Time      `gorm:"not null"`
 	UpdatedAt      time.Time      `gorm:"not null"`
 	DeletedAt      gorm.DeletedAt `gorm:"index"`
@@ -44,28 +49,37 @@ type CalendarEntry struct {
 	// Relationship field
 	Calendar     Calendar     `gorm:"foreignKey:CalendarID"`
 	WorkResource WorkResource `gorm:"foreignKey:WorkResourceID"`
+	Tags         []Tag        `gorm:"many2many:calendar_entry_tags;"`
 }
 
 // Event name constants
 const (
 	CalendarCreatedEvent      = "calendar.created"
 	CalendarEntryCreatedEvent = "calendar.entry.created"
+	CalendarEntryUpdatedEvent = "calendar.entry.updated"
+	CalendarEntryDeletedEvent = "calendar.entry.deleted"
 )
 
-// CreateCalendar creates a new calendar with the given name and index number
-func CreateCalendar(name string, work bool, avgHours float64, owner_id uint) (Calendar, error) {
+// CreateCalendar creates a new calendar with the given name and index number and publishes its created event
+func CreateCalendar(name string, work bool, avgHours float64, sharedWorkday bool, owner_id uint) (Calendar, error) {
 	//get index number automatically?
 	calendar := Calendar{
 		Name:           name,
 		IndexNumber:    1,
 		Work:           work,
 		DailyWorkHours: avgHours,
+		SharedWorkday:  sharedWorkday,
 		OwnerID:        owner_id,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
-	result := db.Get().Create(&calendar)
-	return calendar, result.Error
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&calendar).Error; err != nil {
+			return err
+		}
+		return publishCalendarEvents(tx, newCalendarEvent(CalendarCreatedEvent, calendar.ID, newAPICalendar(calendar)))
+	})
+	return calendar, err
 }
 
 // GetCalendar retrieves a calendar by its ID
@@ -75,6 +89,13 @@ func GetCalendar(id, ownerID uint) (Calendar, error) {
 	return calendar, result.Error
 }
 
+// GetCalendarOwner returns the user who owns the calendar
+func GetCalendarOwner(calendar Calendar) (auth.User, error) {
+	var user auth.User
+	result := db.Get().First(&user, calendar.OwnerID)
+	return user, result.Error
+}
+
 func ListCalendars(ownerID uint) ([]Calendar, error) {
 	var calendars []Calendar
 	result := db.Get().Where("owner_id = ?", ownerID).Order("index_number asc").Find(&calendars)
@@ -107,6 +128,7 @@ func GetCalendarWithEntries(id uint, ownerID uint) (Calendar, error) {
 		// Eager load the WorkResource relationship for each entry
 		// This prevents the N+1 query problem by loading all related resources in one go
 		Preload("WorkResource").
+		Preload("Tags").
 		// Populate the Entries slice of our calendar struct
 		Find(&calendar.Entries).Error; err != nil {
 		// If an error occurs while fetching entries, return what we have so far with the error
@@ -130,6 +152,26 @@ func GetCalendarWithEntriesByMonth(calendarID uint, ownerID uint, year, month in
 		Where("calendar_id = ? AND year = ? AND month = ?", calendarID, year, month).
 		Order("date asc").
 		Preload("WorkResource").
+		Preload("Tags").
+		Find(&calendar.Entries).Error; err != nil {
+		return calendar, err
+	}
+
+	return calendar, nil
+}
+
+// GetCalendarWithEntriesByDateRange returns the calendar with its entries from start up to, but not including, end
+func GetCalendarWithEntriesByDateRange(calendarID uint, ownerID uint, start, end time.Time) (Calendar, error) {
+	var calendar Calendar
+	if err := db.Get().Where("id = ? AND owner_id = ?", calendarID, ownerID).First(&calendar).Error; err != nil {
+		return calendar, err
+	}
+
+	if err := db.Get().
+		Where("calendar_id = ? AND date >= ? AND date < ?", calendarID, start, end).
+		Order("date asc").
+		Preload("WorkResource").
+		Preload("Tags").
 		Find(&calendar.Entries).Error; err != nil {
 		return calendar, err
 	}
@@ -137,6 +179,22 @@ func GetCalendarWithEntriesByMonth(calendarID uint, ownerID uint, year, month in
 	return calendar, nil
 }
 
+// ListCalendarsWithEntriesByDateRange returns the calendars of the owner with their entries
+// from start up to, but not including, end
+func ListCalendarsWithEntriesByDateRange(ownerID uint, start, end time.Time) ([]Calendar, error) {
+	var calendars []Calendar
+	err := db.Get().
+		Where("owner_id = ?", ownerID).
+		Order("index_number asc").
+		Preload("Entries", func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("date >= ? AND date < ?", start, end).Order("date asc")
+		}).
+		Preload("Entries.WorkResource").
+		Preload("Entries.Tags").
+		Find(&calendars).Error
+	return calendars, err
+}
+
 // ListCalendarEntries returns all entries for a specific calendar
 func ListCalendarEntries(calendarID uint) ([]CalendarEntry, error) {
 	var entries []CalendarEntry
@@ -144,13 +202,44 @@ func ListCalendarEntries(calendarID uint) ([]CalendarEntry, error) {
 	return entries, result.Error
 }
 
+// entriesByDateRange returns a query over the calendar entries within a specific date range
+func entriesByDateRange(calendarID uint, startDate, endDate time.Time) *gorm.DB {
+	return db.Get().Model(&CalendarEntry{}).Where("calendar_id = ? AND date BETWEEN ? AND ?", calendarID, startDate, endDate)
+}
+
 // GetEntriesByDateRange returns calendar entries within a specific date range
 func GetEntriesByDateRange(calendarID uint, startDate, endDate time.Time) ([]CalendarEntry, error) {
 	var entries []CalendarEntry
-	result := db.Get().Where("calendar_id = ? AND date BETWEEN ? AND ?", calendarID, startDate, endDate).Order("date asc").Find(&entries)
+	result := entriesByDateRange(calendarID, startDate, endDate).Order("date asc").Find(&entries)
 	return entries, result.Error
 }
 
+// StreamEntriesByDateRange passes the calendar entries within a specific date range to fn in
+// date order, a batch at a time, so that large ranges are never loaded into memory at once
+func StreamEntriesByDateRange(calendarID uint, startDate, endDate time.Time, batchSize int, fn func([]CalendarEntry) error) error {
+	for offset := 0; ; offset += batchSize {
+		var batch []CalendarEntry
+		result := entriesByDateRange(calendarID, startDate, endDate).
+			Order("date asc, id asc").
+			Limit(batchSize).
+			Offset(offset).
+			Preload("WorkResource").
+			Preload("Tags").
+			Find(&batch)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+	}
+}
+
 // GetEntriesByYearMonth returns calendar entries for a specific year and month
 func GetEntriesByYearMonth(calendarID uint, year, month int) ([]CalendarEntry, error) {
 	var entries []CalendarEntry
@@ -161,16 +250,16 @@ func GetEntriesByYearMonth(calendarID uint, year, month int) ([]CalendarEntry, e
 // GetCalendarEntry retrieves a calendar entry by its ID
 func GetCalendarEntry(entryID uint) (CalendarEntry, error) {
 	var entry CalendarEntry
-	result := db.Get().First(&entry, entryID)
+	result := db.Get().Preload("Tags").First(&entry, entryID)
 	if result.Error != nil {
 		return entry, fmt.Errorf("failed to retrieve calendar entry: %w", result.Error)
 	}
 	return entry, nil
 }
 
-// CreateCalendarEntry creates a new calendar entry
-func CreateCalendarEntry(calendarID uint, date time.Time, text string, hours float64, workResourceID uint) (CalendarEntry, error) {
-	entry := CalendarEntry{
+// newCalendarEntry returns an unsaved calendar entry with the year, month and week of its date
+func newCalendarEntry(calendarID uint, date time.Time, text string, hours float64, workResourceID uint) CalendarEntry {
+	return CalendarEntry{
 		CalendarID:     calendarID,
 		Date:           date,
 		Year:           date.Year(),
@@ -182,46 +271,78 @@ func CreateCalendarEntry(calendarID uint, date time.Time, text string, hours flo
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}
-	result := db.Get().Create(&entry)
-	if result.Error != nil {
-		return entry, fmt.Errorf("failed to create calendar entry: %w", result.Error)
-	}
-	return entry, nil
 }
 
-// UpdateCalendarEntry updates an existing calendar entry
-func UpdateCalendarEntry(entryID uint, date time.Time, text string, hours float64, workResourceID uint) (CalendarEntry, error) {
+// CreateCalendarEntry creates a calendar entry from the entry form values, with its tags
+// and time of day, and publishes its created event
+func CreateCalendarEntry(calendarID, ownerID uint, date time.Time, values CalendarEntryFormValues) (CalendarEntry, error) {
+	entry := newCalendarEntry(calendarID, date, values.Text, values.Hours, values.WorkResourceID)
+	entry.StartTime, entry.EndTime = values.StartTime, values.EndTime
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("failed to create calendar entry: %w", err)
+		}
+		if err := setCalendarEntryTags(tx, &entry, ownerID, EntryTags(values.Text, values.Tags)); err != nil {
+			return fmt.Errorf("failed to save calendar entry tags: %w", err)
+		}
+		return publishEntryEvent(tx, CalendarEntryCreatedEvent, entry)
+	})
+	return entry, err
+}
+
+// UpdateCalendarEntry updates an existing calendar entry from the entry form values, with its
+// tags and time of day, and publishes its updated event
+func UpdateCalendarEntry(entryID, ownerID uint, date time.Time, values CalendarEntryFormValues) (CalendarEntry, error) {
 	var entry CalendarEntry
-	result := db.Get().First(&entry, entryID)
-	if result.Error != nil {
-		return entry, fmt.Errorf("failed to retrieve calendar entry: %w", result.Error)
-	}
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&entry, entryID).Error; err != nil {
+			return fmt.Errorf("failed to retrieve calendar entry: %w", err)
+		}
 
-	// Update the entry fields
-	entry.Date = date
-	entry.Year = date.Year()
-	entry.Month = int(date.Month())
-	entry.Week = getISOWeek(date)
-	entry.Text = text
-	entry.Hours = hours
-	entry.WorkResourceID = workResourceID
-	entry.UpdatedAt = time.Now()
-
-	// Save the updated entry
-	result = db.Get().Save(&entry)
-	if result.Error != nil {
-		return entry, fmt.Errorf("failed to update calendar entry: %w", result.Error)
-	}
-	return entry, nil
+		// Update the entry fields
+		entry.Date = date
+		entry.Year = date.Year()
+		entry.Month = int(date.Month())
+		entry.Week = getISOWeek(date)
+		entry.Text = values.Text
+		entry.Hours = values.Hours
+		entry.WorkResourceID = values.WorkResourceID
+		entry.StartTime, entry.EndTime = values.StartTime, values.EndTime
+		entry.UpdatedAt = time.Now()
+
+		// Save the updated entry
+		if err := tx.Save(&entry).Error; err != nil {
+			return fmt.Errorf("failed to update calendar entry: %w", err)
+		}
+		if err := setCalendarEntryTags(tx, &entry, ownerID, EntryTags(values.Text, values.Tags)); err != nil {
+			return fmt.Errorf("failed to save calendar entry tags: %w", err)
+		}
+		return publishEntryEvent(tx, CalendarEntryUpdatedEvent, entry)
+	})
+	return entry, err
 }
 
-// DeleteCalendarEntry deletes a calendar entry
-func DeleteCalendarEntry(entryID uint) error {
-	result := db.Get().Delete(&CalendarEntry{}, entryID)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete calendar entry: %w", result.Error)
-	}
-	return nil
+// HasTime reports whether the entry has a start and an end time
+func (e CalendarEntry) HasTime() bool {
+	return e.StartTime != "" && e.EndTime != ""
+}
+
+// DeleteCalendarEntry deletes a calendar entry, loaded with its tags, and publishes its deleted event
+func DeleteCalendarEntry(entry CalendarEntry) error {
+	return outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&CalendarEntry{}, entry.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete calendar entry: %w", err)
+		}
+		return publishEntryEvent(tx, CalendarEntryDeletedEvent, entry)
+	})
+}
+
+// isoWeekStart returns the Monday that starts the given ISO 8601 week, at UTC midnight
+func isoWeekStart(year, week int) time.Time {
+	// January 4th is always in week 1
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	offset := (int(jan4.Weekday()) + 6) % 7 // days since Monday
+	return jan4.AddDate(0, 0, -offset+(week-1)*7)
 }
 
 // getISOWeek returns the ISO 8601 week number for a given date
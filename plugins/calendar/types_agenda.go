@@ -0,0 +1,108 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AgendaFilter narrows the entries of a calendar shown in the agenda view.
+// From and To are inclusive like in GetEntriesByDateRange; other zero values mean no filtering.
+type AgendaFilter struct {
+	From           time.Time
+	To             time.Time
+	WorkResourceID uint
+	Text           string
+	MinHours       float64
+	MaxHours       float64
+	Sort           string // one of AgendaSortOptions, date_desc by default
+	Limit          int
+	Offset         int
+}
+
+// AgendaSortOptions maps the agenda sort options to their SQL ordering
+var AgendaSortOptions = map[string]string{
+	"date_desc":  "date desc, id desc",
+	"date_asc":   "date asc, id asc",
+	"hours_desc": "hours desc, date desc",
+	"hours_asc":  "hours asc, date desc",
+}
+
+// AgendaTotals holds the subtotals of every entry matching an agenda filter, not only the current page
+type AgendaTotals struct {
+	Entries int64
+	Hours   float64
+	ByDay   map[string]float64 // keyed by "2006-01-02"
+	ByWeek  map[string]float64 // keyed by AgendaWeekKey
+}
+
+// AgendaWeekKey returns the key of the ISO week containing date in AgendaTotals.ByWeek
+func AgendaWeekKey(date time.Time) string {
+	year, week := date.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// agendaQuery returns the query over the entries of a calendar matching the filter
+func agendaQuery(calendarID uint, filter AgendaFilter) *gorm.DB {
+	query := entriesByDateRange(calendarID, filter.From, filter.To)
+	if filter.WorkResourceID != 0 {
+		query = query.Where("work_resource_id = ?", filter.WorkResourceID)
+	}
+	if text := strings.TrimSpace(filter.Text); text != "" {
+		query = query.Where("text LIKE ?", "%"+text+"%")
+	}
+	if filter.MinHours > 0 {
+		query = query.Where("hours >= ?", filter.MinHours)
+	}
+	if filter.MaxHours > 0 {
+		query = query.Where("hours <= ?", filter.MaxHours)
+	}
+	return query
+}
+
+// ListAgendaEntries returns one page of the calendar entries matching the filter
+func ListAgendaEntries(calendarID uint, filter AgendaFilter) ([]CalendarEntry, error) {
+	var entries []CalendarEntry
+	order, ok := AgendaSortOptions[filter.Sort]
+	if !ok {
+		order = AgendaSortOptions["date_desc"]
+	}
+	query := agendaQuery(calendarID, filter).Order(order)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	result := query.
+		Preload("WorkResource").
+		Preload("Tags").
+		Find(&entries)
+	return entries, result.Error
+}
+
+// SumAgendaEntries returns the count and the daily and weekly hours of the calendar entries matching the filter
+func SumAgendaEntries(calendarID uint, filter AgendaFilter) (AgendaTotals, error) {
+	totals := AgendaTotals{
+		ByDay:  make(map[string]float64),
+		ByWeek: make(map[string]float64),
+	}
+	var days []struct {
+		Date    time.Time
+		Hours   float64
+		Entries int64
+	}
+	err := agendaQuery(calendarID, filter).
+		Select("date, SUM(hours) AS hours, COUNT(*) AS entries").
+		Group("date").
+		Scan(&days).Error
+	if err != nil {
+		return totals, err
+	}
+	for _, day := range days {
+		totals.Entries += day.Entries
+		totals.Hours += day.Hours
+		totals.ByDay[day.Date.Format("2006-01-02")] += day.Hours
+		totals.ByWeek[AgendaWeekKey(day.Date)] += day.Hours
+	}
+	return totals, nil
+}
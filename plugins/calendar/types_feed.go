@@ -0,0 +1,109 @@
+package calendar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gothstack/app/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Default and maximum window of a calendar feed, in days before and after today
+const (
+	DefaultFeedPastDays   = 90
+	DefaultFeedFutureDays = 365
+	MaxFeedWindowDays     = 3650
+)
+
+// CalendarFeed is the secret iCalendar subscription of a calendar. Anyone knowing the
+// token can read the feed, so the token is replaced when the feed is regenerated and
+// the feed is deleted when it is revoked.
+type CalendarFeed struct {
+	ID         uint   `gorm:"primaryKey"`
+	CalendarID uint   `gorm:"not null"`
+	Token      string `gorm:"not null"`
+	PastDays   int    `gorm:"not null"`
+	FutureDays int    `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	// Relationship field
+	Calendar Calendar `gorm:"foreignKey:CalendarID"`
+}
+
+// Window returns the first and last day of the entries included in the feed
+func (f CalendarFeed) Window(now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, -f.PastDays), today.AddDate(0, 0, f.FutureDays)
+}
+
+// newFeedToken returns a random URL safe token of 32 bytes
+func newFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate feed token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCalendarFeed returns the feed of a calendar, or gorm.ErrRecordNotFound when it has none
+func GetCalendarFeed(calendarID uint) (CalendarFeed, error) {
+	var feed CalendarFeed
+	result := db.Get().Where("calendar_id = ?", calendarID).First(&feed)
+	return feed, result.Error
+}
+
+// GetCalendarFeedByToken returns the feed with the token and its calendar
+func GetCalendarFeedByToken(token string) (CalendarFeed, error) {
+	var feed CalendarFeed
+	result := db.Get().Preload("Calendar").Where("token = ?", token).First(&feed)
+	return feed, result.Error
+}
+
+// SaveCalendarFeed sets the window of the calendar feed, creating the feed when the calendar has none
+func SaveCalendarFeed(calendarID uint, pastDays, futureDays int) (CalendarFeed, error) {
+	feed, err := GetCalendarFeed(calendarID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		token, err := newFeedToken()
+		if err != nil {
+			return feed, err
+		}
+		feed = CalendarFeed{CalendarID: calendarID, Token: token}
+	} else if err != nil {
+		return feed, err
+	}
+	feed.PastDays = pastDays
+	feed.FutureDays = futureDays
+	if err := db.Get().Save(&feed).Error; err != nil {
+		return feed, fmt.Errorf("failed to save calendar feed: %w", err)
+	}
+	return feed, nil
+}
+
+// RegenerateCalendarFeedToken replaces the token of the calendar feed, so the old URL stops working
+func RegenerateCalendarFeedToken(calendarID uint) (CalendarFeed, error) {
+	feed, err := GetCalendarFeed(calendarID)
+	if err != nil {
+		return feed, err
+	}
+	feed.Token, err = newFeedToken()
+	if err != nil {
+		return feed, err
+	}
+	if err := db.Get().Save(&feed).Error; err != nil {
+		return feed, fmt.Errorf("failed to save calendar feed: %w", err)
+	}
+	return feed, nil
+}
+
+// RevokeCalendarFeed deletes the feed of the calendar
+func RevokeCalendarFeed(calendarID uint) error {
+	result := db.Get().Where("calendar_id = ?", calendarID).Delete(&CalendarFeed{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke calendar feed: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/app/db"
+	"gothstack/app/outbox"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ListImportedUIDs returns which of the import UIDs already have an entry in the calendar
+func ListImportedUIDs(calendarID uint, uids []string) (map[string]bool, error) {
+	imported := make(map[string]bool)
+	if len(uids) == 0 {
+		return imported, nil
+	}
+	var existing []string
+	result := db.Get().Model(&CalendarEntry{}).
+		Where("calendar_id = ? AND import_uid IN ?", calendarID, uids).
+		Pluck("import_uid", &existing)
+	for _, uid := range existing {
+		imported[uid] = true
+	}
+	return imported, result.Error
+}
+
+// ImportCalendarEntries creates entries built with newCalendarEntry in a single transaction,
+// so that a failed import creates nothing. Entries with an import UID already present in their calendar are skipped.
+// The #tags in their text are saved as tags of the owner.
+// It returns the number of entries created and publishes their events with the import.
+func ImportCalendarEntries(ownerID uint, entries []CalendarEntry) (int, error) {
+	created := 0
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range entries {
+			if entry.ImportUID != "" {
+				var count int64
+				err := tx.Model(&CalendarEntry{}).
+					Where("calendar_id = ? AND import_uid = ?", entry.CalendarID, entry.ImportUID).
+					Count(&count).Error
+				if err != nil {
+					return err
+				}
+				if count > 0 {
+					continue
+				}
+			}
+			if err := tx.Create(&entry).Error; err != nil {
+				return fmt.Errorf("failed to create calendar entry: %w", err)
+			}
+			if err := setCalendarEntryTags(tx, &entry, ownerID, EntryTags(entry.Text, "")); err != nil {
+				return fmt.Errorf("failed to save calendar entry tags: %w", err)
+			}
+			if err := publishEntryEvent(tx, CalendarEntryCreatedEvent, entry); err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+// trackerResourceKey identifies a work resource by its parent, kind and lower case name
+type trackerResourceKey struct {
+	ParentID uint
+	Kind     string
+	Name     string
+}
+
+// ImportTrackerDays creates an entry for each day without errors not imported before, in a single transaction.
+// The client, project and task of each day are looked up among the resources of the calendar
+// by name, first among the attached shared resources and then among the calendar specific ones,
+// where missing resources are created on demand. Calendar specific resources cannot be placed
+// under shared ones, so a path is either shared or calendar specific as a whole. The #tags in the text of each day are saved as tags of the calendar owner.
+// It returns the number of entries and resources created and publishes their events with the import.
+func ImportTrackerDays(calendar Calendar, format string, days []TrackerDay) (int, int, error) {
+	created, createdResources := 0, 0
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		var resources []WorkResource
+		err := tx.Where("calendar_id = ? OR id IN (?)", calendar.ID,
+			tx.Model(&CalendarWorkResource{}).Select("work_resource_id").Where("calendar_id = ?", calendar.ID)).
+			Find(&resources).Error
+		if err != nil {
+			return err
+		}
+		sharedByKey := make(map[trackerResourceKey]uint)
+		localByKey := make(map[trackerResourceKey]uint)
+		for _, resource := range resources {
+			key := trackerResourceKey{resource.ParentID, resource.Kind, strings.ToLower(resource.Name)}
+			if resource.IsShared() {
+				sharedByKey[key] = resource.ID
+			} else {
+				localByKey[key] = resource.ID
+			}
+		}
+		// findShared returns the last shared resource of a path from the top level when they all exist
+		findShared := func(kinds, names []string) (uint, bool) {
+			var id uint
+			for i := range kinds {
+				var ok bool
+				if id, ok = sharedByKey[trackerResourceKey{id, kinds[i], strings.ToLower(names[i])}]; !ok {
+					return 0, false
+				}
+			}
+			return id, true
+		}
+		ensure := func(parentID uint, kind, name string) (uint, error) {
+			key := trackerResourceKey{parentID, kind, strings.ToLower(name)}
+			if id, ok := localByKey[key]; ok {
+				return id, nil
+			}
+			resource := WorkResource{
+				Name:       name,
+				OwnerID:    calendar.OwnerID,
+				CalendarID: calendar.ID,
+				ParentID:   parentID,
+				Kind:       kind,
+				CreatedAt:  time.Now(),
+				UpdatedAt:  time.Now(),
+			}
+			if err := tx.Create(&resource).Error; err != nil {
+				return 0, fmt.Errorf("failed to create work resource %q: %w", name, err)
+			}
+			if err := publishWorkResourceEvent(tx, WorkResourceCreatedEvent, resource); err != nil {
+				return 0, err
+			}
+			localByKey[key] = resource.ID
+			createdResources++
+			return resource.ID, nil
+		}
+
+		for _, day := range days {
+			if len(day.Errors) > 0 {
+				continue
+			}
+			uid := day.ImportUID(format)
+			var count int64
+			err := tx.Model(&CalendarEntry{}).
+				Where("calendar_id = ? AND import_uid = ?", calendar.ID, uid).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			var resourceID uint
+			if day.Project != "" {
+				kinds := WorkResourceKinds
+				names := []string{day.Client, day.Project, day.Task}
+				if day.Client == "" {
+					kinds, names = kinds[1:], names[1:]
+				}
+				var ok bool
+				if resourceID, ok = findShared(kinds, names); !ok {
+					for i := range kinds {
+						if resourceID, err = ensure(resourceID, kinds[i], names[i]); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			entry := newCalendarEntry(calendar.ID, day.Date, day.Text, day.Hours, resourceID)
+			entry.ImportUID = uid
+			if err := tx.Create(&entry).Error; err != nil {
+				return fmt.Errorf("failed to create calendar entry: %w", err)
+			}
+			if err := setCalendarEntryTags(tx, &entry, calendar.OwnerID, EntryTags(entry.Text, "")); err != nil {
+				return fmt.Errorf("failed to save calendar entry tags: %w", err)
+			}
+			if err := publishEntryEvent(tx, CalendarEntryCreatedEvent, entry); err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return created, createdResources, nil
+}
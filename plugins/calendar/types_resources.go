@@ -2,18 +2,24 @@ package calendar
 
 import (
 	"gothstack/app/db"
+	"gothstack/app/outbox"
 	"gothstack/plugins/auth"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-// WorkResource represents the work_resources table in the database
+// WorkResource represents the work_resources table in the database.
+// A resource with a zero CalendarID is shared: it belongs to its owner and is
+// attached to calendars through CalendarWorkResource rows.
 type WorkResource struct {
 	ID                  uint           `gorm:"primaryKey"`
 	Name                string         `gorm:"not null"`
 	OwnerID             uint           `gorm:"not null"`
 	CalendarID          uint           `gorm:"not null"`
+	ParentID            uint           `gorm:"not null;default:0"`
+	Kind                string         `gorm:"not null;default:task"`
 	ResourcesPercentage int            `gorm:"not null"`
 	CreatedAt           time.Time      `gorm:"not null"`
 	UpdatedAt           time.Time      `gorm:"not null"`
@@ -23,6 +29,20 @@ type WorkResource struct {
 	Owner    auth.User `gorm:"foreignKey:OwnerID"`
 }
 
+// CalendarWorkResource represents the calendar_work_resources table in the database.
+// It attaches a shared work resource to a calendar with a calendar specific allocation.
+type CalendarWorkResource struct {
+	ID                  uint      `gorm:"primaryKey"`
+	CalendarID          uint      `gorm:"not null"`
+	WorkResourceID      uint      `gorm:"not null"`
+	ResourcesPercentage int       `gorm:"not null"`
+	CreatedAt           time.Time `gorm:"not null"`
+	UpdatedAt           time.Time `gorm:"not null"`
+	// Relationship fields
+	Calendar     Calendar     `gorm:"foreignKey:CalendarID"`
+	WorkResource WorkResource `gorm:"foreignKey:WorkResourceID"`
+}
+
 // Event name constants
 const (
 	WorkResourceCreatedEvent = "work_resource.created"
@@ -30,18 +50,65 @@ const (
 	WorkResourceDeletedEvent = "work_resource.deleted"
 )
 
-// CreateWorkResource creates a new work resource
-func CreateWorkResource(name string, ownerID uint, calendarID uint, resourcesPercentage int) (WorkResource, error) {
+// Work resource kinds. Resources form a client -> project -> task tree
+// and calendar entries are logged against the task leaves.
+const (
+	WorkResourceKindClient  = "client"
+	WorkResourceKindProject = "project"
+	WorkResourceKindTask    = "task"
+)
+
+// WorkResourceKinds lists the kinds from the root of the tree to the leaves
+var WorkResourceKinds = []string{WorkResourceKindClient, WorkResourceKindProject, WorkResourceKindTask}
+
+// WorkResourceTreeItem is a work resource positioned in the flattened tree
+type WorkResourceTreeItem struct {
+	Resource WorkResource
+	Depth    int
+	Path     string // Names from the root down to this resource, e.g. "Acme / Website / Backend"
+}
+
+// IsShared reports whether the resource is owner level and attached to calendars
+func (r WorkResource) IsShared() bool {
+	return r.CalendarID == 0
+}
+
+// IsTask reports whether entries can be logged against the resource
+func (r WorkResource) IsTask() bool {
+	return r.Kind == WorkResourceKindTask || r.Kind == ""
+}
+
+// parentKindOf returns the kind a parent of the given kind must have.
+// Clients have no parent kind.
+func parentKindOf(kind string) string {
+	switch kind {
+	case WorkResourceKindProject:
+		return WorkResourceKindClient
+	case WorkResourceKindTask:
+		return WorkResourceKindProject
+	}
+	return ""
+}
+
+// CreateWorkResource creates a new work resource and publishes its created event
+func CreateWorkResource(name string, ownerID uint, calendarID uint, parentID uint, kind string, resourcesPercentage int) (WorkResource, error) {
 	resource := WorkResource{
 		Name:                name,
 		OwnerID:             ownerID,
 		CalendarID:          calendarID,
+		ParentID:            parentID,
+		Kind:                kind,
 		ResourcesPercentage: resourcesPercentage,
 		CreatedAt:           time.Now(),
 		UpdatedAt:           time.Now(),
 	}
-	result := db.Get().Create(&resource)
-	return resource, result.Error
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&resource).Error; err != nil {
+			return err
+		}
+		return publishWorkResourceEvent(tx, WorkResourceCreatedEvent, resource)
+	})
+	return resource, err
 }
 
 // GetWorkResource retrieves a work resource by its ID
@@ -72,32 +139,246 @@ func ListWorkResourcesByOwner(ownerID uint) ([]WorkResource, error) {
 	return resources, result.Error
 }
 
-// ListWorkResourcesByCalendar returns all work resources for a specific calendar
+// ListWorkResourcesByCalendar returns all work resources for a specific calendar,
+// including attached shared resources. The ResourcesPercentage of a shared
+// resource is the allocation of its attachment to this calendar.
 func ListWorkResourcesByCalendar(calendarID uint) ([]WorkResource, error) {
+	return listWorkResourcesByCalendar(db.Get(), calendarID)
+}
+
+// listWorkResourcesByCalendar is ListWorkResourcesByCalendar within a transaction
+func listWorkResourcesByCalendar(tx *gorm.DB, calendarID uint) ([]WorkResource, error) {
+	var resources []WorkResource
+	if err := tx.Where("calendar_id = ?", calendarID).Find(&resources).Error; err != nil {
+		return resources, err
+	}
+
+	var links []CalendarWorkResource
+	if err := tx.Where("calendar_id = ?", calendarID).Preload("WorkResource").Find(&links).Error; err != nil {
+		return resources, err
+	}
+	for _, link := range links {
+		// Skip attachments of shared resources that have since been deleted
+		if link.WorkResource.ID == 0 {
+			continue
+		}
+		shared := link.WorkResource
+		shared.ResourcesPercentage = link.ResourcesPercentage
+		resources = append(resources, shared)
+	}
+	return resources, nil
+}
+
+// ListWorkResourceTasksByCalendar returns the task leaves of a calendar's resource tree
+func ListWorkResourceTasksByCalendar(calendarID uint) ([]WorkResource, error) {
+	resources, err := ListWorkResourcesByCalendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []WorkResource
+	for _, r := range resources {
+		if r.IsTask() {
+			tasks = append(tasks, r)
+		}
+	}
+	return tasks, nil
+}
+
+// ListSharedWorkResources returns the shared work resources of an owner
+func ListSharedWorkResources(ownerID uint) ([]WorkResource, error) {
 	var resources []WorkResource
-	result := db.Get().Where("calendar_id = ?", calendarID).Find(&resources)
+	result := db.Get().Where("owner_id = ? AND calendar_id = 0", ownerID).Find(&resources)
 	return resources, result.Error
 }
 
-// UpdateWorkResource updates an existing work resource
-func UpdateWorkResource(id uint, name string, resourcesPercentage int) (WorkResource, error) {
+// GetSharedWorkResource retrieves a shared work resource by its ID with owner check
+func GetSharedWorkResource(id, ownerID uint) (WorkResource, error) {
 	var resource WorkResource
-	if err := db.Get().First(&resource, id).Error; err != nil {
-		return resource, err
+	result := db.Get().Where("id = ? AND owner_id = ? AND calendar_id = 0", id, ownerID).First(&resource)
+	return resource, result.Error
+}
+
+// ListCalendarWorkResources returns the shared resource attachments of a calendar
+func ListCalendarWorkResources(calendarID uint) ([]CalendarWorkResource, error) {
+	var links []CalendarWorkResource
+	result := db.Get().Where("calendar_id = ?", calendarID).Preload("WorkResource").Find(&links)
+	return links, result.Error
+}
+
+// ListCalendarWorkResourcesByOwner returns every shared resource attachment in the owner's calendars
+func ListCalendarWorkResourcesByOwner(ownerID uint) ([]CalendarWorkResource, error) {
+	var links []CalendarWorkResource
+	result := db.Get().
+		Joins("JOIN calendars ON calendars.id = calendar_work_resources.calendar_id").
+		Where("calendars.owner_id = ? AND calendars.deleted_at IS NULL", ownerID).
+		Find(&links)
+	return links, result.Error
+}
+
+// AttachWorkResource attaches a shared resource to a calendar, or updates the
+// allocation when it is already attached
+func AttachWorkResource(calendarID, resourceID uint, resourcesPercentage int) (CalendarWorkResource, error) {
+	var link CalendarWorkResource
+	err := db.Get().Where("calendar_id = ? AND work_resource_id = ?", calendarID, resourceID).Limit(1).Find(&link).Error
+	if err != nil {
+		return link, err
 	}
 
-	resource.Name = name
-	resource.ResourcesPercentage = resourcesPercentage
-	resource.UpdatedAt = time.Now()
+	link.CalendarID = calendarID
+	link.WorkResourceID = resourceID
+	link.ResourcesPercentage = resourcesPercentage
+	link.UpdatedAt = time.Now()
+	if link.ID == 0 {
+		link.CreatedAt = time.Now()
+	}
+	result := db.Get().Save(&link)
+	return link, result.Error
+}
 
-	result := db.Get().Save(&resource)
-	return resource, result.Error
+// DetachWorkResource removes a shared resource from a calendar.
+// Entries already logged against it keep their reference.
+func DetachWorkResource(calendarID, resourceID uint) error {
+	result := db.Get().Where("calendar_id = ? AND work_resource_id = ?", calendarID, resourceID).Delete(&CalendarWorkResource{})
+	return result.Error
+}
+
+// ResourceHours holds the hours logged against a resource in one calendar
+type ResourceHours struct {
+	CalendarID     uint
+	WorkResourceID uint
+	Hours          float64
+}
+
+// SumHoursByResource sums the hours an owner logged per calendar and resource in a month
+func SumHoursByResource(ownerID uint, year, month int, resourceIDs []uint) ([]ResourceHours, error) {
+	var rows []ResourceHours
+	if len(resourceIDs) == 0 {
+		return rows, nil
+	}
+	result := db.Get().Model(&CalendarEntry{}).
+		Select("calendar_entries.calendar_id, calendar_entries.work_resource_id, SUM(calendar_entries.hours) AS hours").
+		Joins("JOIN calendars ON calendars.id = calendar_entries.calendar_id").
+		Where("calendars.owner_id = ? AND calendars.deleted_at IS NULL", ownerID).
+		Where("calendar_entries.year = ? AND calendar_entries.month = ?", year, month).
+		Where("calendar_entries.work_resource_id IN ?", resourceIDs).
+		Group("calendar_entries.calendar_id, calendar_entries.work_resource_id").
+		Scan(&rows)
+	return rows, result.Error
+}
+
+// BuildWorkResourceTree flattens resources into depth-first tree order.
+// Resources whose parent is missing from the slice are treated as roots.
+func BuildWorkResourceTree(resources []WorkResource) []WorkResourceTreeItem {
+	byID := make(map[uint]bool, len(resources))
+	for _, r := range resources {
+		byID[r.ID] = true
+	}
+	children := make(map[uint][]WorkResource)
+	for _, r := range resources {
+		parentID := r.ParentID
+		if !byID[parentID] || parentID == r.ID {
+			parentID = 0
+		}
+		children[parentID] = append(children[parentID], r)
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	}
+
+	items := make([]WorkResourceTreeItem, 0, len(resources))
+	visited := make(map[uint]bool, len(resources))
+	var walk func(parentID uint, depth int, path string)
+	walk = func(parentID uint, depth int, path string) {
+		for _, r := range children[parentID] {
+			if visited[r.ID] {
+				continue
+			}
+			visited[r.ID] = true
+			itemPath := r.Name
+			if path != "" {
+				itemPath = path + " / " + r.Name
+			}
+			items = append(items, WorkResourceTreeItem{Resource: r, Depth: depth, Path: itemPath})
+			walk(r.ID, depth+1, itemPath)
+		}
+	}
+	walk(0, 0, "")
+	return items
+}
+
+// WorkResourceTaskItems returns the task leaves of the tree, labelled with their full path
+func WorkResourceTaskItems(resources []WorkResource) []WorkResourceTreeItem {
+	var tasks []WorkResourceTreeItem
+	for _, item := range BuildWorkResourceTree(resources) {
+		if item.Resource.IsTask() {
+			tasks = append(tasks, item)
+		}
+	}
+	return tasks
+}
+
+// workResourceAncestors returns the IDs of every ancestor of the resource found in byID,
+// nearest parent first. It stops at the first parent missing from byID.
+func workResourceAncestors(resourceID uint, byID map[uint]WorkResource) []uint {
+	var ancestors []uint
+	seen := map[uint]bool{resourceID: true}
+	for r, ok := byID[resourceID]; ok && r.ParentID != 0; r, ok = byID[r.ParentID] {
+		if _, known := byID[r.ParentID]; !known || seen[r.ParentID] {
+			break
+		}
+		seen[r.ParentID] = true
+		ancestors = append(ancestors, r.ParentID)
+	}
+	return ancestors
+}
+
+// UpdateWorkResource updates an existing work resource and publishes its updated event
+func UpdateWorkResource(id uint, name string, parentID uint, kind string, resourcesPercentage int) (WorkResource, error) {
+	var resource WorkResource
+	err := outbox.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&resource, id).Error; err != nil {
+			return err
+		}
+
+		resource.Name = name
+		resource.ParentID = parentID
+		resource.Kind = kind
+		resource.ResourcesPercentage = resourcesPercentage
+		resource.UpdatedAt = time.Now()
+
+		if err := tx.Save(&resource).Error; err != nil {
+			return err
+		}
+		return publishWorkResourceEvent(tx, WorkResourceUpdatedEvent, resource)
+	})
+	return resource, err
 }
 
-// DeleteWorkResource soft deletes a work resource by its ID
+// DeleteWorkResource soft deletes a work resource by its ID and publishes its deleted event.
+// Children of the resource become top level resources and calendar
+// attachments of a shared resource are removed.
 func DeleteWorkResource(id uint) error {
-	result := db.Get().Delete(&WorkResource{}, id)
-	return result.Error
+	return outbox.Transaction(func(tx *gorm.DB) error {
+		var resource WorkResource
+		if err := tx.First(&resource, id).Error; err != nil {
+			return err
+		}
+		// The events are built while the resource still has its place in the tree
+		events, err := workResourceEvents(tx, WorkResourceDeletedEvent, resource)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&WorkResource{}).Where("parent_id = ?", id).Update("parent_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("work_resource_id = ?", id).Delete(&CalendarWorkResource{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&WorkResource{}, id).Error; err != nil {
+			return err
+		}
+		return publishCalendarEvents(tx, events...)
+	})
 }
 
 // PermanentDeleteWorkResource permanently deletes a work resource by its ID
@@ -0,0 +1,179 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/app/db"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EntrySearchFilter narrows a full-text search over calendar entries.
+// Zero values mean no filtering on that field.
+type EntrySearchFilter struct {
+	Query          string
+	CalendarID     uint
+	WorkResourceID uint
+	From           time.Time
+	To             time.Time
+	MinHours       float64
+	MaxHours       float64
+	Limit          int
+	Offset         int
+}
+
+// entrySearchFTS tells whether calendar_entries_fts is in use, see SetupEntrySearch
+var entrySearchFTS bool
+
+// entrySearchTriggers keep calendar_entries_fts in line with calendar_entries, as created
+// by migration 010
+var entrySearchTriggers = map[string]string{
+	"calendar_entries_fts_ai": `create trigger if not exists calendar_entries_fts_ai after insert on calendar_entries begin
+	insert into calendar_entries_fts(rowid, text) values (new.id, new.text);
+end`,
+	"calendar_entries_fts_ad": `create trigger if not exists calendar_entries_fts_ad after delete on calendar_entries begin
+	insert into calendar_entries_fts(calendar_entries_fts, rowid, text) values ('delete', old.id, old.text);
+end`,
+	"calendar_entries_fts_au": `create trigger if not exists calendar_entries_fts_au after update of text on calendar_entries begin
+	insert into calendar_entries_fts(calendar_entries_fts, rowid, text) values ('delete', old.id, old.text);
+	insert into calendar_entries_fts(rowid, text) values (new.id, new.text);
+end`,
+}
+
+// SetupEntrySearch prepares entry search for the SQLite the binary was built with. It must
+// run before entries are written. go-sqlite3 only includes FTS5 with the sqlite_fts5 build
+// tag. Without it the triggers of migration 010 would make every write to calendar_entries
+// fail with "no such module: fts5", so they are dropped and search falls back to LIKE.
+// With FTS5 the triggers are created again when missing, and the index is rebuilt since
+// entries may have been written without them.
+func SetupEntrySearch() error {
+	var fts5 bool
+	if err := db.Get().Raw("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+		return fmt.Errorf("failed to check for FTS5: %w", err)
+	}
+	var existing []string
+	err := db.Get().Raw("select name from sqlite_master where type = 'trigger' and name like 'calendar_entries_fts_%'").
+		Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	if !fts5 {
+		entrySearchFTS = false
+		for _, name := range existing {
+			if err := db.Get().Exec("drop trigger if exists " + name).Error; err != nil {
+				return fmt.Errorf("failed to drop %s: %w", name, err)
+			}
+		}
+		if len(existing) > 0 {
+			slog.Warn("SQLite was built without FTS5, entry search falls back to LIKE. Build with -tags sqlite_fts5 to index entries.")
+		}
+		return nil
+	}
+
+	entrySearchFTS = true
+	if len(existing) == len(entrySearchTriggers) {
+		return nil
+	}
+	return db.Get().Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`create virtual table if not exists calendar_entries_fts using fts5(
+	text,
+	content='calendar_entries',
+	content_rowid='id',
+	tokenize='unicode61 remove_diacritics 2'
+)`).Error
+		if err != nil {
+			return fmt.Errorf("failed to create calendar_entries_fts: %w", err)
+		}
+		for name, stmt := range entrySearchTriggers {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+		}
+		return tx.Exec("insert into calendar_entries_fts(calendar_entries_fts) values ('rebuild')").Error
+	})
+}
+
+// likePattern matches text containing the word, with LIKE wildcards in the word escaped
+func likePattern(word string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(word) + "%"
+}
+
+// ftsQuery turns free user input into an FTS5 query where every word must
+// match as a prefix. Words are quoted so FTS5 operators in the input are ignored.
+func ftsQuery(input string) string {
+	var terms []string
+	for _, word := range strings.Fields(input) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchCalendarEntries searches the entries of an owner's calendars through the
+// calendar_entries_fts index, or with LIKE when SQLite lacks FTS5. Results are ordered
+// by relevance when a query is given and FTS5 is in use, and by date otherwise. The total
+// number of matches is returned for pagination.
+func SearchCalendarEntries(ownerID uint, filter EntrySearchFilter) ([]CalendarEntry, int64, error) {
+	var entries []CalendarEntry
+	var total int64
+
+	query := db.Get().Model(&CalendarEntry{}).
+		Joins("JOIN calendars ON calendars.id = calendar_entries.calendar_id").
+		Where("calendars.owner_id = ? AND calendars.deleted_at IS NULL", ownerID)
+
+	match := ftsQuery(filter.Query)
+	if !entrySearchFTS {
+		// Every word must appear somewhere in the text, there is no ranking
+		for _, word := range strings.Fields(filter.Query) {
+			query = query.Where(`calendar_entries.text LIKE ? ESCAPE '\'`, likePattern(word))
+		}
+		match = ""
+	} else if match != "" {
+		query = query.
+			Joins("JOIN calendar_entries_fts ON calendar_entries_fts.rowid = calendar_entries.id").
+			Where("calendar_entries_fts MATCH ?", match)
+	}
+	if filter.CalendarID != 0 {
+		query = query.Where("calendar_entries.calendar_id = ?", filter.CalendarID)
+	}
+	if filter.WorkResourceID != 0 {
+		query = query.Where("calendar_entries.work_resource_id = ?", filter.WorkResourceID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("calendar_entries.date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("calendar_entries.date < ?", filter.To.AddDate(0, 0, 1))
+	}
+	if filter.MinHours > 0 {
+		query = query.Where("calendar_entries.hours >= ?", filter.MinHours)
+	}
+	if filter.MaxHours > 0 {
+		query = query.Where("calendar_entries.hours <= ?", filter.MaxHours)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return entries, total, err
+	}
+
+	if match != "" {
+		query = query.Order("calendar_entries_fts.rank")
+	}
+	query = query.Order("calendar_entries.date desc")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	result := query.
+		Select("calendar_entries.*").
+		Preload("Calendar").
+		Preload("WorkResource").
+		Preload("Tags").
+		Find(&entries)
+	return entries, total, result.Error
+}
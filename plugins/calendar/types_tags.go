@@ -0,0 +1,156 @@
+package calendar
+
+import (
+	"gothstack/app/db"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag represents the tags table in the database.
+// Tags are free-form labels of an owner, attached to entries through calendar_entry_tags.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey"`
+	OwnerID   uint      `gorm:"not null"`
+	Name      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// TagHours holds the hours logged with a tag
+type TagHours struct {
+	Name    string
+	Hours   float64
+	Entries int
+}
+
+// AbsenceTags are the tags that mark an entry, and the day it is on, as an absence
+var AbsenceTags = []string{"absence", "vacation", "sick"}
+
+// IsAbsence reports whether the entry is tagged as an absence
+func (e CalendarEntry) IsAbsence() bool {
+	for _, tag := range e.Tags {
+		for _, name := range AbsenceTags {
+			if tag.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hashtagPattern matches #tags written in entry text
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_-]+)`)
+
+// ParseTextTags returns the #tags written in an entry text
+func ParseTextTags(text string) []string {
+	var names []string
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		names = append(names, match[1])
+	}
+	return NormalizeTags(names)
+}
+
+// ParseTagList parses an explicit comma or space separated tag list, with or without leading #
+func ParseTagList(list string) []string {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	return NormalizeTags(fields)
+}
+
+// NormalizeTags lowercases, strips leading # and removes empty and duplicate tags
+func NormalizeTags(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	normalized := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimLeft(strings.TrimSpace(name), "#"))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// EntryTags returns the tags of an entry from its text and an explicit tag list
+func EntryTags(text, list string) []string {
+	return NormalizeTags(append(ParseTextTags(text), ParseTagList(list)...))
+}
+
+// TagNames returns the names of tags as a space separated #tag list
+func TagNames(tags []Tag) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, "#"+tag.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// ListTagNames returns the names of every tag the owner has used, for autocomplete
+func ListTagNames(ownerID uint) ([]string, error) {
+	var names []string
+	result := db.Get().Model(&Tag{}).Where("owner_id = ?", ownerID).Order("name asc").Pluck("name", &names)
+	return names, result.Error
+}
+
+// setCalendarEntryTags replaces the tags of an entry within the transaction saving the entry,
+// creating the owner's tags on demand
+func setCalendarEntryTags(tx *gorm.DB, entry *CalendarEntry, ownerID uint, names []string) error {
+	tags := make([]Tag, 0, len(names))
+	for _, name := range NormalizeTags(names) {
+		tag := Tag{OwnerID: ownerID, Name: name}
+		err := tx.Where(Tag{OwnerID: ownerID, Name: name}).
+			Attrs(Tag{CreatedAt: time.Now(), UpdatedAt: time.Now()}).
+			FirstOrCreate(&tag).Error
+		if err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	if err := tx.Model(entry).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	entry.Tags = tags
+	return nil
+}
+
+// SumHoursByTag sums an owner's logged hours per tag between two dates, optionally within one calendar.
+// An entry with several tags counts towards each of them.
+func SumHoursByTag(ownerID uint, calendarID uint, startDate, endDate time.Time) ([]TagHours, error) {
+	var rows []TagHours
+	query := db.Get().Table("calendar_entry_tags").
+		Select("tags.name AS name, SUM(calendar_entries.hours) AS hours, COUNT(*) AS entries").
+		Joins("JOIN tags ON tags.id = calendar_entry_tags.tag_id").
+		Joins("JOIN calendar_entries ON calendar_entries.id = calendar_entry_tags.calendar_entry_id").
+		Joins("JOIN calendars ON calendars.id = calendar_entries.calendar_id").
+		Where("calendars.owner_id = ? AND calendars.deleted_at IS NULL AND calendar_entries.deleted_at IS NULL", ownerID).
+		Where("calendar_entries.date BETWEEN ? AND ?", startDate, endDate)
+	if calendarID != 0 {
+		query = query.Where("calendar_entries.calendar_id = ?", calendarID)
+	}
+	result := query.Group("tags.name").Order("hours desc").Scan(&rows)
+	return rows, result.Error
+}
+
+// SumUntaggedHours sums an owner's logged hours without any tag between two dates
+func SumUntaggedHours(ownerID uint, calendarID uint, startDate, endDate time.Time) (TagHours, error) {
+	row := TagHours{Name: ""}
+	query := db.Get().Model(&CalendarEntry{}).
+		Select("COALESCE(SUM(calendar_entries.hours), 0) AS hours, COUNT(*) AS entries").
+		Joins("JOIN calendars ON calendars.id = calendar_entries.calendar_id").
+		Where("calendars.owner_id = ? AND calendars.deleted_at IS NULL", ownerID).
+		Where("calendar_entries.date BETWEEN ? AND ?", startDate, endDate).
+		Where("NOT EXISTS (SELECT 1 FROM calendar_entry_tags WHERE calendar_entry_tags.calendar_entry_id = calendar_entries.id)")
+	if calendarID != 0 {
+		query = query.Where("calendar_entries.calendar_id = ?", calendarID)
+	}
+	result := query.Scan(&row)
+	return row, result.Error
+}
@@ -0,0 +1,417 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gothstack/app/db"
+	"gothstack/app/outbox"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookPingEvent is delivered when the user sends a test event from the webhooks page
+const WebhookPingEvent = "webhook.ping"
+
+// Delivery settings. A failed attempt is retried after webhookRetryBase, doubling with every
+// attempt, until webhookMaxAttempts attempts have failed: about two hours in total.
+const (
+	webhookMaxAttempts   = 8
+	webhookRetryBase     = time.Minute
+	webhookTimeout       = 10 * time.Second
+	webhookPollInterval  = 15 * time.Second
+	webhookBatchSize     = 50
+	webhookResponseLimit = 1024
+	webhookLogRetention  = 30 * 24 * time.Hour
+	webhookSecretPrefix  = "whsec_"
+	webhookUserAgent     = "gothstack-webhooks/1"
+)
+
+// Webhook is a URL that receives the events of a calendar as signed JSON POST requests.
+// Events is a comma separated list of event names, empty for every event.
+type Webhook struct {
+	ID         uint   `gorm:"primaryKey"`
+	CalendarID uint   `gorm:"not null"`
+	URL        string `gorm:"not null"`
+	Secret     string `gorm:"not null"`
+	Events     string `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	// Relationship field
+	Calendar Calendar `gorm:"foreignKey:CalendarID"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook. It is kept with the
+// outcome of its last attempt for the delivery log.
+type WebhookDelivery struct {
+	ID             uint   `gorm:"primaryKey"`
+	WebhookID      uint   `gorm:"not null"`
+	Event          string `gorm:"not null"`
+	Payload        string `gorm:"not null"`
+	Status         string `gorm:"not null"`
+	Attempts       int    `gorm:"not null"`
+	NextAttemptAt  *time.Time
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	ResponseBody   string
+	Error          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+
+	// Relationship field
+	Webhook Webhook `gorm:"foreignKey:WebhookID"`
+}
+
+// EventNames returns the events the webhook receives, nil for every event
+func (w Webhook) EventNames() []string {
+	if w.Events == "" {
+		return nil
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Receives reports whether the webhook receives the event
+func (w Webhook) Receives(name string) bool {
+	return w.Events == "" || name == WebhookPingEvent || slices.Contains(w.EventNames(), name)
+}
+
+// newWebhookSecret returns a random signing secret
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload returns the signature header value of a payload sent at the given time:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the secret.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ListWebhooks returns the webhooks of a calendar
+func ListWebhooks(calendarID uint) ([]Webhook, error) {
+	var webhooks []Webhook
+	result := db.Get().Where("calendar_id = ?", calendarID).Order("id asc").Find(&webhooks)
+	return webhooks, result.Error
+}
+
+// GetWebhook returns a webhook of a calendar
+func GetWebhook(id, calendarID uint) (Webhook, error) {
+	var webhook Webhook
+	result := db.Get().Where("id = ? AND calendar_id = ?", id, calendarID).First(&webhook)
+	return webhook, result.Error
+}
+
+// CreateWebhook creates a webhook with a new signing secret
+func CreateWebhook(calendarID uint, url string, events []string) (Webhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook := Webhook{
+		CalendarID: calendarID,
+		URL:        url,
+		Secret:     secret,
+		Events:     strings.Join(events, ","),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := db.Get().Create(&webhook).Error; err != nil {
+		return webhook, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+func DeleteWebhook(id uint) error {
+	return db.Get().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Webhook{}, id).Error
+	})
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of a webhook, newest first
+func ListWebhookDeliveries(webhookID uint, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	result := db.Get().Where("webhook_id = ?", webhookID).Order("id desc").Limit(limit).Find(&deliveries)
+	return deliveries, result.Error
+}
+
+// GetWebhookDelivery returns a delivery of a webhook
+func GetWebhookDelivery(id, webhookID uint) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	result := db.Get().Where("id = ? AND webhook_id = ?", id, webhookID).First(&delivery)
+	return delivery, result.Error
+}
+
+// QueueWebhookDelivery queues a payload for delivery to a webhook as soon as possible
+func QueueWebhookDelivery(webhookID uint, name string, payload []byte) (WebhookDelivery, error) {
+	now := time.Now()
+	delivery := WebhookDelivery{
+		WebhookID:     webhookID,
+		Event:         name,
+		Payload:       string(payload),
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := db.Get().Create(&delivery).Error; err != nil {
+		return delivery, fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	wakeWebhookWorker()
+	return delivery, nil
+}
+
+// queueCalendarEventDeliveries queues an event for every webhook of its calendar receiving it.
+// The payload is the event as published, delivered byte for byte. The deliveries are queued
+// in one transaction, so that a retried event does not queue some of them twice.
+func queueCalendarEventDeliveries(ctx context.Context, payload json.RawMessage) error {
+	var evt CalendarEvent
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return err
+	}
+	webhooks, err := ListWebhooks(evt.CalendarID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var deliveries []WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhook.Receives(evt.Event) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         evt.Event,
+			Payload:       string(payload),
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := db.Get().Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	wakeWebhookWorker()
+	return nil
+}
+
+// RegisterWebhookEvents subscribes the webhooks to the calendar events
+func RegisterWebhookEvents() {
+	for _, name := range CalendarEvents {
+		outbox.Subscribe(name, "webhooks", queueCalendarEventDeliveries)
+	}
+}
+
+// webhookWake wakes the delivery worker when a delivery is queued
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookDeniedPrefixes are special purpose ranges not covered by the netip.Addr checks
+var webhookDeniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use IPv4/IPv6 translation
+}
+
+// webhookAddressAllowed tells whether deliveries may connect to the address. Webhook URLs are
+// given by users, so the server must not be used to reach itself or its private network.
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range webhookDeniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl rejects connections to addresses that are not allowed. It runs on the
+// resolved address of every connection, so host names resolving to them are caught as well.
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !webhookAddressAllowed(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+// webhookClient sends the deliveries. Redirects are not followed, a webhook URL must answer itself.
+// It connects directly, without the proxy of the environment, so that every address is checked.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// RunWebhookWorker delivers due webhook deliveries until the context is cancelled.
+// It polls for retries and is woken up whenever a delivery is queued.
+func RunWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := DeliverDueWebhooks(ctx); err != nil {
+			slog.Error("failed to deliver webhooks", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// DeliverDueWebhooks attempts the pending deliveries whose next attempt is due, and removes
+// deliveries older than the retention of the delivery log
+func DeliverDueWebhooks(ctx context.Context) error {
+	err := db.Get().Where("created_at < ? AND status <> ?", time.Now().Add(-webhookLogRetention), WebhookDeliveryPending).
+		Delete(&WebhookDelivery{}).Error
+	if err != nil {
+		return err
+	}
+	for {
+		var deliveries []WebhookDelivery
+		err := db.Get().Preload("Webhook").
+			Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at asc, id asc").
+			Limit(webhookBatchSize).
+			Find(&deliveries).Error
+		if err != nil {
+			return err
+		}
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return nil
+			}
+			attemptWebhookDelivery(ctx, &deliveries[i])
+			if err := db.Get().Omit("Webhook").Save(&deliveries[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+// attemptWebhookDelivery sends a delivery once and records the outcome. Any 2xx response
+// counts as delivered, anything else is retried with exponential backoff.
+func attemptWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.UpdatedAt = now
+	delivery.ResponseStatus, delivery.ResponseBody, delivery.Error = 0, "", ""
+
+	if delivery.Webhook.ID == 0 {
+		delivery.Status, delivery.NextAttemptAt, delivery.Error = WebhookDeliveryFailed, nil, "webhook deleted"
+		return
+	}
+	status, body, err := sendWebhookDelivery(ctx, *delivery, now)
+	delivery.ResponseStatus = status
+	if (status >= 200 && status < 300) || (status >= 400 && status < 500) {
+		// Only the answers of the receiver itself are kept for the delivery log, not error
+		// pages of servers or proxies in front of it
+		delivery.ResponseBody = body
+	}
+	if err == nil && status >= 200 && status < 300 {
+		delivery.Status, delivery.NextAttemptAt = WebhookDeliverySucceeded, nil
+		return
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Error = fmt.Sprintf("unexpected response status %d", status)
+	}
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status, delivery.NextAttemptAt = WebhookDeliveryFailed, nil
+		return
+	}
+	next := now.Add(webhookRetryBase << (delivery.Attempts - 1))
+	delivery.NextAttemptAt = &next
+}
+
+// sendWebhookDelivery posts the payload of a delivery to its webhook and returns the
+// response status and the start of the response body
+func sendWebhookDelivery(ctx context.Context, delivery WebhookDelivery, now time.Time) (int, string, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(delivery.Webhook.Secret, timestamp, payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	return resp.StatusCode, string(body), err
+}
@@ -0,0 +1,192 @@
+package calendar
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	got := SignWebhookPayload("whsec_test", 1700000000, []byte(`{"event":"webhook.ping"}`))
+	want := "sha256=f1b0032e7f2eb55946822f997ea28bcc9b2130583c2322179bc8afecdc1c5726"
+	if got != want {
+		t.Errorf("signature %s, want %s", got, want)
+	}
+}
+
+func TestSendWebhookDeliveryHeaders(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	// The test server listens on a loopback address, which the webhook client refuses
+	client := webhookClient
+	webhookClient = srv.Client()
+	t.Cleanup(func() { webhookClient = client })
+
+	now := time.Unix(1700000000, 0)
+	delivery := WebhookDelivery{
+		ID:      7,
+		Event:   WebhookPingEvent,
+		Payload: `{"event":"webhook.ping"}`,
+		Webhook: Webhook{ID: 1, URL: srv.URL, Secret: "whsec_test"},
+	}
+	status, response, err := sendWebhookDelivery(context.Background(), delivery, now)
+	if err != nil || status != http.StatusOK || response != "ok" {
+		t.Fatalf("status %d, body %q, err %v", status, response, err)
+	}
+	if string(body) != delivery.Payload {
+		t.Errorf("body %s, want %s", body, delivery.Payload)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":        "application/json",
+		"X-Webhook-Event":     WebhookPingEvent,
+		"X-Webhook-Delivery":  "7",
+		"X-Webhook-Timestamp": "1700000000",
+		"X-Webhook-Signature": "sha256=f1b0032e7f2eb55946822f997ea28bcc9b2130583c2322179bc8afecdc1c5726",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s header %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWebhookAddressAllowed(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"64:ff9b:1::a00:1", false},
+	}
+	for _, test := range tests {
+		if got := webhookAddressAllowed(netip.MustParseAddr(test.addr)); got != test.allowed {
+			t.Errorf("webhookAddressAllowed(%s) = %t, want %t", test.addr, got, test.allowed)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"127.0.0.1:8080", false},
+		{"[::1]:80", false},
+		{"100.64.0.1:80", false},
+		{"10.0.0.1:443", false},
+		{"example.com:443", false},
+	}
+	for _, test := range tests {
+		if err := webhookDialControl("tcp", test.address, nil); (err == nil) != test.allowed {
+			t.Errorf("webhookDialControl(%s) = %v, want allowed %t", test.address, err, test.allowed)
+		}
+	}
+
+	// Deliveries to a local server fail before anything is sent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a request reached the local server")
+	}))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := webhookClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("the webhook client connected to a loopback address")
+	}
+}
+
+func TestAttemptWebhookDeliveryRetries(t *testing.T) {
+	// The webhook client refuses loopback addresses, so every attempt fails
+	delivery := WebhookDelivery{
+		Status:  WebhookDeliveryPending,
+		Payload: `{}`,
+		Webhook: Webhook{ID: 1, URL: "http://127.0.0.1:1/hook"},
+	}
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		attemptWebhookDelivery(context.Background(), &delivery)
+		if delivery.Attempts != attempt || delivery.Error == "" {
+			t.Fatalf("attempt %d: attempts %d, error %q", attempt, delivery.Attempts, delivery.Error)
+		}
+		if attempt == webhookMaxAttempts {
+			break
+		}
+		if delivery.Status != WebhookDeliveryPending || delivery.NextAttemptAt == nil {
+			t.Fatalf("attempt %d: status %s, next attempt %v", attempt, delivery.Status, delivery.NextAttemptAt)
+		}
+		want := webhookRetryBase << (attempt - 1)
+		if got := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt); got != want {
+			t.Errorf("attempt %d: retried after %s, want %s", attempt, got, want)
+		}
+	}
+	if delivery.Status != WebhookDeliveryFailed || delivery.NextAttemptAt != nil {
+		t.Errorf("after %d attempts: status %s, next attempt %v", webhookMaxAttempts, delivery.Status, delivery.NextAttemptAt)
+	}
+
+	// A 2xx answer delivers, other answers are retried
+	for _, test := range []struct {
+		status int
+		want   string
+	}{
+		{http.StatusNoContent, WebhookDeliverySucceeded},
+		{http.StatusGone, WebhookDeliveryPending},
+		{http.StatusBadGateway, WebhookDeliveryPending},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+		}))
+		client := webhookClient
+		webhookClient = srv.Client()
+		delivery := WebhookDelivery{Status: WebhookDeliveryPending, Webhook: Webhook{ID: 1, URL: srv.URL}}
+		attemptWebhookDelivery(context.Background(), &delivery)
+		webhookClient = client
+		srv.Close()
+		if delivery.Status != test.want || delivery.ResponseStatus != test.status {
+			t.Errorf("status %d: delivery %s with %d, want %s", test.status, delivery.Status, delivery.ResponseStatus, test.want)
+		}
+	}
+
+	// Deliveries of deleted webhooks fail at once
+	orphan := WebhookDelivery{Status: WebhookDeliveryPending}
+	attemptWebhookDelivery(context.Background(), &orphan)
+	if orphan.Status != WebhookDeliveryFailed || orphan.Error != "webhook deleted" {
+		t.Errorf("delivery of a deleted webhook: status %s, error %q", orphan.Status, orphan.Error)
+	}
+}
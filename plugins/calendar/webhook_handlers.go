@@ -0,0 +1,244 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anthdm/superkit/kit"
+	v "github.com/anthdm/superkit/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookLogSize is the number of deliveries shown in the delivery log
+const webhookLogSize = 100
+
+// webhookURLMaxLength is the longest payload URL accepted
+const webhookURLMaxLength = 2000
+
+// Validation schema for webhooks. The URL is checked by validateWebhookURL, the schema
+// cannot name the URL field.
+var webhookSchema = v.Schema{}
+
+// WebhookFormValues holds form data for a new webhook. Events are the checked event
+// names, the form posts each one as an events value.
+type WebhookFormValues struct {
+	URL    string `form:"url"`
+	Events []string
+}
+
+// WebhooksPageData holds data for the webhooks page of a calendar
+type WebhooksPageData struct {
+	Calendar   Calendar
+	Webhooks   []Webhook
+	FormValues WebhookFormValues
+	FormErrors v.Errors
+	Message    string
+}
+
+// WebhookDeliveriesPageData holds data for the delivery log of a webhook
+type WebhookDeliveriesPageData struct {
+	Calendar   Calendar
+	Webhook    Webhook
+	Deliveries []WebhookDelivery
+	Message    string
+}
+
+// validateWebhookURL checks that the URL is an absolute http or https URL of a public host
+func validateWebhookURL(values WebhookFormValues, errors v.Errors) bool {
+	if len(values.URL) > webhookURLMaxLength {
+		errors.Add("url", fmt.Sprintf("Enter a URL of at most %d characters", webhookURLMaxLength))
+		return false
+	}
+	u, err := url.Parse(values.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errors.Add("url", "Enter an absolute http:// or https:// URL")
+		return false
+	}
+	// Host names are checked again on every delivery, when they are resolved
+	addr, err := netip.ParseAddr(u.Hostname())
+	if strings.EqualFold(u.Hostname(), "localhost") || (err == nil && !webhookAddressAllowed(addr)) {
+		errors.Add("url", "Enter a public address, webhooks cannot be delivered to local or private networks")
+		return false
+	}
+	return true
+}
+
+// validateWebhookEvents checks that at least one known event is selected
+func validateWebhookEvents(values WebhookFormValues, errors v.Errors) bool {
+	if len(values.Events) == 0 {
+		errors.Add("events", "Select at least one event")
+		return false
+	}
+	for _, name := range values.Events {
+		if !slices.Contains(CalendarEvents, name) {
+			errors.Add("events", fmt.Sprintf("Unknown event %q", name))
+			return false
+		}
+	}
+	return true
+}
+
+// loadWebhooksPageData loads the calendar in the URL and its webhooks
+func loadWebhooksPageData(kit *kit.Kit) (WebhooksPageData, error) {
+	var data WebhooksPageData
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return data, fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	data.Calendar, err = GetCalendar(uint(calendarID), kit.Auth().(auth.Auth).UserID)
+	if err != nil {
+		return data, err
+	}
+	data.Webhooks, err = ListWebhooks(data.Calendar.ID)
+	data.FormValues.Events = CalendarEvents
+	return data, err
+}
+
+// loadWebhook loads the webhook in the URL, which must belong to the calendar
+func loadWebhook(kit *kit.Kit, calendar Calendar) (Webhook, error) {
+	webhookID, err := strconv.ParseUint(chi.URLParam(kit.Request, "webhook_id"), 10, 32)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("invalid webhook ID: %w", err)
+	}
+	return GetWebhook(uint(webhookID), calendar.ID)
+}
+
+// HandleWebhookList renders the webhooks page of a calendar
+func HandleWebhookList(kit *kit.Kit) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+	return kit.Render(CalendarWebhooks(data))
+}
+
+// HandleWebhookCreate adds a webhook to a calendar
+func HandleWebhookCreate(kit *kit.Kit) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+
+	var values WebhookFormValues
+	errors, ok := v.Request(kit.Request, &values, webhookSchema)
+	values.Events = kit.Request.PostForm["events"]
+	if !validateWebhookURL(values, errors) {
+		ok = false
+	}
+	if !validateWebhookEvents(values, errors) {
+		ok = false
+	}
+	if !ok {
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(CalendarWebhooks(data))
+	}
+
+	// Every event selected is stored as no filter, so that events added later are received too
+	events := values.Events
+	if len(events) == len(CalendarEvents) {
+		events = nil
+	}
+	webhook, err := CreateWebhook(data.Calendar.ID, values.URL, events)
+	if err != nil {
+		errors.Add("general", "Failed to create the webhook.")
+		data.FormValues, data.FormErrors = values, errors
+		return kit.Render(CalendarWebhooks(data))
+	}
+	data.Webhooks = append(data.Webhooks, webhook)
+	data.Message = "Webhook added. Verify the signature of each delivery with the secret shown below."
+	return kit.Render(CalendarWebhooks(data))
+}
+
+// HandleWebhookDelete deletes a webhook and its delivery log
+func HandleWebhookDelete(kit *kit.Kit) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+	webhook, err := loadWebhook(kit, data.Calendar)
+	if err != nil {
+		return err
+	}
+	if err := DeleteWebhook(webhook.ID); err != nil {
+		return err
+	}
+	return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%d/webhooks", data.Calendar.ID))
+}
+
+// renderWebhookDeliveries renders the delivery log of the webhook in the URL
+func renderWebhookDeliveries(kit *kit.Kit, message string) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+	webhook, err := loadWebhook(kit, data.Calendar)
+	if err != nil {
+		return err
+	}
+	deliveries, err := ListWebhookDeliveries(webhook.ID, webhookLogSize)
+	if err != nil {
+		return err
+	}
+	return kit.Render(WebhookDeliveries(WebhookDeliveriesPageData{
+		Calendar:   data.Calendar,
+		Webhook:    webhook,
+		Deliveries: deliveries,
+		Message:    message,
+	}))
+}
+
+// HandleWebhookDeliveries renders the delivery log of a webhook
+func HandleWebhookDeliveries(kit *kit.Kit) error {
+	return renderWebhookDeliveries(kit, "")
+}
+
+// HandleWebhookPing queues a test event for a webhook
+func HandleWebhookPing(kit *kit.Kit) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+	webhook, err := loadWebhook(kit, data.Calendar)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(newCalendarEvent(WebhookPingEvent, data.Calendar.ID, map[string]any{"webhook_id": webhook.ID}))
+	if err != nil {
+		return err
+	}
+	if _, err := QueueWebhookDelivery(webhook.ID, WebhookPingEvent, payload); err != nil {
+		return err
+	}
+	return renderWebhookDeliveries(kit, "Test event queued.")
+}
+
+// HandleWebhookRedeliver queues the payload of a past delivery again as a new delivery
+func HandleWebhookRedeliver(kit *kit.Kit) error {
+	data, err := loadWebhooksPageData(kit)
+	if err != nil {
+		return err
+	}
+	webhook, err := loadWebhook(kit, data.Calendar)
+	if err != nil {
+		return err
+	}
+	deliveryID, err := strconv.ParseUint(chi.URLParam(kit.Request, "delivery_id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid delivery ID: %w", err)
+	}
+	delivery, err := GetWebhookDelivery(uint(deliveryID), webhook.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := QueueWebhookDelivery(webhook.ID, delivery.Event, []byte(delivery.Payload)); err != nil {
+		return err
+	}
+	return renderWebhookDeliveries(kit, fmt.Sprintf("Delivery %d queued again.", delivery.ID))
+}
@@ -0,0 +1,131 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"github.com/go-chi/chi/v5"
+)
+
+// DayStats holds the entries and hours of a single day against the daily target
+type DayStats struct {
+	Date          time.Time
+	IsWeekend     bool
+	IsHoliday     bool
+	HolidayName   string
+	IsAbsence     bool // an entry of the day is tagged as an absence
+	Entries       []CalendarEntry
+	LoggedHours   float64 // Hours logged on this day
+	TargetHours   float64 // Daily work hours on working days, zero on weekends and holidays
+	RunningLogged float64 // Hours logged from the start of the period up to and including this day
+	RunningTarget float64 // Target hours from the start of the period up to and including this day
+}
+
+// WeekStats holds the statistics of an ISO 8601 week
+type WeekStats struct {
+	Year        int // ISO year the week belongs to
+	Week        int
+	Days        []DayStats
+	LoggedHours float64
+	TargetHours float64
+}
+
+// HandleCalendarViewByWeek renders the week view of a calendar.
+// Without year and week URL parameters the current week is shown.
+func HandleCalendarViewByWeek(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+
+	year, week := time.Now().ISOWeek()
+	if y, err := strconv.Atoi(chi.URLParam(kit.Request, "year")); err == nil {
+		year = y
+	}
+	if w, err := strconv.Atoi(chi.URLParam(kit.Request, "isoWeek")); err == nil {
+		week = w
+	}
+	// Normalize out of range weeks, e.g. week 53 of a year with only 52 weeks
+	monday := isoWeekStart(year, week)
+	if y, w := monday.ISOWeek(); y != year || w != week {
+		return kit.Redirect(http.StatusSeeOther, fmt.Sprintf("/calendars/%d/week/%d/%d", calendarID, y, w))
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	calendar, err := GetCalendarWithEntriesByDateRange(uint(calendarID), userID, monday, monday.AddDate(0, 0, 7))
+	if err != nil {
+		return err
+	}
+
+	stats := calculateWeekStats(calendar, monday)
+	return kit.Render(CalendarViewWeekly(calendar, stats))
+}
+
+// calculateDayStats groups the calendar entries by day from start over the given
+// number of days, with per-day and running totals against the daily target
+func calculateDayStats(calendar Calendar, start time.Time, days int) []DayStats {
+	entriesByDate := make(map[string][]CalendarEntry)
+	for _, entry := range calendar.Entries {
+		key := entry.Date.Format("2006-01-02")
+		entriesByDate[key] = append(entriesByDate[key], entry)
+	}
+
+	stats := make([]DayStats, 0, days)
+	runningLogged, runningTarget := 0.0, 0.0
+	for i := 0; i < days; i++ {
+		date := start.AddDate(0, 0, i)
+		day := DayStats{
+			Date:      date,
+			IsWeekend: date.Weekday() == time.Saturday || date.Weekday() == time.Sunday,
+			Entries:   entriesByDate[date.Format("2006-01-02")],
+		}
+		if isHoliday, holiday := IsFinnishHoliday(date); isHoliday {
+			day.IsHoliday = true
+			day.HolidayName = holiday.Name
+		}
+		if !day.IsWeekend && !day.IsHoliday {
+			day.TargetHours = calendar.DailyWorkHours
+		}
+		for _, entry := range day.Entries {
+			day.LoggedHours += entry.Hours
+			if entry.IsAbsence() {
+				day.IsAbsence = true
+			}
+		}
+		runningLogged += day.LoggedHours
+		runningTarget += day.TargetHours
+		day.RunningLogged = runningLogged
+		day.RunningTarget = runningTarget
+		stats = append(stats, day)
+	}
+	return stats
+}
+
+// calculateWeekStats calculates the statistics of the ISO week starting on monday
+func calculateWeekStats(calendar Calendar, monday time.Time) WeekStats {
+	year, week := monday.ISOWeek()
+	stats := WeekStats{
+		Year: year,
+		Week: week,
+		Days: calculateDayStats(calendar, monday, 7),
+	}
+	last := stats.Days[len(stats.Days)-1]
+	stats.LoggedHours = last.RunningLogged
+	stats.TargetHours = last.RunningTarget
+	return stats
+}
+
+// WeekURL returns the week view URL of the calendar for the ISO week containing date
+func WeekURL(calendarID uint, date time.Time) string {
+	year, week := date.ISOWeek()
+	return fmt.Sprintf("/calendars/%d/week/%d/%d", calendarID, year, week)
+}
+
+// DayURL returns the day view URL of the calendar for the date
+func DayURL(calendarID uint, date time.Time) string {
+	return fmt.Sprintf("/calendars/%d/day/%s", calendarID, date.Format("2006-01-02"))
+}
@@ -0,0 +1,208 @@
+package calendar
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell styles of the xlsx writer, indexes into the cellXfs of xlsxStyles
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleTotal
+	xlsxStyleDate
+	xlsxStyleHours
+	xlsxStyleWeekend
+	xlsxStyleWeekendDate
+	xlsxStyleWeekendHours
+	xlsxStyleHoliday
+	xlsxStyleHolidayDate
+	xlsxStyleHolidayHours
+)
+
+// xlsxStyles defines the fills and number formats of the cell styles above.
+// Weekends and holidays use the colours of the month grid.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="0.00"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd ddd"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="4"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FF93C5FD"/><bgColor indexed="64"/></patternFill></fill><fill><patternFill patternType="solid"><fgColor rgb="FFFEE2E2"/><bgColor indexed="64"/></patternFill></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="11">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="0" fillId="2" borderId="0" xfId="0" applyFill="1"/>
+<xf numFmtId="165" fontId="0" fillId="2" borderId="0" xfId="0" applyFill="1" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="2" borderId="0" xfId="0" applyFill="1" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="0" fillId="3" borderId="0" xfId="0" applyFill="1"/>
+<xf numFmtId="165" fontId="0" fillId="3" borderId="0" xfId="0" applyFill="1" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="3" borderId="0" xfId="0" applyFill="1" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// xlsxCell is a cell of an xlsx sheet. Value is a string, a float64 or a time.Time;
+// a cell with a Formula is computed by the spreadsheet when the workbook is opened.
+type xlsxCell struct {
+	Value   any
+	Formula string
+	Style   int
+}
+
+// xlsxSheet is a worksheet of an xlsx workbook
+type xlsxSheet struct {
+	Name      string
+	Columns   []float64 // column widths in characters, zero for the default width
+	Rows      [][]xlsxCell
+	FreezeRow bool // keep the first row visible while scrolling
+}
+
+// xlsxColumn returns the column letters of a zero based column index, e.g. 0 is A and 26 is AA
+func xlsxColumn(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxRef returns the cell reference of zero based column and row indexes, e.g. 0, 0 is A1
+func xlsxRef(column, row int) string {
+	return xlsxColumn(column) + strconv.Itoa(row+1)
+}
+
+// xlsxSheetRef returns a reference to a cell on another sheet for use in formulas
+func xlsxSheetRef(sheet string, column, row int) string {
+	return "'" + strings.ReplaceAll(sheet, "'", "''") + "'!" + xlsxRef(column, row)
+}
+
+// xlsxSerialDate returns the spreadsheet serial number of a date
+func xlsxSerialDate(date time.Time) float64 {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return day.Sub(epoch).Hours() / 24
+}
+
+// xmlEscape escapes text for XML content and attribute values
+func xmlEscape(text string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(text))
+	return builder.String()
+}
+
+// writeXLSX writes the sheets as an Office Open XML workbook
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.Name), i+1, i+1)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	contentTypes.WriteString(`</Types>`)
+	// Formulas are written without cached values, so have them calculated on open
+	workbook.WriteString(`</sheets><calcPr calcId="191029" fullCalcOnLoad="1"/></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, file := range files {
+		part, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(part, file.content); err != nil {
+			return err
+		}
+	}
+	for i, sheet := range sheets {
+		part, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXSheet(part, sheet); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeXLSXSheet writes the worksheet XML of a sheet
+func writeXLSXSheet(w io.Writer, sheet xlsxSheet) error {
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if sheet.FreezeRow {
+		builder.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	if len(sheet.Columns) > 0 {
+		builder.WriteString(`<cols>`)
+		for i, width := range sheet.Columns {
+			if width > 0 {
+				fmt.Fprintf(&builder, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, width)
+			}
+		}
+		builder.WriteString(`</cols>`)
+	}
+	builder.WriteString(`<sheetData>`)
+	for r, row := range sheet.Rows {
+		fmt.Fprintf(&builder, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := xlsxRef(c, r)
+			switch {
+			case cell.Formula != "":
+				fmt.Fprintf(&builder, `<c r="%s" s="%d"><f>%s</f></c>`, ref, cell.Style, xmlEscape(cell.Formula))
+			case cell.Value == nil:
+				if cell.Style != xlsxStyleDefault {
+					fmt.Fprintf(&builder, `<c r="%s" s="%d"/>`, ref, cell.Style)
+				}
+			default:
+				switch value := cell.Value.(type) {
+				case float64:
+					fmt.Fprintf(&builder, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.Style, strconv.FormatFloat(value, 'f', -1, 64))
+				case time.Time:
+					fmt.Fprintf(&builder, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.Style, strconv.FormatFloat(xlsxSerialDate(value), 'f', -1, 64))
+				case string:
+					fmt.Fprintf(&builder, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, cell.Style, xmlEscape(value))
+				default:
+					return fmt.Errorf("unsupported xlsx cell value %T", cell.Value)
+				}
+			}
+		}
+		builder.WriteString(`</row>`)
+	}
+	builder.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
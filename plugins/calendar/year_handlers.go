@@ -0,0 +1,118 @@
+package calendar
+
+import (
+	"fmt"
+	"gothstack/plugins/auth"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/superkit/kit"
+	"github.com/go-chi/chi/v5"
+)
+
+// YearMonthSummary holds the statistics of one month of the year overview
+type YearMonthSummary struct {
+	Month                int
+	Stats                WorkMonthStats
+	Days                 []DayStats
+	Difference           float64 // Logged minus target hours of the month
+	CumulativeDifference float64 // Difference from the start of the year up to and including this month
+}
+
+// YearOverview holds the statistics of every month of a year
+type YearOverview struct {
+	Year        int
+	Months      []YearMonthSummary
+	TargetHours float64
+	LoggedHours float64
+}
+
+// HandleCalendarViewByYear renders the year overview of a calendar
+func HandleCalendarViewByYear(kit *kit.Kit) error {
+	calendarID, err := strconv.ParseUint(chi.URLParam(kit.Request, "id"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid calendar ID: %w", err)
+	}
+	year, err := strconv.Atoi(chi.URLParam(kit.Request, "year"))
+	if err != nil {
+		return fmt.Errorf("invalid year: %w", err)
+	}
+
+	userID := kit.Auth().(auth.Auth).UserID
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	calendar, err := GetCalendarWithEntriesByDateRange(uint(calendarID), userID, start, start.AddDate(1, 0, 0))
+	if err != nil {
+		return err
+	}
+	resources, err := ListWorkResourcesByCalendar(uint(calendarID))
+	if err != nil {
+		return err
+	}
+
+	return kit.Render(CalendarViewYearly(calendar, calculateYearOverview(calendar, resources, year)))
+}
+
+// calculateYearOverview runs the monthly work statistics for each month of the year
+func calculateYearOverview(calendar Calendar, resources []WorkResource, year int) YearOverview {
+	entriesByMonth := make(map[int][]CalendarEntry)
+	for _, entry := range calendar.Entries {
+		month := int(entry.Date.Month())
+		entriesByMonth[month] = append(entriesByMonth[month], entry)
+	}
+
+	overview := YearOverview{Year: year}
+	cumulative := 0.0
+	for month := 1; month <= 12; month++ {
+		monthCalendar := calendar
+		monthCalendar.Entries = entriesByMonth[month]
+
+		first := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		summary := YearMonthSummary{
+			Month: month,
+			Stats: calculateWorkStats(monthCalendar, resources, year, month),
+			Days:  calculateDayStats(monthCalendar, first, first.AddDate(0, 1, -1).Day()),
+		}
+		summary.Difference = summary.Stats.LoggedHours - summary.Stats.TotalWorkHours
+		cumulative += summary.Difference
+		summary.CumulativeDifference = cumulative
+
+		overview.TargetHours += summary.Stats.TotalWorkHours
+		overview.LoggedHours += summary.Stats.LoggedHours
+		overview.Months = append(overview.Months, summary)
+	}
+	return overview
+}
+
+// heatmapClass returns the colour of a day in the year heatmap
+func heatmapClass(day DayStats) string {
+	switch {
+	case day.IsAbsence:
+		return "bg-yellow-400"
+	case day.IsHoliday:
+		return "bg-red-400"
+	case day.LoggedHours == 0 && day.IsWeekend:
+		return "bg-gray-400"
+	case day.LoggedHours == 0:
+		return "bg-gray-200"
+	case day.TargetHours == 0 || day.LoggedHours >= day.TargetHours*1.25:
+		return "bg-green-800"
+	case day.LoggedHours >= day.TargetHours:
+		return "bg-green-600"
+	case day.LoggedHours >= day.TargetHours/2:
+		return "bg-green-400"
+	default:
+		return "bg-green-200"
+	}
+}
+
+// heatmapTitle returns the tooltip of a day in the year heatmap
+func heatmapTitle(day DayStats) string {
+	title := fmt.Sprintf("%s: %.2f / %.2f h", day.Date.Format("Mon 02.01.2006"), day.LoggedHours, day.TargetHours)
+	if day.IsHoliday {
+		title += ", " + day.HolidayName
+	}
+	if day.IsAbsence {
+		title += ", absence"
+	}
+	return title
+}